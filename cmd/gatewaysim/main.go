@@ -0,0 +1,55 @@
+// Command gatewaysim runs a fake Pentair ScreenLogic gateway so the pool
+// controller can be developed without a pool.
+//
+// Usage:
+//
+//	gatewaysim -scenario internal/gateway/gatewaysim/testdata/home.json
+//
+// Then start the controller with GATEWAY_DISCOVERY_ADDR=127.0.0.1:1444, or
+// point GATEWAY_IP and the gateway port at the simulator directly.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+)
+
+func main() {
+	scenarioPath := flag.String("scenario", "", "scenario JSON file (default: built-in pool and spa)")
+	addr := flag.String("addr", "127.0.0.1:6681", "TCP address for gateway connections")
+	discoveryAddr := flag.String("discovery-addr", "127.0.0.1:1444", "UDP address for discovery (empty to disable)")
+	flag.Parse()
+
+	scenario := gatewaysim.DefaultScenario()
+	if *scenarioPath != "" {
+		var err error
+		scenario, err = gatewaysim.LoadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sim := gatewaysim.NewServer(scenario)
+	if err := sim.Listen(*addr); err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *addr, err)
+	}
+	log.Printf("Simulating %q on %s", scenario.Name, sim.Addr())
+
+	if *discoveryAddr != "" {
+		if err := sim.ListenDiscovery(*discoveryAddr); err != nil {
+			log.Fatalf("Failed to listen for discovery on %s: %v", *discoveryAddr, err)
+		}
+		log.Printf("Answering discovery on %s", sim.DiscoveryAddr())
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	sim.Close()
+}
@@ -0,0 +1,68 @@
+// Command pool-calendar shows the hot tub calendar and what the scheduler
+// would do right now.
+//
+// Usage:
+//
+//	CALENDAR_URL=https://calendar.google.com/calendar/ical/.../basic.ics pool-calendar
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/scheduler"
+)
+
+func main() {
+	calendarURL := os.Getenv(scheduler.EnvCalendarURL)
+	if calendarURL == "" {
+		fmt.Fprintln(os.Stderr, "CALENDAR_URL is not set")
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	events, err := scheduler.FetchEvents(calendarURL, now, now.Add(24*time.Hour))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Current time: %s\n\n", now.Format(time.RFC1123))
+
+	var active, upcoming []scheduler.CalendarEvent
+	for _, e := range events {
+		switch {
+		case e.AllDay:
+			// The scheduler ignores all-day events
+		case e.ActiveAt(now):
+			active = append(active, e)
+		case e.Start.After(now):
+			upcoming = append(upcoming, e)
+		}
+	}
+
+	if len(active) == 0 {
+		fmt.Println("No active events. Hot tub would NOT be triggered.")
+	} else {
+		fmt.Println("Active events:")
+		for _, e := range active {
+			printEvent(e)
+		}
+		fmt.Println("\nHot tub WOULD be triggered (if pool is off).")
+	}
+
+	fmt.Println("\nUpcoming events (next 24h):")
+	if len(upcoming) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, e := range upcoming {
+		printEvent(e)
+	}
+}
+
+// printEvent prints one event line.
+func printEvent(e scheduler.CalendarEvent) {
+	start, end := e.Start.Local(), e.End.Local()
+	fmt.Printf("  - %s to %s  %s\n", start.Format("Mon 3:04 PM"), end.Format("3:04 PM"), e.Summary)
+}
@@ -0,0 +1,94 @@
+// Command pool-controller serves the pool's Pentair ScreenLogic gateway over
+// HTTP and to Alexa.
+//
+// Usage:
+//
+//	pool-controller -port 8080 -gateway-ip 192.168.1.100 -update-interval 30s
+//
+// Without a gateway IP (flag or GATEWAY_IP) the gateway is found by
+// discovery. Setting CALENDAR_URL starts the hot tub scheduler and
+// MQTT_BROKER starts the Home Assistant publisher; the other settings are
+// read from the environment by the packages that use them.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/alexa"
+	"github.com/nstielau/pool-controller/internal/api"
+	"github.com/nstielau/pool-controller/internal/homeassistant"
+	"github.com/nstielau/pool-controller/internal/pool"
+	"github.com/nstielau/pool-controller/internal/scheduler"
+)
+
+// gatewayPort is the ScreenLogic port used with an explicit gateway IP.
+const gatewayPort = 80
+
+func main() {
+	port := flag.String("port", envOr("PORT", "80"), "HTTP server port")
+	gatewayIP := flag.String("gateway-ip", os.Getenv("GATEWAY_IP"), "gateway IP (default: discover)")
+	updateInterval := flag.Duration("update-interval", 30*time.Second, "how old status may get before a refresh")
+	flag.Parse()
+
+	bridge, err := pool.NewBridge(*gatewayIP, gatewayPort, *updateInterval)
+	if err != nil {
+		log.Fatalf("Failed to connect to gateway: %v", err)
+	}
+	defer bridge.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers stop with ctx; wait for them (the publisher sends
+	// its offline status) before the bridge closes
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	if calendarURL := os.Getenv(scheduler.EnvCalendarURL); calendarURL != "" {
+		sched := scheduler.New(calendarURL, bridge, scheduler.DefaultPollInterval)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sched.Run(ctx)
+		}()
+		log.Print("Hot tub scheduler started")
+	}
+	if broker := os.Getenv(homeassistant.EnvBroker); broker != "" {
+		publisher := homeassistant.New(broker, bridge, homeassistant.DefaultPollInterval)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			publisher.Run(ctx)
+		}()
+		log.Printf("Publishing to Home Assistant through %s", broker)
+	}
+
+	router := api.NewRouter(bridge, alexa.NewHandler(bridge))
+	server := &http.Server{Addr: ":" + *port, Handler: router.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// envOr returns the environment variable name, or def if it is unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -8,14 +8,34 @@
 // # Supported Intents
 //
 //   - LaunchRequest         Skill invocation ("Alexa, open pool party")
-//   - StartSwimJetIntent    Turn on swim jets
+//   - StartSwimJetIntent    Turn on swim jets, once confirmed ({duration} slot)
 //   - StopSwimJetIntent     Turn off swim jets
-//   - StartHotTubIntent     Turn on spa/hot tub
+//   - StartHotTubIntent     Turn on spa/hot tub ({duration} slot)
 //   - StopHotTubIntent      Turn off spa/hot tub
 //   - HotTubTempIntent      Query spa temperature
+//   - SetHotTubTempIntent   Set the spa heat set point ({temperature} slot)
+//   - SetLightModeIntent    Set pool light show/color ({mode} slot)
 //   - AMAZON.CancelIntent   Cancel/stop skill
 //   - AMAZON.StopIntent     Stop skill
 //
+// # Slots
+//
+// Intent slots are parsed into Slot values. Resolved returns the canonical
+// value when entity resolution matched a synonym (so "tropical" can mean
+// the caribbean light show), and Int reads AMAZON.NUMBER slots.
+//
+// An AMAZON.DURATION slot on the start intents (an ISO-8601 duration such
+// as "PT20M") schedules the circuit's auto-off through the Bridge, which
+// persists it across restarts; the stop intents cancel it.
+//
+// # Dialogs
+//
+// Responses can carry Dialog.ConfirmIntent and Dialog.Delegate directives
+// (ConfirmIntentResponse, DelegateResponse). StartSwimJetIntent only acts
+// when the intent's ConfirmationStatus is CONFIRMED: during a dialog from
+// the interaction model it delegates to Alexa, otherwise it asks for
+// confirmation itself. A DENIED confirmation leaves the jets off.
+//
 // # Security
 //
 // All incoming requests are verified using Amazon's signature verification:
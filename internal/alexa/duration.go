@@ -0,0 +1,72 @@
+package alexa
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDuration matches the ISO-8601 durations AMAZON.DURATION produces that
+// have a fixed length: weeks, days, hours, minutes and seconds, e.g.
+// "PT20M", "PT1H30M" or "P1D". Years and months are rejected.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseDuration converts an AMAZON.DURATION slot value to a time.Duration.
+func parseDuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("unsupported duration %q", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("duration %q: %w", s, err)
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[5] != "" {
+		secs, err := strconv.ParseFloat(m[5], 64)
+		if err != nil {
+			return 0, fmt.Errorf("duration %q: %w", s, err)
+		}
+		d += time.Duration(secs * float64(time.Second))
+	}
+
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
+
+// spokenDuration says d in hours and minutes, e.g. "1 hour 30 minutes".
+func spokenDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		return "less than a minute"
+	}
+
+	var parts []string
+	if h := minutes / 60; h > 0 {
+		parts = append(parts, plural(h, "hour"))
+	}
+	if m := minutes % 60; m > 0 {
+		parts = append(parts, plural(m, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
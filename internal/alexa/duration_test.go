@@ -0,0 +1,60 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "PT20M", want: 20 * time.Minute},
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "PT45S", want: 45 * time.Second},
+		{in: "P1D", want: 24 * time.Hour},
+		{in: "P1W", want: 7 * 24 * time.Hour},
+		{in: "P1DT2H", want: 26 * time.Hour},
+		{in: "P1Y", wantErr: true},
+		{in: "P1M", wantErr: true},
+		{in: "P", wantErr: true},
+		{in: "PT", wantErr: true},
+		{in: "PT0M", wantErr: true},
+		{in: "?", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSpokenDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{20 * time.Minute, "20 minutes"},
+		{19*time.Minute + 59*time.Second, "20 minutes"},
+		{time.Minute, "1 minute"},
+		{time.Hour, "1 hour"},
+		{90 * time.Minute, "1 hour 30 minutes"},
+		{2*time.Hour + time.Minute, "2 hours 1 minute"},
+		{20 * time.Second, "less than a minute"},
+	}
+
+	for _, tt := range tests {
+		if got := spokenDuration(tt.in); got != tt.want {
+			t.Errorf("spokenDuration(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
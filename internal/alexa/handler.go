@@ -2,6 +2,7 @@ package alexa
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,9 +11,14 @@ import (
 	"time"
 
 	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/metrics"
 	"github.com/nstielau/pool-controller/internal/pool"
 )
 
+// intentsHandled counts intent requests, exported at /metrics.
+var intentsHandled = metrics.NewCounter("pool_alexa_intents_total",
+	"Alexa intents handled, by intent name.", "intent")
+
 // Request is the Alexa skill request structure.
 type Request struct {
 	Version string         `json:"version"`
@@ -46,13 +52,31 @@ type RequestBody struct {
 	Timestamp string `json:"timestamp"`
 	Locale    string `json:"locale"`
 	Intent    Intent `json:"intent,omitempty"`
+
+	// DialogState is STARTED, IN_PROGRESS or COMPLETED for intents with a
+	// dialog in the interaction model, and empty otherwise.
+	DialogState string `json:"dialogState,omitempty"`
 }
 
+// spaBody is the Bridge body index of the hot tub.
+const spaBody = 1
+
+// Dialog states and intent confirmation statuses.
+const (
+	DialogStarted    = "STARTED"
+	DialogInProgress = "IN_PROGRESS"
+	DialogCompleted  = "COMPLETED"
+
+	ConfirmationNone      = "NONE"
+	ConfirmationConfirmed = "CONFIRMED"
+	ConfirmationDenied    = "DENIED"
+)
+
 // Intent contains intent information.
 type Intent struct {
-	Name               string                 `json:"name"`
-	ConfirmationStatus string                 `json:"confirmationStatus"`
-	Slots              map[string]interface{} `json:"slots"`
+	Name               string          `json:"name"`
+	ConfirmationStatus string          `json:"confirmationStatus"`
+	Slots              map[string]Slot `json:"slots,omitempty"`
 }
 
 // Handler handles Alexa skill requests.
@@ -129,7 +153,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "LaunchRequest":
 		response = h.handleLaunchRequest()
 	case "IntentRequest":
-		response = h.handleIntent(req.Request.Intent.Name)
+		response = h.handleIntent(req.Request)
 	case "SessionEndedRequest":
 		response = SpeakResponse("Goodbye!", true)
 	default:
@@ -158,38 +182,57 @@ func (h *Handler) handleLaunchRequest() *Response {
 }
 
 // handleIntent routes to the appropriate intent handler.
-func (h *Handler) handleIntent(intentName string) *Response {
-	switch intentName {
+func (h *Handler) handleIntent(req RequestBody) *Response {
+	intent := req.Intent
+	intentsHandled.Inc(intent.Name)
+
+	switch intent.Name {
 	case "StartSwimJetIntent":
-		return h.handleStartSwimJet()
+		return h.handleStartSwimJet(intent, req.DialogState)
 	case "StopSwimJetIntent":
 		return h.handleStopSwimJet()
 	case "StartHotTubIntent":
-		return h.handleStartHotTub()
+		return h.handleStartHotTub(intent)
 	case "StopHotTubIntent":
 		return h.handleStopHotTub()
 	case "HotTubTempIntent":
 		return h.handleHotTubTemp()
+	case "SetHotTubTempIntent":
+		return h.handleSetHotTubTemp(intent, req.DialogState)
+	case "SetLightModeIntent":
+		return h.handleSetLightMode(intent)
 	case "AMAZON.CancelIntent", "AMAZON.StopIntent":
 		return SpeakResponse("Party on!", true)
 	case "AMAZON.HelpIntent":
-		return SpeakResponse("You can ask me to turn on the hot tub, turn on the swim jets, or get the hot tub temperature.", false)
+		return SpeakResponse("You can ask me to turn on the hot tub, set the hot tub to a temperature, turn on the swim jets, set the pool lights to a color, or get the hot tub temperature.", false)
 	default:
 		return SpeakResponse("I don't know how to do that.", true)
 	}
 }
 
-// handleStartSwimJet turns on the swim jets.
-func (h *Handler) handleStartSwimJet() *Response {
-	err := h.bridge.SetCircuit(gateway.CircuitSwimJets, 1)
-	if err != nil {
-		h.logger.Printf("Failed to start swim jet: %v", err)
-		return SpeakResponse("Sorry, I couldn't start the swim jet.", true)
+// handleStartSwimJet turns on the swim jets once the user has confirmed.
+// While the interaction model's dialog is running Alexa asks for the
+// confirmation itself; otherwise the skill asks with Dialog.ConfirmIntent.
+func (h *Handler) handleStartSwimJet(intent Intent, dialogState string) *Response {
+	switch intent.ConfirmationStatus {
+	case ConfirmationConfirmed:
+	case ConfirmationDenied:
+		return SpeakResponse("Okay, I won't start the swim jets.", true)
+	default:
+		if dialogState == DialogStarted || dialogState == DialogInProgress {
+			return DelegateResponse(&intent)
+		}
+		prompt := "Do you want to start the swim jets?"
+		if d, err := parseDuration(intent.Slots["duration"].Value); err == nil {
+			prompt = fmt.Sprintf("Do you want to start the swim jets for %s?", spokenDuration(d))
+		}
+		return ConfirmIntentResponse(prompt, intent)
 	}
-	return SpeakResponse("Pool jet started", true)
+
+	return h.startCircuit(intent, gateway.CircuitSwimJets, "swim jet", "Pool jet started")
 }
 
-// handleStopSwimJet turns off the swim jets.
+// handleStopSwimJet turns off the swim jets, cancelling any auto-off.
 func (h *Handler) handleStopSwimJet() *Response {
 	err := h.bridge.SetCircuit(gateway.CircuitSwimJets, 0)
 	if err != nil {
@@ -200,16 +243,38 @@ func (h *Handler) handleStopSwimJet() *Response {
 }
 
 // handleStartHotTub turns on the spa.
-func (h *Handler) handleStartHotTub() *Response {
-	err := h.bridge.SetCircuit(gateway.CircuitSpa, 1)
+func (h *Handler) handleStartHotTub(intent Intent) *Response {
+	return h.startCircuit(intent, gateway.CircuitSpa, "hot tub", "Hot Tub started")
+}
+
+// startCircuit turns a circuit on, for as long as the duration slot says
+// if it was filled, and says when it will turn off. The Bridge saves the
+// auto-off across restarts, and turning the circuit off cancels it.
+func (h *Handler) startCircuit(intent Intent, circuitID int, name, started string) *Response {
+	var duration time.Duration
+	if slot := intent.Slots["duration"]; slot.Value != "" {
+		d, err := parseDuration(slot.Value)
+		if err != nil {
+			h.logger.Printf("Not starting %s: %v", name, err)
+			return SpeakResponse(fmt.Sprintf("Sorry, I didn't catch how long to run the %s.", name), true)
+		}
+		duration = d
+	}
+
+	offAt, err := h.bridge.SetCircuitFor(circuitID, 1, duration)
 	if err != nil {
-		h.logger.Printf("Failed to start hot tub: %v", err)
-		return SpeakResponse("Sorry, I couldn't start the hot tub.", true)
+		h.logger.Printf("Failed to start %s: %v", name, err)
+		return SpeakResponse(fmt.Sprintf("Sorry, I couldn't start the %s.", name), true)
+	}
+	if offAt.IsZero() {
+		return SpeakResponse(started, true)
 	}
-	return SpeakResponse("Hot Tub started", true)
+
+	text := fmt.Sprintf("%s. It will turn off in %s, at %s", started, spokenDuration(time.Until(offAt)), offAt.Format("3:04 PM"))
+	return SpeakResponse(text, true)
 }
 
-// handleStopHotTub turns off the spa.
+// handleStopHotTub turns off the spa, cancelling any auto-off.
 func (h *Handler) handleStopHotTub() *Response {
 	err := h.bridge.SetCircuit(gateway.CircuitSpa, 0)
 	if err != nil {
@@ -240,3 +305,66 @@ func (h *Handler) handleHotTubTemp() *Response {
 	text := fmt.Sprintf("Hot Tub is %d %s", temp, unit)
 	return SpeakResponse(text, true)
 }
+
+// handleSetHotTubTemp changes the spa heat set point to the temperature
+// slot, within the controller's limits.
+func (h *Handler) handleSetHotTubTemp(intent Intent, dialogState string) *Response {
+	slot := intent.Slots["temperature"]
+	if slot.Value == "" && (dialogState == DialogStarted || dialogState == DialogInProgress) {
+		// The interaction model prompts for the temperature
+		return DelegateResponse(&intent)
+	}
+	if slot.ConfirmationStatus == ConfirmationDenied || intent.ConfirmationStatus == ConfirmationDenied {
+		return SpeakResponse("Okay, I'll leave the hot tub as it is.", true)
+	}
+
+	temp, ok := slot.Int()
+	if !ok {
+		return SpeakResponse("What temperature should I set the hot tub to?", false)
+	}
+
+	// Refresh data
+	h.bridge.Update()
+
+	unit := h.bridge.TemperatureUnit()
+	err := h.bridge.SetHeatSetPoint(spaBody, temp)
+	if errors.Is(err, pool.ErrInvalidValue) {
+		if body, ok := h.bridge.GetBody(spaBody); ok {
+			return SpeakResponse(fmt.Sprintf("The hot tub can be set between %d and %d %s.", body.MinSetPoint, body.MaxSetPoint, unit), true)
+		}
+	}
+	if errors.Is(err, pool.ErrNotFound) {
+		return SpeakResponse("Sorry, I couldn't find the hot tub.", true)
+	}
+	if err != nil {
+		h.logger.Printf("Failed to set hot tub to %d: %v", temp, err)
+		return SpeakResponse("Sorry, I couldn't change the hot tub temperature.", true)
+	}
+
+	// The spa only reads its water temperature while it runs
+	text := fmt.Sprintf("Hot Tub set to %d %s", temp, unit)
+	if !h.bridge.IsSpaOn() {
+		text += ". It's off, so it won't heat until you turn it on"
+	} else if current, err := h.bridge.GetSpaTemperature(); err == nil {
+		text += fmt.Sprintf(". It's %d %s now", current, unit)
+	}
+	return SpeakResponse(text, true)
+}
+
+// handleSetLightMode sends a light show or color command to the pool lights.
+func (h *Handler) handleSetLightMode(intent Intent) *Response {
+	mode := slotValue(intent, "mode")
+	if mode == "" {
+		return SpeakResponse("Which light show? You can say party, romantic, caribbean, american, sunset, royal, or a color.", false)
+	}
+
+	err := h.bridge.SetLightMode(mode)
+	if errors.Is(err, pool.ErrInvalidValue) {
+		return SpeakResponse(fmt.Sprintf("Sorry, %s isn't a light show I know.", mode), true)
+	}
+	if err != nil {
+		h.logger.Printf("Failed to set light mode %q: %v", mode, err)
+		return SpeakResponse("Sorry, I couldn't change the pool lights.", true)
+	}
+	return SpeakResponse(fmt.Sprintf("Pool lights set to %s", mode), true)
+}
@@ -0,0 +1,300 @@
+package alexa
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// newSimHandler returns a Handler for a Bridge on a gateway simulator.
+func newSimHandler(t *testing.T) (*Handler, *gatewaysim.Server) {
+	t.Helper()
+
+	sim := gatewaysim.NewServer(gatewaysim.DefaultScenario())
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	t.Setenv("TIMERS_FILE", filepath.Join(t.TempDir(), "timers.json"))
+	t.Setenv("ALEXA_SKIP_VERIFY", "true")
+
+	bridge, err := pool.NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+
+	return NewHandler(bridge), sim
+}
+
+// ask sends an intent request and returns the parsed response.
+func ask(t *testing.T, h *Handler, request string) Response {
+	t.Helper()
+
+	body := `{"version":"1.0","request":` + request + `}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+
+	var resp Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q: %v", rr.Body.String(), err)
+	}
+	return resp
+}
+
+// circuitState returns a circuit's state in the simulator.
+func circuitState(sim *gatewaysim.Server, id int) int {
+	for _, c := range sim.Scenario().Circuits {
+		if c.ID == id {
+			return c.State
+		}
+	}
+	return -1
+}
+
+func TestSlots(t *testing.T) {
+	raw := `{
+		"name": "SetLightModeIntent",
+		"slots": {
+			"mode": {
+				"name": "mode",
+				"value": "tropical",
+				"confirmationStatus": "NONE",
+				"resolutions": {"resolutionsPerAuthority": [{
+					"authority": "amzn1.er-authority.echo-sdk.skill.LightMode",
+					"status": {"code": "ER_SUCCESS_MATCH"},
+					"values": [{"value": {"name": "caribbean", "id": "CARIBBEAN"}}]
+				}]}
+			},
+			"color": {
+				"name": "color",
+				"value": "plaid",
+				"resolutions": {"resolutionsPerAuthority": [{"authority": "x", "status": {"code": "ER_SUCCESS_NO_MATCH"}}]}
+			},
+			"temperature": {"name": "temperature", "value": "102"},
+			"unheard": {"name": "unheard", "value": "?"}
+		}
+	}`
+
+	var intent Intent
+	if err := json.Unmarshal([]byte(raw), &intent); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if got := intent.Slots["mode"].Resolved(); got != "caribbean" {
+		t.Errorf("mode resolved to %q, want the synonym's canonical value caribbean", got)
+	}
+	if got := intent.Slots["color"].Resolved(); got != "plaid" {
+		t.Errorf("color resolved to %q, want the spoken value without a match", got)
+	}
+	if n, ok := intent.Slots["temperature"].Int(); !ok || n != 102 {
+		t.Errorf("temperature Int() = %d, %v", n, ok)
+	}
+	for _, name := range []string{"unheard", "missing"} {
+		if _, ok := intent.Slots[name].Int(); ok {
+			t.Errorf("%s Int() should fail", name)
+		}
+	}
+}
+
+func TestSetHotTubTemp(t *testing.T) {
+	h, sim := newSimHandler(t)
+
+	setSpa := func(temp string) Response {
+		return ask(t, h, `{"type":"IntentRequest","intent":{"name":"SetHotTubTempIntent","slots":{"temperature":{"name":"temperature","value":"`+temp+`"}}}}`)
+	}
+	spaSetPoint := func() int {
+		return sim.Scenario().Bodies[1].SetPoint
+	}
+
+	resp := setSpa("104")
+	if got := resp.Response.OutputSpeech.Text; got != "Hot Tub set to 104 °F. It's off, so it won't heat until you turn it on" {
+		t.Errorf("set to 104 said %q", got)
+	}
+	if spaSetPoint() != 104 {
+		t.Errorf("simulated spa set point = %d, want 104", spaSetPoint())
+	}
+
+	// The current temperature is reported while the spa runs
+	ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartHotTubIntent"}}`)
+	if got := setSpa("100").Response.OutputSpeech.Text; got != "Hot Tub set to 100 °F. It's 99 °F now" {
+		t.Errorf("set to 100 said %q", got)
+	}
+
+	// Outside the controller's limits nothing changes
+	if got := setSpa("110").Response.OutputSpeech.Text; got != "The hot tub can be set between 40 and 104 °F." {
+		t.Errorf("set to 110 said %q", got)
+	}
+	if spaSetPoint() != 100 {
+		t.Errorf("simulated spa set point = %d after a bad request, want 100", spaSetPoint())
+	}
+
+	// Without a temperature it asks, or lets the dialog model ask
+	if resp := setSpa("?"); resp.Response.ShouldEndSession {
+		t.Errorf("unheard temperature should keep the session open: %+v", resp.Response)
+	}
+	resp = ask(t, h, `{"type":"IntentRequest","dialogState":"STARTED","intent":{"name":"SetHotTubTempIntent","slots":{"temperature":{"name":"temperature"}}}}`)
+	if d := resp.Response.Directives; len(d) != 1 || d[0].Type != DirectiveDelegate {
+		t.Errorf("dialog directives = %+v, want Dialog.Delegate", d)
+	}
+}
+
+func TestStartSwimJetNeedsConfirmation(t *testing.T) {
+	h, sim := newSimHandler(t)
+
+	// Without a dialog model the skill asks for confirmation itself
+	resp := ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartSwimJetIntent","confirmationStatus":"NONE"}}`)
+	if d := resp.Response.Directives; len(d) != 1 || d[0].Type != DirectiveConfirmIntent || d[0].UpdatedIntent.Name != "StartSwimJetIntent" {
+		t.Errorf("unconfirmed directives = %+v, want Dialog.ConfirmIntent", d)
+	}
+	if resp.Response.ShouldEndSession || resp.Response.OutputSpeech == nil {
+		t.Errorf("unconfirmed response = %+v, want a prompt that keeps the session open", resp.Response)
+	}
+
+	// With one, Alexa runs the confirmation
+	resp = ask(t, h, `{"type":"IntentRequest","dialogState":"STARTED","intent":{"name":"StartSwimJetIntent","confirmationStatus":"NONE"}}`)
+	if d := resp.Response.Directives; len(d) != 1 || d[0].Type != DirectiveDelegate {
+		t.Errorf("dialog directives = %+v, want Dialog.Delegate", d)
+	}
+
+	resp = ask(t, h, `{"type":"IntentRequest","dialogState":"COMPLETED","intent":{"name":"StartSwimJetIntent","confirmationStatus":"DENIED"}}`)
+	if !resp.Response.ShouldEndSession || len(resp.Response.Directives) != 0 {
+		t.Errorf("denied response = %+v", resp.Response)
+	}
+	if circuitState(sim, gateway.CircuitSwimJets) != 0 {
+		t.Fatal("swim jets started without confirmation")
+	}
+
+	resp = ask(t, h, `{"type":"IntentRequest","dialogState":"COMPLETED","intent":{"name":"StartSwimJetIntent","confirmationStatus":"CONFIRMED"}}`)
+	if resp.Response.OutputSpeech == nil || resp.Response.OutputSpeech.Text != "Pool jet started" {
+		t.Errorf("confirmed response = %+v", resp.Response)
+	}
+	if circuitState(sim, gateway.CircuitSwimJets) != 1 {
+		t.Error("simulated swim jets should be on")
+	}
+}
+
+func TestStartWithDuration(t *testing.T) {
+	h, sim := newSimHandler(t)
+
+	resp := ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartHotTubIntent","slots":{"duration":{"name":"duration","value":"PT20M"}}}}`)
+	offAt, ok := h.bridge.CircuitOffAt(gateway.CircuitSpa)
+	if !ok {
+		t.Fatal("no auto-off scheduled for the hot tub")
+	}
+	if d := time.Until(offAt); d < 19*time.Minute || d > 20*time.Minute {
+		t.Errorf("hot tub turns off in %v, want 20m", d)
+	}
+	want := "Hot Tub started. It will turn off in 20 minutes, at " + offAt.Format("3:04 PM")
+	if resp.Response.OutputSpeech == nil || resp.Response.OutputSpeech.Text != want {
+		t.Errorf("speech = %+v, want %q", resp.Response.OutputSpeech, want)
+	}
+	if circuitState(sim, gateway.CircuitSpa) != 1 {
+		t.Error("simulated spa should be on")
+	}
+
+	// A restart picks the pending off back up
+	h.bridge.Close()
+	bridge, err := pool.NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+	h = NewHandler(bridge)
+	if restored, ok := bridge.CircuitOffAt(gateway.CircuitSpa); !ok || !restored.Equal(offAt) {
+		t.Errorf("after restart CircuitOffAt() = %v, %v, want %v", restored, ok, offAt)
+	}
+
+	// Stopping cancels it
+	ask(t, h, `{"type":"IntentRequest","intent":{"name":"StopHotTubIntent"}}`)
+	if _, ok := bridge.CircuitOffAt(gateway.CircuitSpa); ok {
+		t.Error("auto-off still pending after StopHotTubIntent")
+	}
+	if circuitState(sim, gateway.CircuitSpa) != 0 {
+		t.Error("simulated spa should be off")
+	}
+
+	// The swim jets ask with the duration, then schedule it once confirmed
+	resp = ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartSwimJetIntent","confirmationStatus":"NONE","slots":{"duration":{"name":"duration","value":"PT1H30M"}}}}`)
+	if resp.Response.OutputSpeech == nil || resp.Response.OutputSpeech.Text != "Do you want to start the swim jets for 1 hour 30 minutes?" {
+		t.Errorf("prompt = %+v", resp.Response.OutputSpeech)
+	}
+	resp = ask(t, h, `{"type":"IntentRequest","dialogState":"COMPLETED","intent":{"name":"StartSwimJetIntent","confirmationStatus":"CONFIRMED","slots":{"duration":{"name":"duration","value":"PT1H30M"}}}}`)
+	if resp.Response.OutputSpeech == nil || !strings.HasPrefix(resp.Response.OutputSpeech.Text, "Pool jet started. It will turn off in 1 hour 30 minutes") {
+		t.Errorf("confirmed speech = %+v", resp.Response.OutputSpeech)
+	}
+	if _, ok := bridge.CircuitOffAt(gateway.CircuitSwimJets); !ok {
+		t.Error("no auto-off scheduled for the swim jets")
+	}
+
+	// A duration Alexa couldn't parse doesn't start anything
+	ask(t, h, `{"type":"IntentRequest","intent":{"name":"StopSwimJetIntent"}}`)
+	resp = ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartHotTubIntent","slots":{"duration":{"name":"duration","value":"P1M"}}}}`)
+	if resp.Response.OutputSpeech == nil || !strings.HasPrefix(resp.Response.OutputSpeech.Text, "Sorry") {
+		t.Errorf("invalid duration speech = %+v", resp.Response.OutputSpeech)
+	}
+	if circuitState(sim, gateway.CircuitSpa) != 0 {
+		t.Error("hot tub started with an invalid duration")
+	}
+}
+
+func TestStartWithDurationSurvivesRestart(t *testing.T) {
+	t.Setenv("CIRCUIT_MAX_RUNTIMES", "500=4h")
+	h, sim := newSimHandler(t)
+
+	// The spa runs on its max runtime while the jets get twenty minutes
+	ask(t, h, `{"type":"IntentRequest","intent":{"name":"StartHotTubIntent"}}`)
+	ask(t, h, `{"type":"IntentRequest","dialogState":"COMPLETED","intent":{"name":"StartSwimJetIntent","confirmationStatus":"CONFIRMED","slots":{"duration":{"name":"duration","value":"PT20M"}}}}`)
+	spaOff, spaOK := h.bridge.CircuitOffAt(gateway.CircuitSpa)
+	jetsOff, jetsOK := h.bridge.CircuitOffAt(gateway.CircuitSwimJets)
+	if !spaOK || !jetsOK {
+		t.Fatalf("auto-offs before restart: spa %v, jets %v", spaOK, jetsOK)
+	}
+
+	h.bridge.Close()
+	bridge, err := pool.NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+
+	for id, want := range map[int]time.Time{gateway.CircuitSpa: spaOff, gateway.CircuitSwimJets: jetsOff} {
+		if got, ok := bridge.CircuitOffAt(id); !ok || !got.Equal(want) {
+			t.Errorf("circuit %d offAt after restart = %v, %v, want %v", id, got, ok, want)
+		}
+	}
+}
+
+func TestSlotValue(t *testing.T) {
+	raw := `{
+		"name": "SetLightModeIntent",
+		"confirmationStatus": "NONE",
+		"slots": {
+			"mode": {"name": "mode", "value": "caribbean"},
+			"empty": {"name": "empty"}
+		}
+	}`
+
+	var intent Intent
+	if err := json.Unmarshal([]byte(raw), &intent); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if got := slotValue(intent, "mode"); got != "caribbean" {
+		t.Errorf("slotValue(mode) = %q, want caribbean", got)
+	}
+	if got := slotValue(intent, "empty"); got != "" {
+		t.Errorf("slotValue(empty) = %q, want empty", got)
+	}
+	if got := slotValue(intent, "missing"); got != "" {
+		t.Errorf("slotValue(missing) = %q, want empty", got)
+	}
+}
@@ -11,9 +11,22 @@ type Response struct {
 type ResponseBody struct {
 	OutputSpeech     *OutputSpeech `json:"outputSpeech,omitempty"`
 	Card             *Card         `json:"card,omitempty"`
+	Directives       []Directive   `json:"directives,omitempty"`
 	ShouldEndSession bool          `json:"shouldEndSession"`
 }
 
+// Dialog directive types.
+const (
+	DirectiveConfirmIntent = "Dialog.ConfirmIntent"
+	DirectiveDelegate      = "Dialog.Delegate"
+)
+
+// Directive asks Alexa to take a step in a dialog.
+type Directive struct {
+	Type          string  `json:"type"`
+	UpdatedIntent *Intent `json:"updatedIntent,omitempty"`
+}
+
 // OutputSpeech defines speech output.
 type OutputSpeech struct {
 	Type string `json:"type"`
@@ -60,3 +73,30 @@ func SpeakWithReprompt(text string, reprompt string) *Response {
 		},
 	}
 }
+
+// ConfirmIntentResponse asks the user to confirm intent, speaking prompt.
+// Alexa sends the intent again with ConfirmationStatus CONFIRMED or DENIED.
+func ConfirmIntentResponse(prompt string, intent Intent) *Response {
+	return &Response{
+		Version: "1.0",
+		Response: ResponseBody{
+			OutputSpeech: &OutputSpeech{
+				Type: "PlainText",
+				Text: prompt,
+			},
+			Directives: []Directive{{Type: DirectiveConfirmIntent, UpdatedIntent: &intent}},
+		},
+	}
+}
+
+// DelegateResponse hands the next dialog step to Alexa, which follows the
+// prompts and confirmations in the skill's interaction model. Pass nil to
+// continue with the intent as received.
+func DelegateResponse(intent *Intent) *Response {
+	return &Response{
+		Version: "1.0",
+		Response: ResponseBody{
+			Directives: []Directive{{Type: DirectiveDelegate, UpdatedIntent: intent}},
+		},
+	}
+}
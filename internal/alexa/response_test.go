@@ -2,6 +2,7 @@ package alexa
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -81,3 +82,32 @@ func TestSpeakWithReprompt(t *testing.T) {
 		t.Errorf("Text = %s, want What would you like?", resp.Response.OutputSpeech.Text)
 	}
 }
+
+func TestConfirmIntentResponseJSON(t *testing.T) {
+	intent := Intent{Name: "StartSwimJetIntent", ConfirmationStatus: "NONE"}
+	data, err := json.Marshal(ConfirmIntentResponse("Start the swim jets?", intent))
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+
+	want := `"directives":[{"type":"Dialog.ConfirmIntent","updatedIntent":{"name":"StartSwimJetIntent","confirmationStatus":"NONE"}}],"shouldEndSession":false`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("ConfirmIntentResponse JSON = %s, want it to contain %s", data, want)
+	}
+	if !strings.Contains(string(data), `"text":"Start the swim jets?"`) {
+		t.Errorf("ConfirmIntentResponse JSON = %s, missing the prompt", data)
+	}
+}
+
+func TestDelegateResponse(t *testing.T) {
+	data, err := json.Marshal(DelegateResponse(nil))
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+
+	// Alexa speaks the model's prompt, so the skill says nothing
+	want := `{"version":"1.0","response":{"directives":[{"type":"Dialog.Delegate"}],"shouldEndSession":false}}`
+	if string(data) != want {
+		t.Errorf("DelegateResponse JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,70 @@
+package alexa
+
+import "strconv"
+
+// Entity resolution status codes.
+const (
+	ResolutionMatch   = "ER_SUCCESS_MATCH"
+	ResolutionNoMatch = "ER_SUCCESS_NO_MATCH"
+)
+
+// Slot is a filled (or empty) slot of an intent.
+type Slot struct {
+	Name               string       `json:"name"`
+	Value              string       `json:"value,omitempty"`
+	ConfirmationStatus string       `json:"confirmationStatus,omitempty"`
+	Resolutions        *Resolutions `json:"resolutions,omitempty"`
+}
+
+// Resolutions holds entity resolution results for custom slot types, which
+// map synonyms to the canonical value.
+type Resolutions struct {
+	ResolutionsPerAuthority []Resolution `json:"resolutionsPerAuthority"`
+}
+
+// Resolution is the result from one authority, usually the skill's own
+// slot type.
+type Resolution struct {
+	Authority string           `json:"authority"`
+	Status    ResolutionStatus `json:"status"`
+	Values    []ResolvedValue  `json:"values,omitempty"`
+}
+
+// ResolutionStatus reports whether the spoken value matched.
+type ResolutionStatus struct {
+	Code string `json:"code"`
+}
+
+// ResolvedValue wraps one canonical value.
+type ResolvedValue struct {
+	Value struct {
+		Name string `json:"name"`
+		ID   string `json:"id,omitempty"`
+	} `json:"value"`
+}
+
+// Resolved returns the canonical value of a slot if entity resolution
+// matched it, and the spoken value otherwise.
+func (s Slot) Resolved() string {
+	if s.Resolutions != nil {
+		for _, r := range s.Resolutions.ResolutionsPerAuthority {
+			if r.Status.Code == ResolutionMatch && len(r.Values) > 0 {
+				return r.Values[0].Value.Name
+			}
+		}
+	}
+	return s.Value
+}
+
+// Int returns the slot's value as an integer, as filled by AMAZON.NUMBER.
+// It returns false if the slot is empty or Alexa heard "?".
+func (s Slot) Int() (int, bool) {
+	n, err := strconv.Atoi(s.Value)
+	return n, err == nil
+}
+
+// slotValue returns the resolved value of a slot, or "" if it was not
+// filled.
+func slotValue(intent Intent, name string) string {
+	return intent.Slots[name].Resolved()
+}
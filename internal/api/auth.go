@@ -2,13 +2,26 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/nstielau/pool-controller/internal/atomicfile"
 )
 
+// authRealm is the realm advertised in WWW-Authenticate challenges.
+const authRealm = "pool-controller"
+
 // AuthMiddleware validates Bearer tokens against TOKEN_REGEX environment variable.
+//
+// This is the legacy scheme, used for GET /pool and GET /pool/ when
+// AUTH_LEGACY=true. It answers failures with 200 "Unauthed" as the original
+// Python service did.
 func AuthMiddleware(next http.Handler) http.Handler {
 	tokenRegex := os.Getenv("TOKEN_REGEX")
 	if tokenRegex == "" {
@@ -22,27 +35,112 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			authHeader = r.Header.Get("Authentication") // Legacy support
+		// Validate token against regex
+		if !pattern.MatchString(bearerToken(r)) {
+			w.WriteHeader(http.StatusOK) // Original Python returned 200 with "Unauthed"
+			w.Write([]byte("Unauthed"))
+			return
 		}
 
-		token := ""
-		if authHeader != "" {
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) == 2 {
-				token = parts[1]
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope authenticates requests against store and lets through only
+// tokens granting scope. Missing, unknown or expired tokens get 401; tokens
+// without the scope get 403.
+func RequireScope(store *TokenStore, scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerToken(r)
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := store.Authenticate(secret)
+		if err != nil {
+			desc := "invalid token"
+			if errors.Is(err, ErrTokenExpired) {
+				desc = "token expired"
 			}
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", authRealm, desc))
+			http.Error(w, desc, http.StatusUnauthorized)
+			return
 		}
 
-		// Validate token against regex
-		if !pattern.MatchString(token) {
-			w.WriteHeader(http.StatusOK) // Original Python returned 200 with "Unauthed"
-			w.Write([]byte("Unauthed"))
+		if !token.Allows(scope) {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf("Bearer realm=%q, error=\"insufficient_scope\", scope=%q", authRealm, scope))
+			http.Error(w, fmt.Sprintf("token lacks %q scope", scope), http.StatusForbidden)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// adminTokenFile holds the bootstrap admin token, next to API_TOKENS_FILE.
+const adminTokenFile = "admin-token"
+
+// bootstrapAdminToken creates an admin token in an empty store and writes
+// its secret to path with mode 0600. If the secret can't be written the
+// token is revoked again, so the next start tries afresh.
+func bootstrapAdminToken(store *TokenStore, path string, logger *log.Logger) {
+	secret, _, err := store.Create("admin", []Scope{ScopeAdmin}, 0)
+	if err != nil {
+		logger.Printf("Failed to create admin token: %v", err)
+		return
+	}
+
+	if err := atomicfile.WriteFile(path, []byte(secret+"\n"), 0o600); err != nil {
+		logger.Printf("Failed to save admin token: %v", err)
+		store.Revoke("admin")
+		return
+	}
+	logger.Printf("No API tokens configured; wrote an admin token to %s. Delete it once you have issued your own tokens.", path)
+}
+
+// bearerToken extracts the token from the Authorization header.
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		authHeader = r.Header.Get("Authentication") // Legacy support
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) == 2 {
+		return parts[1]
+	}
+	return ""
+}
+
+// newAuthenticator loads the token store guarding the API, configured from
+// the environment. Tokens are loaded from API_TOKENS_FILE (default
+// tokens.json). If the file is absent or empty an admin token is created so
+// the first real tokens can be issued. Its secret is written to admin-token
+// next to the token store, readable only by the service user, and never
+// logged: the journal is kept indefinitely.
+//
+// The store is used even with AUTH_LEGACY=true: legacy auth only covers the
+// original read routes, never the ones that change equipment.
+func newAuthenticator() *TokenStore {
+	logger := log.New(os.Stdout, "[auth] ", log.LstdFlags)
+
+	path := os.Getenv("API_TOKENS_FILE")
+	if path == "" {
+		path = "tokens.json"
+	}
+
+	store, err := LoadTokenStore(path)
+	if err != nil {
+		// Fail closed rather than overwrite a file we could not read
+		logger.Printf("Rejecting all API requests: %v", err)
+		return &TokenStore{}
+	}
+	if store.Len() == 0 {
+		bootstrapAdminToken(store, filepath.Join(filepath.Dir(path), adminTokenFile), logger)
+	}
+	return store
+}
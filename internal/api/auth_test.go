@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +119,44 @@ func TestAuthMiddlewareInvalidRegex(t *testing.T) {
 
 	os.Unsetenv("TOKEN_REGEX")
 }
+
+func TestRequireScope(t *testing.T) {
+	store, _ := LoadTokenStore("")
+	reader, _, _ := store.Create("reader", []Scope{ScopeRead}, 0)
+	controller, _, _ := store.Create("controller", []Scope{ScopeControl}, 0)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("success"))
+	})
+	handler := RequireScope(store, ScopeControl, nextHandler)
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantCode   int
+		wantHeader string
+	}{
+		{name: "no token", wantCode: http.StatusUnauthorized, wantHeader: `Bearer realm="pool-controller"`},
+		{name: "unknown token", authHeader: "Bearer nope", wantCode: http.StatusUnauthorized, wantHeader: "invalid_token"},
+		{name: "insufficient scope", authHeader: "Bearer " + reader, wantCode: http.StatusForbidden, wantHeader: "insufficient_scope"},
+		{name: "allowed", authHeader: "Bearer " + controller, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/pool/spa", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rr.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); !strings.Contains(got, tt.wantHeader) {
+				t.Errorf("WWW-Authenticate = %q, want it to contain %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// chlorinatorRequest is the body of a chlorinator output change. Omitted
+// outputs keep their current value.
+type chlorinatorRequest struct {
+	PoolOutput *int `json:"poolOutput"`
+	SpaOutput  *int `json:"spaOutput"`
+}
+
+// superChlorinateRequest is the body of a super-chlorinate command.
+type superChlorinateRequest struct {
+	Hours *int `json:"hours"`
+}
+
+// HandleChlorinator returns the salt chlorinator settings (GET /pool/chlorinator).
+func (h *PoolHandler) HandleChlorinator(w http.ResponseWriter, r *http.Request) {
+	h.bridge.Update()
+	h.writeChlorinator(w)
+}
+
+// HandleSetChlorinator changes the chlorinator output (PUT /pool/chlorinator).
+// Request body: {"poolOutput": 50, "spaOutput": 20}
+func (h *PoolHandler) HandleSetChlorinator(w http.ResponseWriter, r *http.Request) {
+	var req chlorinatorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.PoolOutput == nil && req.SpaOutput == nil) {
+		http.Error(w, "poolOutput or spaOutput required", http.StatusBadRequest)
+		return
+	}
+
+	current, ok := h.bridge.GetChlorinator()
+	if !ok {
+		http.Error(w, "no chlorinator installed", http.StatusNotFound)
+		return
+	}
+	poolOutput, spaOutput := current.PoolOutput, current.SpaOutput
+	if req.PoolOutput != nil {
+		poolOutput = *req.PoolOutput
+	}
+	if req.SpaOutput != nil {
+		spaOutput = *req.SpaOutput
+	}
+
+	if err := h.bridge.SetChlorinatorOutput(poolOutput, spaOutput); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	h.writeChlorinator(w)
+}
+
+// HandleSuperChlorinate starts or stops super-chlorination
+// (PUT /pool/chlorinator/super_chlorinate).
+// Request body: {"hours": 24}, or {"hours": 0} to stop.
+func (h *PoolHandler) HandleSuperChlorinate(w http.ResponseWriter, r *http.Request) {
+	var req superChlorinateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hours == nil {
+		http.Error(w, "hours required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.bridge.SuperChlorinate(*req.Hours); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	h.writeChlorinator(w)
+}
+
+// writeChlorinator responds with the current chlorinator settings.
+func (h *PoolHandler) writeChlorinator(w http.ResponseWriter) {
+	data, ok := h.bridge.GetChlorinator()
+	if !ok {
+		http.Error(w, "no chlorinator installed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
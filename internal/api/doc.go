@@ -5,14 +5,46 @@
 // The API provides the following endpoints:
 //
 //   - GET /        Health check, returns "hello"
+//   - GET /ui/     Web dashboard; static files, the page asks for a token
+//   - GET /metrics  Prometheus metrics for devices, gateway, HTTP and Alexa (requires auth)
 //   - GET /pool    Returns full pool status as JSON (requires auth)
+//   - GET /pool/events  Server-Sent Events stream of device changes (requires auth)
 //   - GET /pool/{attr}  Returns specific attribute (requires auth)
+//   - POST /pool/{attr} Turn a switch on/off/toggle, optionally for a duration (requires auth)
+//   - PUT /pool/body/{body}/set_point  Set heat set point for pool or spa (requires auth)
+//   - PUT /pool/body/{body}/heat_mode  Set heat mode for pool or spa (requires auth)
+//   - GET /pool/lights  Color lights and available modes (requires auth)
+//   - PUT /pool/lights  Send a light show/color command (requires auth)
+//   - GET /pool/chlorinator  Salt chlorinator settings (requires auth)
+//   - PUT /pool/chlorinator  Set chlorinator output for pool and spa (requires auth)
+//   - PUT /pool/chlorinator/super_chlorinate  Start or stop super-chlorination (requires auth)
+//   - GET /pool/pumps  Pump readings and per-circuit speeds (requires auth)
+//   - PUT /pool/pumps/{pump}/speed  Set a pump's speed for a circuit (requires auth)
+//   - GET /pool/history  Temperature and run log, ?from=&to= in RFC 3339 (requires auth)
+//   - GET /pool/series/{device}  Recorded states, ?from=&to=&resolution= (requires auth)
+//   - GET /pool/schedules  List controller schedules (requires auth)
+//   - POST /pool/schedules  Add a schedule (requires auth)
+//   - GET /pool/schedules/{id}  Returns one schedule (requires auth)
+//   - PUT /pool/schedules/{id}  Change a schedule (requires auth)
+//   - DELETE /pool/schedules/{id}  Remove a schedule (requires auth)
+//   - GET /auth/tokens  List API tokens (requires admin)
+//   - POST /auth/tokens Create an API token (requires admin)
+//   - DELETE /auth/tokens/{name}  Revoke an API token (requires admin)
 //   - POST /       Alexa skill endpoint (uses Alexa verification)
 //
 // # Authentication
 //
-// The /pool endpoints use Bearer token authentication. Tokens are validated
-// against the TOKEN_REGEX environment variable (default: ".*" accepts any token).
+// The /pool and /metrics endpoints use Bearer token authentication against
+// a TokenStore loaded from API_TOKENS_FILE (default: tokens.json). Tokens
+// carry the read, control or admin scope; GETs need read and changes need
+// control. Failures return 401 or 403 with a WWW-Authenticate header. With
+// an empty store, an admin token is created and its secret written to
+// admin-token (mode 0600) next to API_TOKENS_FILE.
+//
+// Setting AUTH_LEGACY=true restores the original scheme for GET /pool and
+// GET /pool/{attr}: tokens are matched against TOKEN_REGEX (default: ".*"
+// accepts any token) and failures return 200 "Unauthed". All other
+// endpoints still require a token from the store.
 //
 // Example request:
 //
@@ -0,0 +1,533 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/alexa"
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+	"github.com/nstielau/pool-controller/internal/pool"
+	"github.com/nstielau/pool-controller/internal/series"
+)
+
+// newSimRouter wires a Router, Bridge and Alexa handler to a gateway
+// simulator and returns the router with a control token.
+func newSimRouter(t *testing.T) (*Router, *gatewaysim.Server, string) {
+	t.Helper()
+
+	sim := gatewaysim.NewServer(gatewaysim.DefaultScenario())
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	dir := t.TempDir()
+	t.Setenv("TIMERS_FILE", filepath.Join(dir, "timers.json"))
+	t.Setenv("API_TOKENS_FILE", filepath.Join(dir, "tokens.json"))
+	t.Setenv("ALEXA_SKIP_VERIFY", "true")
+
+	bridge, err := pool.NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+
+	store, err := LoadTokenStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatalf("LoadTokenStore() error = %v", err)
+	}
+	token, _, err := store.Create("test", []Scope{ScopeControl}, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	return NewRouter(bridge, alexa.NewHandler(bridge)), sim, token
+}
+
+func TestEndToEndCircuitControl(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+
+	req := httptest.NewRequest("POST", "/pool/swim_jets", strings.NewReader(`{"state":"on","duration":"20m"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"remainingSeconds"`) {
+		t.Fatalf("POST /pool/swim_jets = %d %s", rr.Code, rr.Body.String())
+	}
+	for _, c := range sim.Scenario().Circuits {
+		if c.ID == gateway.CircuitSwimJets && c.State != 1 {
+			t.Error("simulated swim jets should be on")
+		}
+	}
+
+	// Sensors are read-only
+	req = httptest.NewRequest("POST", "/pool/air_temperature", strings.NewReader(`{"state":"on"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /pool/air_temperature = %d, want 405", rr.Code)
+	}
+}
+
+func TestEndToEndAlexa(t *testing.T) {
+	router, sim, _ := newSimRouter(t)
+
+	body := `{"version":"1.0","request":{"type":"IntentRequest","requestId":"r1","intent":{"name":"StartHotTubIntent"}}}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Alexa StartHotTubIntent = %d %s", rr.Code, rr.Body.String())
+	}
+	for _, c := range sim.Scenario().Circuits {
+		if c.ID == gateway.CircuitSpa && c.State != 1 {
+			t.Error("simulated spa should be on")
+		}
+	}
+}
+
+func TestEndToEndChlorinator(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("PUT", "/pool/chlorinator/super_chlorinate", `{"hours":24}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"superChlorinating":true`) {
+		t.Fatalf("PUT super_chlorinate = %d %s", rr.Code, rr.Body.String())
+	}
+	if scg := sim.Scenario().Chlorinator; !scg.SuperChlorinate || scg.SuperChlorHours != 24 {
+		t.Errorf("simulated chlorinator = %+v", scg)
+	}
+
+	// Only the pool output changes; super-chlorination keeps running
+	rr = send("PUT", "/pool/chlorinator", `{"poolOutput":70}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT /pool/chlorinator = %d %s", rr.Code, rr.Body.String())
+	}
+	if scg := sim.Scenario().Chlorinator; scg.PoolOutput != 70 || scg.SpaOutput != 20 || !scg.SuperChlorinate {
+		t.Errorf("simulated chlorinator = %+v", scg)
+	}
+
+	if rr = send("PUT", "/pool/chlorinator", `{"spaOutput":150}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("PUT /pool/chlorinator out of range = %d, want 400", rr.Code)
+	}
+	if rr = send("PUT", "/pool/chlorinator/super_chlorinate", `{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("PUT super_chlorinate without hours = %d, want 400", rr.Code)
+	}
+}
+
+func TestEndToEndPumpSpeed(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+
+	req := httptest.NewRequest("PUT", "/pool/pumps/1/speed", strings.NewReader(`{"circuit":"cleaner","speed":2600}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"circuit":"cleaner","circuitId":501,"speed":2600`) {
+		t.Fatalf("PUT /pool/pumps/1/speed = %d %s", rr.Code, rr.Body.String())
+	}
+	for _, p := range sim.Scenario().Pumps[0].Presets {
+		if p.Circuit == gateway.CircuitCleaner && p.Speed != 2600 {
+			t.Errorf("simulated cleaner speed = %d, want 2600", p.Speed)
+		}
+	}
+
+	for _, tt := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/pool/pumps/2/speed", `{"circuit":"cleaner","speed":2600}`, http.StatusNotFound},
+		{"/pool/pumps/1/speed", `{"circuit":"cleaner","speed":9000}`, http.StatusBadRequest},
+		{"/pool/pumps/1/speed", `{"circuit":"pool_light","speed":2600}`, http.StatusNotFound},
+		{"/pool/pumps/1/speed", `{"circuit":"cleaner"}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("PUT", tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("PUT %s %s = %d, want %d", tt.path, tt.body, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestEndToEndSchedules(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/pool/schedules", `{"circuit":"cleaner","days":["mon","fri"],"start":"09:00","stop":"11:00"}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"id":701,"type":"recurring","circuit":"cleaner"`) {
+		t.Fatalf("POST /pool/schedules = %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = do("PUT", "/pool/schedules/701", `{"stop":"12:30"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"days":["mon","fri"],"start":"09:00","stop":"12:30"`) {
+		t.Fatalf("PUT /pool/schedules/701 = %d %s", rr.Code, rr.Body.String())
+	}
+	if e := sim.Scenario().Schedules[1]; e.Circuit != gateway.CircuitCleaner || e.Stop != 12*60+30 || e.DayMask != 0x11 {
+		t.Errorf("simulated schedule = %+v", e)
+	}
+
+	rr = do("GET", "/pool/schedules", "")
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"id":`) != 2 {
+		t.Errorf("GET /pool/schedules = %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/pool/schedules", `{"circuit":"cleaner","days":["someday"],"start":"09:00","stop":"11:00"}`, http.StatusBadRequest},
+		{"POST", "/pool/schedules", `{"circuit":"cleaner","days":["mon"],"start":"25:00","stop":"11:00"}`, http.StatusBadRequest},
+		{"POST", "/pool/schedules", `{"circuit":"hot_tub","days":["mon"],"start":"09:00","stop":"11:00"}`, http.StatusBadRequest},
+		{"PUT", "/pool/schedules/701", `{"type":"runOnce"}`, http.StatusBadRequest},
+		{"GET", "/pool/schedules/999", "", http.StatusNotFound},
+		{"GET", "/pool/schedules/abc", "", http.StatusNotFound},
+		{"PUT", "/pool/schedules/999", `{"stop":"12:00"}`, http.StatusNotFound},
+		{"DELETE", "/pool/schedules/701", "", http.StatusNoContent},
+		{"DELETE", "/pool/schedules/701", "", http.StatusNotFound},
+	} {
+		if rr := do(tt.method, tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("%s %s %s = %d, want %d (%s)", tt.method, tt.path, tt.body, rr.Code, tt.want, rr.Body.String())
+		}
+	}
+}
+
+func TestEndToEndHistory(t *testing.T) {
+	router, _, token := newSimRouter(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := httptest.NewRequest("POST", "/pool/spa", strings.NewReader(`{"state":"on"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := get("/pool/history")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /pool/history = %d %s", rr.Code, rr.Body.String())
+	}
+	var history pool.History
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("history JSON: %v", err)
+	}
+	if n := len(history.PoolTemperature); n < 48 || n > 49 || history.Unit != "°F" {
+		t.Errorf("history has %d pool samples in %s", n, history.Unit)
+	}
+	if runs := history.Runs["spa"]; len(runs) != 1 || runs[0].Off != nil {
+		t.Errorf("spa runs = %+v, want one still running", runs)
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-2 * time.Hour)
+	rr = get("/pool/history?from=" + from.Format(time.RFC3339) + "&to=" + to.Format(time.RFC3339))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"from":"`+from.Format(time.RFC3339)) {
+		t.Errorf("GET /pool/history with range = %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, path := range []string{
+		"/pool/history?from=yesterday",
+		"/pool/history?to=2024-13-01T00:00:00Z",
+		"/pool/history?from=" + to.Format(time.RFC3339) + "&to=" + from.Format(time.RFC3339),
+	} {
+		if rr := get(path); rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, rr.Code)
+		}
+	}
+}
+
+func TestEndToEndSeries(t *testing.T) {
+	t.Setenv("SERIES_DIR", t.TempDir())
+	router, _, token := newSimRouter(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Turning the spa on refreshes the status, which records a snapshot
+	req := httptest.NewRequest("POST", "/pool/spa", strings.NewReader(`{"state":"on"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := get("/pool/series/spa")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /pool/series/spa = %d %s", rr.Code, rr.Body.String())
+	}
+	var got struct {
+		Device     string         `json:"device"`
+		Resolution string         `json:"resolution"`
+		Points     []series.Point `json:"points"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("series JSON: %v", err)
+	}
+	if got.Device != "spa" || got.Resolution != "raw" || len(got.Points) == 0 || got.Points[len(got.Points)-1].Value != 1 {
+		t.Errorf("GET /pool/series/spa = %+v", got)
+	}
+
+	// A week picks hourly points; none are finished yet
+	to := time.Now().UTC()
+	from := to.Add(-7 * 24 * time.Hour)
+	rr = get("/pool/series/spa?from=" + from.Format(time.RFC3339) + "&to=" + to.Format(time.RFC3339))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"points":[],"resolution":"hourly"`) {
+		t.Errorf("GET /pool/series/spa for a week = %d %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/pool/series/spa?resolution=daily", http.StatusOK},
+		{"/pool/series/spa?resolution=weekly", http.StatusBadRequest},
+		{"/pool/series/spa?from=yesterday", http.StatusBadRequest},
+		{"/pool/series/hot_tub", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rr := get(tt.path); rr.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestEndToEndMetrics(t *testing.T) {
+	router, _, token := newSimRouter(t)
+
+	body := `{"version":"1.0","request":{"type":"IntentRequest","requestId":"r1","intent":{"name":"HotTubTempIntent"}}}`
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)))
+
+	req := httptest.NewRequest("GET", "/pool/spa", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("GET /metrics = %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`pool_device_value{device="current_spa_temperature",name="Current Spa Temperature",type="sensor",unit="°F"} 99`,
+		`pool_device_value{device="spa",name="Spa",type="switch",unit=""} 0`,
+		`pool_device_value{device="ph",name="pH",type="sensor",unit=""}`,
+		`pool_device_value{device="salt_ppm",name="Salt",type="sensor",unit="ppm"}`,
+		`pool_gateway_connected 1`,
+		`pool_last_update_age_seconds `,
+		`pool_gateway_connect_seconds_count `,
+		`pool_gateway_login_seconds_count `,
+		`pool_gateway_queries_total{code="12526"} `,
+		`pool_http_requests_total{route="GET /pool/",code="200"} `,
+		`pool_http_request_duration_seconds_count{route="POST /"} `,
+		`pool_alexa_intents_total{intent="HotTubTempIntent"} `,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("GET /metrics is missing %q", want)
+		}
+	}
+	if strings.Contains(rr.Body.String(), `device="pool_heat_mode"`) {
+		t.Error("text devices should not be exported")
+	}
+
+	// Scraping needs a token like the rest of the API
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("GET /metrics without a token = %d, want 401", rr.Code)
+	}
+}
+
+// sseEvent is one event read from a stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvents parses an SSE stream onto a channel, skipping comments.
+func readEvents(body *bufio.Reader) <-chan sseEvent {
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var ev sseEvent
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				if ev.event != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				events <- sseEvent{event: "comment"}
+			default:
+				field, value, _ := strings.Cut(line, ": ")
+				switch field {
+				case "id":
+					ev.id = value
+				case "event":
+					ev.event = value
+				case "data":
+					ev.data = value
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func TestEndToEndEvents(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	open := func(ctx context.Context, lastID string) (*http.Response, <-chan sseEvent) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/pool/events", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /pool/events error = %v", err)
+		}
+		return resp, readEvents(bufio.NewReader(resp.Body))
+	}
+	next := func(events <-chan sseEvent, skipComments bool) sseEvent {
+		t.Helper()
+		for {
+			select {
+			case ev := <-events:
+				if skipComments && ev.event == "comment" {
+					continue
+				}
+				return ev
+			case <-time.After(3 * time.Second):
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+	setSpa := func(state int) {
+		sim.Update(func(sc *gatewaysim.Scenario) {
+			for i := range sc.Circuits {
+				if sc.Circuits[i].ID == gateway.CircuitSpa {
+					sc.Circuits[i].State = state
+				}
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, events := open(ctx, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /pool/events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if ev := next(events, true); ev.event != "snapshot" || !strings.Contains(ev.data, `"spa":{`) {
+		t.Fatalf("first event = %+v, want a snapshot", ev)
+	}
+
+	// A change at the panel arrives as a push and is streamed
+	setSpa(1)
+	var change pool.Event
+	for change.Device != "spa" {
+		ev := next(events, true)
+		if ev.event != "change" || ev.id == "" {
+			t.Fatalf("event = %+v, want a change", ev)
+		}
+		json.Unmarshal([]byte(ev.data), &change)
+	}
+	if change.State != 1.0 || change.PreviousState != 0.0 || change.FriendlyState != "On" {
+		t.Errorf("spa change = %+v", change)
+	}
+	cancel()
+	resp.Body.Close()
+
+	// Reconnecting with Last-Event-ID replays what was missed, not a snapshot
+	setSpa(0)
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	resp, events = open(ctx, strconv.FormatUint(change.ID, 10))
+	defer resp.Body.Close()
+	ev := next(events, true)
+	json.Unmarshal([]byte(ev.data), &change)
+	if ev.event != "change" || change.Device != "spa" || change.State != 0.0 {
+		t.Errorf("first event after resume = %+v", ev)
+	}
+
+	// Streams need a token like the rest of the API
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/pool/events", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("GET /pool/events without a token = %d, want 401", rr.Code)
+	}
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	defer func(d time.Duration) { heartbeatInterval = d }(heartbeatInterval)
+	heartbeatInterval = 10 * time.Millisecond
+
+	router, _, token := newSimRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/pool/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /pool/events error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	events := readEvents(bufio.NewReader(resp.Body))
+	for _, want := range []string{"snapshot", "comment"} {
+		select {
+		case ev := <-events:
+			if ev.event != want {
+				t.Fatalf("event = %+v, want %s", ev, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
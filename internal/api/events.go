@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// Event stream timing. heartbeatInterval is a variable so tests can
+// shorten it.
+var heartbeatInterval = 15 * time.Second
+
+const eventRetry = 3 * time.Second // reconnect delay suggested to clients
+
+// HandleEvents streams device changes as Server-Sent Events
+// (GET /pool/events).
+//
+// A new stream starts with a "snapshot" event holding the same JSON as
+// GET /pool, then sends a "change" event (id: event ID, data: pool.Event)
+// for every device that changes. Clients that reconnect with Last-Event-ID
+// get the changes they missed instead of a snapshot, as long as they are
+// still buffered. Idle streams get a comment every heartbeatInterval.
+func (h *PoolHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub, missed, resumed := h.bridge.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // don't let nginx buffer the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds())
+
+	if !resumed {
+		// Refresh data if needed
+		h.bridge.Update()
+
+		snapshot, err := h.bridge.GetJSON()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", snapshot)
+	}
+	for _, ev := range missed {
+		writeEvent(w, ev)
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// Fell behind; the client reconnects and resumes
+				return
+			}
+			writeEvent(w, ev)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes ev as an SSE "change" event.
+func writeEvent(w http.ResponseWriter, ev pool.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", ev.ID, data)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// setPointRequest is the body of a set point change.
+type setPointRequest struct {
+	Temperature *int `json:"temperature"`
+}
+
+// heatModeRequest is the body of a heat mode change.
+type heatModeRequest struct {
+	Mode string `json:"mode"`
+}
+
+// HandleSetPoint changes a body's heat set point (PUT /pool/body/{body}/set_point).
+// Request body: {"temperature": 104}
+func (h *PoolHandler) HandleSetPoint(w http.ResponseWriter, r *http.Request) {
+	body, ok := bodyIndex(r.PathValue("body"))
+	if !ok {
+		http.Error(w, "unknown body", http.StatusNotFound)
+		return
+	}
+
+	var req setPointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Temperature == nil {
+		http.Error(w, "temperature required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.bridge.SetHeatSetPoint(body, *req.Temperature); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	h.writeBody(w, body)
+}
+
+// HandleHeatMode changes a body's heat mode (PUT /pool/body/{body}/heat_mode).
+// Request body: {"mode": "heat"}
+func (h *PoolHandler) HandleHeatMode(w http.ResponseWriter, r *http.Request) {
+	body, ok := bodyIndex(r.PathValue("body"))
+	if !ok {
+		http.Error(w, "unknown body", http.StatusNotFound)
+		return
+	}
+
+	var req heatModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Mode == "" {
+		http.Error(w, "mode required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.bridge.SetHeatMode(body, req.Mode); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	h.writeBody(w, body)
+}
+
+// writeBody responds with the current state of a body.
+func (h *PoolHandler) writeBody(w http.ResponseWriter, body int) {
+	data, ok := h.bridge.GetBody(body)
+	if !ok {
+		http.Error(w, "unknown body", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// bodyIndex maps a body name from the URL ("pool" or "spa") to its index.
+func bodyIndex(name string) (int, bool) {
+	switch strings.ToLower(name) {
+	case "pool", "0":
+		return 0, true
+	case "spa", "1":
+		return 1, true
+	}
+	return 0, false
+}
+
+// writeBridgeError maps a Bridge control error to an HTTP status.
+func writeBridgeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pool.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, pool.ErrInvalidValue):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// defaultHistoryRange is how far back GET /pool/history goes without from.
+const defaultHistoryRange = 24 * time.Hour
+
+// HandleHistory returns the controller's temperature and run log
+// (GET /pool/history?from=&to=). Both are RFC 3339 times; to defaults to
+// now and from to a day before to.
+func (h *PoolHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r, defaultHistoryRange)
+	if !ok {
+		return
+	}
+
+	history, err := h.bridge.GetHistory(from, to)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// parseTimeRange reads the RFC 3339 from and to query parameters. to
+// defaults to now and from to def before to. It writes a 400 and returns
+// false if either is malformed.
+func parseTimeRange(w http.ResponseWriter, r *http.Request, def time.Duration) (time.Time, time.Time, bool) {
+	to := time.Now()
+	if s := r.URL.Query().Get("to"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "invalid to, want RFC 3339 (2006-01-02T15:04:05Z07:00)", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	from := to.Add(-def)
+	if s := r.URL.Query().Get("from"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "invalid from, want RFC 3339 (2006-01-02T15:04:05Z07:00)", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+
+	return from, to, true
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// lightModeRequest is the body of a light command.
+type lightModeRequest struct {
+	Mode string `json:"mode"`
+}
+
+// HandleLights returns the color lights and the modes they accept (GET /pool/lights).
+func (h *PoolHandler) HandleLights(w http.ResponseWriter, r *http.Request) {
+	h.bridge.Update()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.bridge.GetLights())
+}
+
+// HandleSetLightMode sends a light command to the color lights (PUT /pool/lights).
+// Request body: {"mode": "caribbean"}
+func (h *PoolHandler) HandleSetLightMode(w http.ResponseWriter, r *http.Request) {
+	var req lightModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Mode == "" {
+		http.Error(w, "mode required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.bridge.SetLightMode(req.Mode); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.bridge.GetLights())
+}
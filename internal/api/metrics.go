@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/metrics"
+)
+
+// HTTP metrics, labelled by the mux pattern that served the request.
+var (
+	httpRequests = metrics.NewCounter("pool_http_requests_total",
+		"HTTP requests, by route and status code.", "route", "code")
+	httpSeconds = metrics.NewHistogram("pool_http_request_duration_seconds",
+		"HTTP request latency, by route.", metrics.DefBuckets, "route")
+)
+
+// streamRoutes stay open for as long as the client listens, so their
+// duration says nothing about latency.
+var streamRoutes = map[string]bool{"GET /pool/events": true}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// instrument counts and times requests served by mux.
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		mux.ServeHTTP(rec, req)
+
+		// The mux records the matched pattern on the request
+		route := req.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(route, strconv.Itoa(rec.code))
+		if !streamRoutes[route] {
+			httpSeconds.Observe(time.Since(start).Seconds(), route)
+		}
+	})
+}
+
+// HandleMetrics serves gateway, HTTP and Alexa metrics and every device's
+// state in the Prometheus text format (GET /metrics).
+func (h *PoolHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	// Refresh data if needed
+	h.bridge.Update()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := metrics.NewWriter(w)
+	metrics.Default.Write(mw)
+	h.bridge.WriteMetrics(mw)
+}
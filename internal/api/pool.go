@@ -2,7 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/nstielau/pool-controller/internal/pool"
 )
@@ -62,3 +66,79 @@ func (h *PoolHandler) HandlePoolAttribute(w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
+
+// controlRequest is the body of a circuit change.
+type controlRequest struct {
+	State    string `json:"state"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// HandleSetPoolAttribute changes a switch or light (POST/PUT /pool/{attribute}).
+// Request body: {"state": "on"|"off"|"toggle", "duration": "30m"}
+// The optional duration turns the circuit back off after that long. It is
+// rejected with "off", or with a toggle that turns the circuit off.
+func (h *PoolHandler) HandleSetPoolAttribute(w http.ResponseWriter, r *http.Request) {
+	attribute := r.PathValue("attr")
+
+	var req controlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	action, duration, err := parseControlRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	circuitID, err := h.bridge.CircuitForDevice(attribute)
+	if errors.Is(err, pool.ErrReadOnly) {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	switch action {
+	case "toggle":
+		_, err = h.bridge.ToggleCircuit(circuitID, duration)
+	case "on":
+		_, err = h.bridge.SetCircuitFor(circuitID, 1, duration)
+	default:
+		_, err = h.bridge.SetCircuitFor(circuitID, 0, 0)
+	}
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	data, _ := h.bridge.GetAttribute(attribute)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// parseControlRequest validates a circuit change, returning the action
+// ("on", "off" or "toggle") and the optional auto-off duration.
+func parseControlRequest(req controlRequest) (string, time.Duration, error) {
+	action := strings.ToLower(req.State)
+	switch action {
+	case "on", "off", "toggle":
+	default:
+		return "", 0, fmt.Errorf("state must be on, off or toggle")
+	}
+
+	if req.Duration == "" {
+		return action, 0, nil
+	}
+	if action == "off" {
+		return "", 0, fmt.Errorf("duration only applies when turning on")
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		return "", 0, fmt.Errorf("invalid duration %q", req.Duration)
+	}
+	return action, duration, nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+func TestParseControlRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          controlRequest
+		wantAction   string
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{name: "on", req: controlRequest{State: "on"}, wantAction: "on"},
+		{name: "case insensitive", req: controlRequest{State: "OFF"}, wantAction: "off"},
+		{name: "toggle for", req: controlRequest{State: "toggle", Duration: "30m"}, wantAction: "toggle", wantDuration: 30 * time.Minute},
+		{name: "unknown state", req: controlRequest{State: "dim"}, wantErr: true},
+		{name: "missing state", req: controlRequest{}, wantErr: true},
+		{name: "off for", req: controlRequest{State: "off", Duration: "30m"}, wantErr: true},
+		{name: "bad duration", req: controlRequest{State: "on", Duration: "soon"}, wantErr: true},
+		{name: "negative duration", req: controlRequest{State: "on", Duration: "-5m"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, duration, err := parseControlRequest(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseControlRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if action != tt.wantAction || duration != tt.wantDuration {
+				t.Errorf("parseControlRequest() = %q, %v, want %q, %v", action, duration, tt.wantAction, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestHandleSetPoolAttribute(t *testing.T) {
+	router, sim, token := newSimRouter(t)
+
+	jetsState := func() int {
+		for _, c := range sim.Scenario().Circuits {
+			if c.ID == gateway.CircuitSwimJets {
+				return c.State
+			}
+		}
+		return -1
+	}
+
+	// Steps run in order against the same simulator
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		wantCode  int
+		wantState int // swim jets afterwards
+	}{
+		{"on", "POST", "/pool/swim_jets", `{"state":"on"}`, http.StatusOK, 1},
+		{"toggle off", "PUT", "/pool/swim_jets", `{"state":"toggle"}`, http.StatusOK, 0},
+		{"toggle on", "POST", "/pool/swim_jets", `{"state":"toggle","duration":"10m"}`, http.StatusOK, 1},
+		{"toggle off for", "POST", "/pool/swim_jets", `{"state":"toggle","duration":"10m"}`, http.StatusBadRequest, 1},
+		{"off", "POST", "/pool/swim_jets", `{"state":"off"}`, http.StatusOK, 0},
+		{"off for", "POST", "/pool/swim_jets", `{"state":"off","duration":"10m"}`, http.StatusBadRequest, 0},
+		{"bad state", "POST", "/pool/swim_jets", `{"state":"dim"}`, http.StatusBadRequest, 0},
+		{"bad body", "POST", "/pool/swim_jets", `on`, http.StatusBadRequest, 0},
+		{"sensor", "POST", "/pool/air_temperature", `{"state":"on"}`, http.StatusMethodNotAllowed, 0},
+		{"unknown device", "POST", "/pool/hot_dog_stand", `{"state":"on"}`, http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: %s %s %s = %d %s, want %d", tt.name, tt.method, tt.path, tt.body, rr.Code, rr.Body.String(), tt.wantCode)
+		}
+		if got := jetsState(); got != tt.wantState {
+			t.Errorf("%s: simulated swim jets = %d, want %d", tt.name, got, tt.wantState)
+		}
+	}
+}
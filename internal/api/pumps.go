@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// pumpSpeedRequest is the body of a pump speed change.
+type pumpSpeedRequest struct {
+	Circuit string `json:"circuit"`
+	Speed   *int   `json:"speed"`
+}
+
+// HandlePumps returns the pumps with their readings and speed settings (GET /pool/pumps).
+func (h *PoolHandler) HandlePumps(w http.ResponseWriter, r *http.Request) {
+	h.bridge.Update()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.bridge.GetPumps())
+}
+
+// HandleSetPumpSpeed changes the speed a pump runs at for a circuit
+// (PUT /pool/pumps/{pump}/speed, pumps numbered from 1).
+// Request body: {"circuit": "cleaner", "speed": 2400}
+func (h *PoolHandler) HandleSetPumpSpeed(w http.ResponseWriter, r *http.Request) {
+	pump, err := strconv.Atoi(r.PathValue("pump"))
+	if err != nil || pump < 1 || pump > gateway.MaxPumps {
+		http.Error(w, "unknown pump", http.StatusNotFound)
+		return
+	}
+
+	var req pumpSpeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Circuit == "" || req.Speed == nil {
+		http.Error(w, "circuit and speed required", http.StatusBadRequest)
+		return
+	}
+
+	circuitID, err := h.bridge.CircuitForDevice(req.Circuit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.bridge.SetPumpSpeed(pump-1, circuitID, *req.Speed); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.bridge.GetPumps()["pump_"+strconv.Itoa(pump)])
+}
@@ -2,29 +2,52 @@ package api
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/nstielau/pool-controller/internal/pool"
+	"github.com/nstielau/pool-controller/internal/ui"
 )
 
 // Router sets up the HTTP routes for the pool controller.
 type Router struct {
 	mux          *http.ServeMux
+	handler      http.Handler // mux with request metrics
 	poolHandler  *PoolHandler
 	alexaHandler http.Handler
+	tokens       *TokenStore
+	legacyAuth   bool // AUTH_LEGACY=true
 }
 
 // NewRouter creates a new Router with all routes configured.
+// Authentication is configured from the environment; see newAuthenticator.
 func NewRouter(bridge *pool.Bridge, alexaHandler http.Handler) *Router {
 	r := &Router{
 		mux:          http.NewServeMux(),
 		poolHandler:  NewPoolHandler(bridge),
 		alexaHandler: alexaHandler,
+		tokens:       newAuthenticator(),
+		legacyAuth:   os.Getenv("AUTH_LEGACY") == "true",
 	}
 
 	r.setupRoutes()
+	r.handler = instrument(r.mux)
 	return r
 }
 
+// require wraps handler so it is only served to tokens granting scope.
+func (r *Router) require(scope Scope, handler http.HandlerFunc) http.Handler {
+	return RequireScope(r.tokens, scope, handler)
+}
+
+// requireLegacy is require for the read routes that predate scoped tokens.
+// With AUTH_LEGACY=true they accept any token matching TOKEN_REGEX instead.
+func (r *Router) requireLegacy(scope Scope, handler http.HandlerFunc) http.Handler {
+	if r.legacyAuth {
+		return AuthMiddleware(handler)
+	}
+	return r.require(scope, handler)
+}
+
 // setupRoutes configures all HTTP routes.
 func (r *Router) setupRoutes() {
 	// Health check (no auth)
@@ -35,21 +58,82 @@ func (r *Router) setupRoutes() {
 		r.mux.Handle("POST /", r.alexaHandler)
 	}
 
+	// Web dashboard (static files, no auth - the page asks for a token)
+	r.mux.Handle("GET /ui/", http.StripPrefix("/ui", ui.Handler()))
+
+	// Prometheus metrics
+	r.mux.Handle("GET /metrics", r.require(ScopeRead, r.poolHandler.HandleMetrics))
+
 	// Pool endpoints with authentication
-	authPool := AuthMiddleware(http.HandlerFunc(r.poolHandler.HandlePool))
-	r.mux.Handle("GET /pool", authPool)
+	r.mux.Handle("GET /pool", r.requireLegacy(ScopeRead, r.poolHandler.HandlePool))
+
+	// Live device changes (Server-Sent Events)
+	r.mux.Handle("GET /pool/events", r.require(ScopeRead, r.poolHandler.HandleEvents))
 
 	// Pool attribute endpoint
-	authPoolAttr := AuthMiddleware(http.HandlerFunc(r.poolHandler.HandlePoolAttribute))
-	r.mux.Handle("GET /pool/", authPoolAttr)
+	r.mux.Handle("GET /pool/", r.requireLegacy(ScopeRead, r.poolHandler.HandlePoolAttribute))
+
+	// Circuit control
+	setPoolAttr := r.require(ScopeControl, r.poolHandler.HandleSetPoolAttribute)
+	r.mux.Handle("POST /pool/{attr}", setPoolAttr)
+	r.mux.Handle("PUT /pool/{attr}", setPoolAttr)
+
+	// Heat control
+	setPoint := r.require(ScopeControl, r.poolHandler.HandleSetPoint)
+	r.mux.Handle("PUT /pool/body/{body}/set_point", setPoint)
+	r.mux.Handle("POST /pool/body/{body}/set_point", setPoint)
+
+	heatMode := r.require(ScopeControl, r.poolHandler.HandleHeatMode)
+	r.mux.Handle("PUT /pool/body/{body}/heat_mode", heatMode)
+	r.mux.Handle("POST /pool/body/{body}/heat_mode", heatMode)
+
+	// Color lights
+	r.mux.Handle("GET /pool/lights", r.require(ScopeRead, r.poolHandler.HandleLights))
+	lightMode := r.require(ScopeControl, r.poolHandler.HandleSetLightMode)
+	r.mux.Handle("PUT /pool/lights", lightMode)
+	r.mux.Handle("POST /pool/lights", lightMode)
+
+	// Salt chlorinator
+	r.mux.Handle("GET /pool/chlorinator", r.require(ScopeRead, r.poolHandler.HandleChlorinator))
+	setChlorinator := r.require(ScopeControl, r.poolHandler.HandleSetChlorinator)
+	r.mux.Handle("PUT /pool/chlorinator", setChlorinator)
+	r.mux.Handle("POST /pool/chlorinator", setChlorinator)
+	superChlorinate := r.require(ScopeControl, r.poolHandler.HandleSuperChlorinate)
+	r.mux.Handle("PUT /pool/chlorinator/super_chlorinate", superChlorinate)
+	r.mux.Handle("POST /pool/chlorinator/super_chlorinate", superChlorinate)
+
+	// Pumps
+	r.mux.Handle("GET /pool/pumps", r.require(ScopeRead, r.poolHandler.HandlePumps))
+	pumpSpeed := r.require(ScopeControl, r.poolHandler.HandleSetPumpSpeed)
+	r.mux.Handle("PUT /pool/pumps/{pump}/speed", pumpSpeed)
+	r.mux.Handle("POST /pool/pumps/{pump}/speed", pumpSpeed)
+
+	// Controller history
+	r.mux.Handle("GET /pool/history", r.require(ScopeRead, r.poolHandler.HandleHistory))
+
+	// Recorded series
+	r.mux.Handle("GET /pool/series/{device}", r.require(ScopeRead, r.poolHandler.HandleSeries))
+
+	// Controller schedules
+	r.mux.Handle("GET /pool/schedules", r.require(ScopeRead, r.poolHandler.HandleSchedules))
+	r.mux.Handle("POST /pool/schedules", r.require(ScopeControl, r.poolHandler.HandleCreateSchedule))
+	r.mux.Handle("GET /pool/schedules/{id}", r.require(ScopeRead, r.poolHandler.HandleSchedule))
+	r.mux.Handle("PUT /pool/schedules/{id}", r.require(ScopeControl, r.poolHandler.HandleUpdateSchedule))
+	r.mux.Handle("DELETE /pool/schedules/{id}", r.require(ScopeControl, r.poolHandler.HandleDeleteSchedule))
+
+	// Token management
+	tokenHandler := NewTokenHandler(r.tokens)
+	r.mux.Handle("GET /auth/tokens", r.require(ScopeAdmin, tokenHandler.HandleList))
+	r.mux.Handle("POST /auth/tokens", r.require(ScopeAdmin, tokenHandler.HandleCreate))
+	r.mux.Handle("DELETE /auth/tokens/{name}", r.require(ScopeAdmin, tokenHandler.HandleRevoke))
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.mux.ServeHTTP(w, req)
+	r.handler.ServeHTTP(w, req)
 }
 
 // Handler returns the HTTP handler for the router.
 func (r *Router) Handler() http.Handler {
-	return r.mux
+	return r.handler
 }
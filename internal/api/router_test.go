@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRouterHealthCheck(t *testing.T) {
+	t.Setenv("API_TOKENS_FILE", filepath.Join(t.TempDir(), "tokens.json"))
+
+	// Registering every route must not panic on conflicting patterns
+	router := NewRouter(nil, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "hello" {
+		t.Errorf("GET / = %d %q, want 200 hello", rr.Code, rr.Body.String())
+	}
+}
+
+func TestNewRouterDashboard(t *testing.T) {
+	t.Setenv("API_TOKENS_FILE", filepath.Join(t.TempDir(), "tokens.json"))
+	router := NewRouter(nil, nil)
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{"/ui/", http.StatusOK, "text/html", `<script src="app.js">`},
+		{"/ui/app.js", http.StatusOK, "text/javascript", "/pool/events"},
+		{"/ui/style.css", http.StatusOK, "text/css", "prefers-color-scheme"},
+		{"/ui", http.StatusTemporaryRedirect, "", ""},
+		{"/ui/missing.js", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		// The files are public; the page asks for a token itself
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+		if rr.Code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.path, rr.Code, tt.code)
+			continue
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), tt.contentType) || !strings.Contains(rr.Body.String(), tt.contains) {
+			t.Errorf("GET %s = %s, missing %q", tt.path, rr.Header().Get("Content-Type"), tt.contains)
+		}
+	}
+}
+
+func TestNewRouterBootstrapsAdminToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	t.Setenv("API_TOKENS_FILE", path)
+
+	NewRouter(nil, nil)
+
+	store, err := LoadTokenStore(path)
+	if err != nil {
+		t.Fatalf("LoadTokenStore() error = %v", err)
+	}
+	tokens := store.List()
+	if len(tokens) != 1 || !tokens[0].Allows(ScopeAdmin) {
+		t.Errorf("bootstrap tokens = %+v, want one admin token", tokens)
+	}
+
+	// The secret is in a private file, not the log
+	secretPath := filepath.Join(filepath.Dir(path), adminTokenFile)
+	info, err := os.Stat(secretPath)
+	if err != nil {
+		t.Fatalf("admin token file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("admin token file mode = %v, want 0600", perm)
+	}
+	secret, _ := os.ReadFile(secretPath)
+	if _, err := store.Authenticate(strings.TrimSpace(string(secret))); err != nil {
+		t.Errorf("Authenticate(saved secret) error = %v", err)
+	}
+}
+
+func TestTokenEndpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	t.Setenv("API_TOKENS_FILE", path)
+
+	store, _ := LoadTokenStore(path)
+	admin, _, _ := store.Create("admin", []Scope{ScopeAdmin}, 0)
+	router := NewRouter(nil, nil)
+
+	req := httptest.NewRequest("POST", "/auth/tokens", strings.NewReader(`{"name":"ha","scopes":["read"],"expiresIn":"24h"}`))
+	req.Header.Set("Authorization", "Bearer "+admin)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"token":"pc_`) {
+		t.Fatalf("POST /auth/tokens = %d %s", rr.Code, rr.Body.String())
+	}
+
+	// The new read-only token may not manage tokens
+	var created struct{ Token string }
+	json.NewDecoder(rr.Body).Decode(&created)
+	req = httptest.NewRequest("GET", "/auth/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("GET /auth/tokens with read token = %d, want 403", rr.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/auth/tokens/ha", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE /auth/tokens/ha = %d, want 204", rr.Code)
+	}
+}
+
+func TestNewRouterLegacyAuth(t *testing.T) {
+	t.Setenv("API_TOKENS_FILE", filepath.Join(t.TempDir(), "tokens.json"))
+	t.Setenv("AUTH_LEGACY", "true")
+	t.Setenv("TOKEN_REGEX", "^secret$")
+
+	router := NewRouter(nil, nil)
+
+	req := httptest.NewRequest("GET", "/pool/spa", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "Unauthed" {
+		t.Errorf("legacy GET /pool/spa = %d %q, want 200 Unauthed", rr.Code, rr.Body.String())
+	}
+
+	// Control routes ignore TOKEN_REGEX, even one that matches anything
+	t.Setenv("TOKEN_REGEX", ".*")
+	router = NewRouter(nil, nil)
+	tests := []struct{ method, path string }{
+		{"POST", "/pool/spa"},
+		{"PUT", "/pool/body/spa/set_point"},
+		{"PUT", "/pool/chlorinator"},
+		{"PUT", "/pool/pumps/0/speed"},
+		{"POST", "/pool/schedules"},
+		{"DELETE", "/pool/schedules/1"},
+		{"GET", "/auth/tokens"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"state":"on"}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("legacy %s %s without token = %d, want 401", tt.method, tt.path, rr.Code)
+		}
+	}
+}
+
+func TestBodyIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   int
+		wantOK bool
+	}{
+		{name: "pool", want: 0, wantOK: true},
+		{name: "Spa", want: 1, wantOK: true},
+		{name: "1", want: 1, wantOK: true},
+		{name: "lake", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := bodyIndex(tt.name)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("bodyIndex(%q) = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// HandleSchedules lists the controller's schedules (GET /pool/schedules).
+func (h *PoolHandler) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.bridge.GetSchedules()
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// HandleSchedule returns one schedule (GET /pool/schedules/{id}).
+func (h *PoolHandler) HandleSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.bridge.GetSchedule(id)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleCreateSchedule adds a schedule (POST /pool/schedules).
+// Request body: {"circuit": "pool", "days": ["mon","wed","fri"], "start": "08:00", "stop": "12:00"}
+func (h *PoolHandler) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req pool.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.ID = 0
+
+	schedule, err := h.bridge.AddSchedule(req)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleUpdateSchedule changes a schedule (PUT /pool/schedules/{id}).
+// Fields left out of the request body keep their current values.
+func (h *PoolHandler) HandleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.bridge.GetSchedule(id)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	// The circuit name is derived from the ID; clear it so a new
+	// circuitId in the body isn't overridden by the old name
+	schedule.Circuit = ""
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "invalid schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule.ID = id
+
+	schedule, err = h.bridge.UpdateSchedule(schedule)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleDeleteSchedule removes a schedule (DELETE /pool/schedules/{id}).
+func (h *PoolHandler) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.bridge.DeleteSchedule(id); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scheduleID parses the schedule ID from the URL, responding 404 if it
+// isn't a number.
+func scheduleID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unknown schedule", http.StatusNotFound)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/series"
+)
+
+// defaultSeriesRange is how far back GET /pool/series goes without from.
+const defaultSeriesRange = 24 * time.Hour
+
+// autoResolution picks the finest resolution that keeps a range to a
+// chartable number of points.
+func autoResolution(from, to time.Time) series.Resolution {
+	switch d := to.Sub(from); {
+	case d <= 2*24*time.Hour:
+		return series.Raw
+	case d <= 60*24*time.Hour:
+		return series.Hourly
+	default:
+		return series.Daily
+	}
+}
+
+// HandleSeries returns a device's recorded states
+// (GET /pool/series/{device}?from=&to=&resolution=). from and to are as
+// for /pool/history; resolution is raw, hourly or daily and is picked
+// from the range when omitted.
+func (h *PoolHandler) HandleSeries(w http.ResponseWriter, r *http.Request) {
+	device := r.PathValue("device")
+
+	from, to, ok := parseTimeRange(w, r, defaultSeriesRange)
+	if !ok {
+		return
+	}
+
+	res := autoResolution(from, to)
+	if s := r.URL.Query().Get("resolution"); s != "" {
+		if res, ok = series.ParseResolution(s); !ok {
+			http.Error(w, "invalid resolution, want raw, hourly or daily", http.StatusBadRequest)
+			return
+		}
+	}
+
+	points, err := h.bridge.GetSeries(device, res, from, to)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device":     device,
+		"resolution": res,
+		"points":     points,
+	})
+}
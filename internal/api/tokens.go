@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// TokenHandler handles API token management requests.
+type TokenHandler struct {
+	store *TokenStore
+}
+
+// NewTokenHandler creates a new TokenHandler.
+func NewTokenHandler(store *TokenStore) *TokenHandler {
+	return &TokenHandler{store: store}
+}
+
+// tokenJSON is a token as shown by the API; the hash is never returned.
+type tokenJSON struct {
+	Name      string     `json:"name"`
+	Token     string     `json:"token,omitempty"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+}
+
+func newTokenJSON(t Token) tokenJSON {
+	return tokenJSON{
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		Expired:   t.Expired(time.Now()),
+	}
+}
+
+// HandleList lists tokens (GET /auth/tokens).
+func (h *TokenHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	tokens := h.store.List()
+	out := make([]tokenJSON, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, newTokenJSON(t))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleCreate issues a token (POST /auth/tokens).
+// Request body: {"name": "home-assistant", "scopes": ["control"], "expiresIn": "720h"}
+// The secret is only included in this response.
+func (h *TokenHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string  `json:"name"`
+		Scopes    []Scope `json:"scopes"`
+		ExpiresIn string  `json:"expiresIn"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid expiresIn", http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, token, err := h.store.Create(req.Name, req.Scopes, ttl)
+	if errors.Is(err, ErrTokenExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := newTokenJSON(token)
+	out.Token = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleRevoke deletes a token (DELETE /auth/tokens/{name}).
+func (h *TokenHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	err := h.store.Revoke(r.PathValue("name"))
+	if errors.Is(err, ErrTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
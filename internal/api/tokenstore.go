@@ -0,0 +1,237 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/atomicfile"
+)
+
+// Scope is a permission granted to an API token. Scopes are ordered: a
+// token with control may also read, and admin may do everything.
+type Scope string
+
+// Token scopes.
+const (
+	ScopeRead    Scope = "read"    // GET endpoints
+	ScopeControl Scope = "control" // change circuits, heat and lights
+	ScopeAdmin   Scope = "admin"   // manage tokens
+)
+
+// scopeRank orders scopes from least to most privileged.
+var scopeRank = map[Scope]int{
+	ScopeRead:    1,
+	ScopeControl: 2,
+	ScopeAdmin:   3,
+}
+
+// Token store errors.
+var (
+	ErrTokenInvalid  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrTokenExists   = errors.New("token name already in use")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// Token is a named API token. Only a hash of the secret is kept.
+type Token struct {
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Allows reports whether the token grants required (directly or through a
+// higher scope).
+func (t Token) Allows(required Scope) bool {
+	for _, s := range t.Scopes {
+		if scopeRank[s] >= scopeRank[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token has passed its expiry.
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// TokenStore holds API tokens, saved as JSON at path.
+type TokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens []Token
+}
+
+// LoadTokenStore reads the token file at path. A missing file yields an
+// empty store; path "" keeps the store in memory only.
+func LoadTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	if err := json.Unmarshal(raw, &s.tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+
+	return s, nil
+}
+
+// Len returns the number of tokens in the store.
+func (s *TokenStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokens)
+}
+
+// List returns a copy of every token.
+func (s *TokenStore) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]Token, len(s.tokens))
+	copy(tokens, s.tokens)
+	return tokens
+}
+
+// Create adds a token and returns its secret, which cannot be recovered
+// later. A ttl of 0 creates a token that never expires.
+func (s *TokenStore) Create(name string, scopes []Scope, ttl time.Duration) (string, Token, error) {
+	if name == "" {
+		return "", Token{}, fmt.Errorf("token name is required")
+	}
+	if len(scopes) == 0 {
+		return "", Token{}, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if _, ok := scopeRank[scope]; !ok {
+			return "", Token{}, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	secret, err := newTokenSecret()
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	token := Token{
+		Name:      name,
+		Hash:      hashToken(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		expires := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.Name == name {
+			return "", Token{}, fmt.Errorf("%q: %w", name, ErrTokenExists)
+		}
+	}
+
+	s.tokens = append(s.tokens, token)
+	if err := s.save(); err != nil {
+		s.tokens = s.tokens[:len(s.tokens)-1]
+		return "", Token{}, err
+	}
+
+	return secret, token, nil
+}
+
+// Revoke removes the named token.
+func (s *TokenStore) Revoke(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.tokens {
+		if t.Name != name {
+			continue
+		}
+		old := s.tokens
+		s.tokens = slices.Delete(slices.Clone(old), i, i+1)
+		if err := s.save(); err != nil {
+			s.tokens = old
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%q: %w", name, ErrTokenNotFound)
+}
+
+// Authenticate returns the token matching secret.
+func (s *TokenStore) Authenticate(secret string) (Token, error) {
+	if secret == "" {
+		return Token{}, ErrTokenInvalid
+	}
+	hash := hashToken(secret)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.Hash != hash {
+			continue
+		}
+		if t.Expired(time.Now()) {
+			return Token{}, ErrTokenExpired
+		}
+		return t, nil
+	}
+	return Token{}, ErrTokenInvalid
+}
+
+// save writes the store to disk. Caller must hold s.mu.
+func (s *TokenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(s.path, raw, 0o600); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
+
+// newTokenSecret returns a random token secret.
+func newTokenSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return "pc_" + hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the stored form of a token secret. Secrets are random,
+// so a plain SHA-256 is enough.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStoreCreateAndAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := LoadTokenStore(path)
+	if err != nil {
+		t.Fatalf("LoadTokenStore() error = %v", err)
+	}
+
+	secret, token, err := store.Create("ha", []Scope{ScopeControl}, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if token.ExpiresAt != nil {
+		t.Error("token without ttl should not expire")
+	}
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), secret) {
+		t.Error("token file contains the plaintext secret")
+	}
+
+	// Reload from disk
+	store, err = LoadTokenStore(path)
+	if err != nil {
+		t.Fatalf("LoadTokenStore() reload error = %v", err)
+	}
+	got, err := store.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if got.Name != "ha" {
+		t.Errorf("Authenticate() name = %q, want ha", got.Name)
+	}
+
+	if _, err := store.Authenticate("pc_wrong"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Authenticate(wrong) error = %v, want ErrTokenInvalid", err)
+	}
+	if _, _, err := store.Create("ha", []Scope{ScopeRead}, 0); !errors.Is(err, ErrTokenExists) {
+		t.Errorf("Create(duplicate) error = %v, want ErrTokenExists", err)
+	}
+}
+
+func TestTokenStoreValidation(t *testing.T) {
+	store, _ := LoadTokenStore("")
+
+	if _, _, err := store.Create("", []Scope{ScopeRead}, 0); err == nil {
+		t.Error("Create() without name should fail")
+	}
+	if _, _, err := store.Create("x", nil, 0); err == nil {
+		t.Error("Create() without scopes should fail")
+	}
+	if _, _, err := store.Create("x", []Scope{"root"}, 0); err == nil {
+		t.Error("Create() with unknown scope should fail")
+	}
+}
+
+func TestTokenStoreExpiryAndRevoke(t *testing.T) {
+	store, _ := LoadTokenStore("")
+
+	secret, _, err := store.Create("temp", []Scope{ScopeRead}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Authenticate(secret); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Authenticate(expired) error = %v, want ErrTokenExpired", err)
+	}
+
+	if err := store.Revoke("temp"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("Len() after revoke = %d, want 0", store.Len())
+	}
+	if err := store.Revoke("temp"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Revoke(missing) error = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	tests := []struct {
+		scopes   []Scope
+		required Scope
+		want     bool
+	}{
+		{[]Scope{ScopeRead}, ScopeRead, true},
+		{[]Scope{ScopeRead}, ScopeControl, false},
+		{[]Scope{ScopeControl}, ScopeRead, true},
+		{[]Scope{ScopeControl}, ScopeAdmin, false},
+		{[]Scope{ScopeAdmin}, ScopeControl, true},
+	}
+
+	for _, tt := range tests {
+		if got := (Token{Scopes: tt.scopes}).Allows(tt.required); got != tt.want {
+			t.Errorf("%v.Allows(%s) = %v, want %v", tt.scopes, tt.required, got, tt.want)
+		}
+	}
+}
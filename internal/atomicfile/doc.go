@@ -0,0 +1,14 @@
+// Package atomicfile replaces small state files (timers, API tokens,
+// scheduler state) so that readers see either the old contents or the new,
+// never a partial write.
+//
+// WriteFile writes to a temporary file in the same directory, syncs it to
+// disk, renames it over the target and then syncs the directory. Without
+// the syncs a power cut shortly after the rename can leave an empty or
+// truncated file on filesystems that reorder metadata and data writes,
+// such as ext4 on a Raspberry Pi's SD card.
+//
+//	if err := atomicfile.WriteFile("timers.json", raw, 0o644); err != nil {
+//		log.Printf("Failed to save timers: %v", err)
+//	}
+package atomicfile
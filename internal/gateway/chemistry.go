@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Chemistry alarm bits, as reported in ChemistryData.Alarms.
+const (
+	ChemAlarmFlow       = 0x01
+	ChemAlarmPHHigh     = 0x02
+	ChemAlarmPHLow      = 0x04
+	ChemAlarmORPHigh    = 0x08
+	ChemAlarmORPLow     = 0x10
+	ChemAlarmPHSupply   = 0x20
+	ChemAlarmORPSupply  = 0x40
+	ChemAlarmProbeFault = 0x80
+)
+
+// IntelliChem alert bits, as reported in ChemistryData.Alerts.
+const (
+	ChemAlertPHLockout       = 0x01
+	ChemAlertPHDoseLimit     = 0x02
+	ChemAlertORPDoseLimit    = 0x04
+	ChemAlertInvalidSetup    = 0x08
+	ChemAlertChlorinatorComm = 0x10
+)
+
+// Bits with a known meaning; anything else is reported as unknown.
+const (
+	chemAlarmKnownFlags = 0xff
+	chemAlertKnownFlags = 0x1f
+)
+
+// chemistryReadingsLength is the IntelliChem answer length up to and
+// including the alerts byte.
+const chemistryReadingsLength = 39
+
+// flagName names one bit of a bitfield.
+type flagName struct {
+	bit  int
+	name string
+}
+
+var chemAlarmNames = []flagName{
+	{ChemAlarmFlow, "Low Flow"},
+	{ChemAlarmPHHigh, "pH High"},
+	{ChemAlarmPHLow, "pH Low"},
+	{ChemAlarmORPHigh, "ORP High"},
+	{ChemAlarmORPLow, "ORP Low"},
+	{ChemAlarmPHSupply, "pH Tank Empty"},
+	{ChemAlarmORPSupply, "ORP Tank Empty"},
+	{ChemAlarmProbeFault, "Probe Fault"},
+}
+
+var chemAlertNames = []flagName{
+	{ChemAlertPHLockout, "pH Lockout"},
+	{ChemAlertPHDoseLimit, "pH Dose Limit"},
+	{ChemAlertORPDoseLimit, "ORP Dose Limit"},
+	{ChemAlertInvalidSetup, "Invalid Setup"},
+	{ChemAlertChlorinatorComm, "Chlorinator Comm Error"},
+}
+
+// AlarmNames returns the names of the active alarms, in bit order.
+func (c ChemistryData) AlarmNames() []string {
+	return flagNames(c.Alarms, chemAlarmNames, chemAlarmKnownFlags)
+}
+
+// AlertNames returns the names of the active IntelliChem alerts.
+func (c ChemistryData) AlertNames() []string {
+	return flagNames(c.Alerts, chemAlertNames, chemAlertKnownFlags)
+}
+
+// flagNames decodes bits. Unknown bits are reported by value so they are
+// not silently dropped.
+func flagNames(bits int, names []flagName, known int) []string {
+	var out []string
+	for _, f := range names {
+		if bits&f.bit != 0 {
+			out = append(out, f.name)
+		}
+	}
+	if unknown := bits &^ known; unknown != 0 {
+		out = append(out, fmt.Sprintf("Unknown (0x%x)", unknown))
+	}
+	return out
+}
+
+// QueryChemistry queries the IntelliChem controller. Only systems with
+// ConfigData.HasIntelliChem answer it meaningfully.
+func QueryChemistry(conn Sender, data *PoolData, timeout time.Duration) error {
+	// Send chemistry query with one zero
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+
+	resp, err := conn.Send(ChemistryQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != ChemistryAnswer {
+		return fmt.Errorf("unexpected chemistry response code: %d", code)
+	}
+
+	return decodeChemistryAnswer(buf, data)
+}
+
+// decodeChemistryAnswer parses the IntelliChem response. Unlike every other
+// answer, its readings are big-endian.
+func decodeChemistryAnswer(buf []byte, data *PoolData) error {
+	if len(buf) < chemistryReadingsLength {
+		return fmt.Errorf("chemistry answer too short: %d bytes", len(buf))
+	}
+
+	// Size prefix, then an unused byte
+	offset := 5
+
+	chem := &data.Chemistry
+	var u16 uint16
+	var b byte
+
+	u16, offset = GetUint16BE(buf, offset)
+	chem.PH = float64(u16) / 100.0
+	u16, offset = GetUint16BE(buf, offset)
+	chem.ORP = int(u16)
+	u16, offset = GetUint16BE(buf, offset)
+	chem.PHSetPoint = float64(u16) / 100.0
+	u16, offset = GetUint16BE(buf, offset)
+	chem.ORPSetPoint = int(u16)
+
+	_, offset = GetUint32BE(buf, offset) // pH dose time
+	_, offset = GetUint32BE(buf, offset) // ORP dose time
+	_, offset = GetUint16BE(buf, offset) // pH dose volume
+	_, offset = GetUint16BE(buf, offset) // ORP dose volume
+
+	b, offset = GetByte(buf, offset)
+	chem.PHTankLevel = int(b)
+	b, offset = GetByte(buf, offset)
+	chem.ORPTankLevel = int(b)
+
+	// Saturation index is a signed byte in hundredths
+	b, offset = GetByte(buf, offset)
+	chem.Saturation = float64(int8(b)) / 100.0
+
+	u16, offset = GetUint16BE(buf, offset)
+	chem.CalciumHardness = int(u16)
+	u16, offset = GetUint16BE(buf, offset)
+	chem.CyanuricAcid = int(u16)
+	u16, offset = GetUint16BE(buf, offset)
+	chem.TotalAlkalinity = int(u16)
+
+	// Salt is reported in units of 50 ppm
+	b, offset = GetByte(buf, offset)
+	chem.SaltPPM = int(b) * 50
+
+	_, offset = GetByte(buf, offset) // probe is Celsius
+	b, offset = GetByte(buf, offset)
+	chem.WaterTemperature = int(b)
+
+	b, offset = GetByte(buf, offset)
+	chem.Alarms = int(b)
+	b, offset = GetByte(buf, offset)
+	chem.Alerts = int(b)
+
+	_, offset = GetByte(buf, offset) // dose status
+	_, offset = GetByte(buf, offset) // flags
+
+	var minor, major byte
+	minor, offset = GetByte(buf, offset)
+	major, _ = GetByte(buf, offset)
+	chem.Firmware = fmt.Sprintf("%d.%03d", major, minor)
+
+	chem.IntelliChem = true
+	return nil
+}
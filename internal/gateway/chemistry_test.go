@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChemistryAlarmNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		alarms int
+		want   []string
+	}{
+		{name: "none", alarms: 0, want: nil},
+		{name: "flow and pH", alarms: ChemAlarmFlow | ChemAlarmPHHigh, want: []string{"Low Flow", "pH High"}},
+		{name: "tanks", alarms: ChemAlarmPHSupply | ChemAlarmORPSupply, want: []string{"pH Tank Empty", "ORP Tank Empty"}},
+		{name: "unknown bit", alarms: ChemAlarmProbeFault | 0x100, want: []string{"Probe Fault", "Unknown (0x100)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChemistryData{Alarms: tt.alarms}.AlarmNames()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AlarmNames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChemistryAlertNames(t *testing.T) {
+	got := ChemistryData{Alerts: ChemAlertORPDoseLimit | ChemAlertChlorinatorComm}.AlertNames()
+	want := []string{"ORP Dose Limit", "Chlorinator Comm Error"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AlertNames() = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeChemistryAnswerTooShort(t *testing.T) {
+	if err := decodeChemistryAnswer(make([]byte, 20), NewPoolData()); err == nil {
+		t.Error("decodeChemistryAnswer() should reject a short answer")
+	}
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Encoded sizes: a Windows SYSTEMTIME is eight uint16s, and the clock
+// messages follow it with a uint32 adjust-for-DST flag.
+const (
+	systemTimeSize   = 16
+	systemTimeLength = systemTimeSize + 4
+)
+
+// SystemTime is the controller's clock. The controller keeps local wall
+// time with no zone; Time carries it in time.Local.
+type SystemTime struct {
+	Time         time.Time
+	AdjustForDST bool // controller applies its own (US) DST rules
+}
+
+// QuerySystemTime reads the controller's clock.
+func QuerySystemTime(conn Sender, timeout time.Duration) (SystemTime, error) {
+	// Send system time query with one zero
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+
+	resp, err := conn.Send(SystemTimeQuery, payload, timeout)
+	if err != nil {
+		return SystemTime{}, err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return SystemTime{}, err
+	}
+	if code != SystemTimeAnswer {
+		return SystemTime{}, fmt.Errorf("unexpected system time response code: %d", code)
+	}
+
+	return decodeSystemTime(buf)
+}
+
+// SetSystemTime sets the controller's clock to the wall time of t in its
+// own location, so convert t with In first to set another zone's time.
+func SetSystemTime(conn Sender, t time.Time, adjustForDST bool, timeout time.Duration) error {
+	// Payload: SYSTEMTIME (16 bytes), adjust for DST (4 bytes)
+	payload := encodeSystemTime(SystemTime{Time: t, AdjustForDST: adjustForDST})
+
+	resp, err := conn.Send(SetSystemTimeQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetSystemTimeAnswer {
+		return fmt.Errorf("unexpected set system time response code: %d", code)
+	}
+
+	return nil
+}
+
+// encodeSystemTime encodes st as a SYSTEMTIME followed by the DST flag,
+// the layout of both SystemTimeAnswer and SetSystemTimeQuery.
+func encodeSystemTime(st SystemTime) []byte {
+	buf := appendSystemTime(nil, st.Time)
+	adjust := uint32(0)
+	if st.AdjustForDST {
+		adjust = 1
+	}
+	return binary.LittleEndian.AppendUint32(buf, adjust)
+}
+
+// decodeSystemTime decodes a SystemTimeAnswer.
+func decodeSystemTime(buf []byte) (SystemTime, error) {
+	if len(buf) < systemTimeLength {
+		return SystemTime{}, fmt.Errorf("system time answer too short: %d bytes", len(buf))
+	}
+
+	t, offset, err := getSystemTime(buf, 0)
+	if err != nil {
+		return SystemTime{}, err
+	}
+	if t.IsZero() {
+		return SystemTime{}, fmt.Errorf("controller clock is not set")
+	}
+
+	adjust, _ := GetUint32(buf, offset)
+	return SystemTime{Time: t, AdjustForDST: adjust != 0}, nil
+}
+
+// appendSystemTime appends the wall time of t as a Windows SYSTEMTIME:
+// year, month, day of week, day, hour, minute, second and millisecond.
+func appendSystemTime(buf []byte, t time.Time) []byte {
+	for _, v := range []int{
+		t.Year(), int(t.Month()), int(t.Weekday()), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / int(time.Millisecond),
+	} {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(v))
+	}
+	return buf
+}
+
+// getSystemTime reads a SYSTEMTIME at offset as local time. An all-zero
+// SYSTEMTIME is returned as the zero time. The day of week is ignored; it
+// follows from the date.
+func getSystemTime(buf []byte, offset int) (time.Time, int, error) {
+	if offset+systemTimeSize > len(buf) {
+		return time.Time{}, offset, fmt.Errorf("system time truncated at byte %d", offset)
+	}
+
+	var fields [8]int
+	for i := range fields {
+		v, _ := GetUint16(buf, offset+2*i)
+		fields[i] = int(v)
+	}
+	offset += systemTimeSize
+
+	if fields == [8]int{} {
+		return time.Time{}, offset, nil
+	}
+	year, month, day := fields[0], fields[1], fields[3]
+	hour, minute, second, ms := fields[4], fields[5], fields[6], fields[7]
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, offset, fmt.Errorf("invalid system time %04d-%02d-%02d %02d:%02d:%02d",
+			year, month, day, hour, minute, second)
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, ms*int(time.Millisecond), time.Local), offset, nil
+}
@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestSystemTimeRoundTrip(t *testing.T) {
+	want := time.Date(2024, time.March, 10, 2, 30, 15, 250*int(time.Millisecond), time.Local)
+	buf := encodeSystemTime(SystemTime{Time: want, AdjustForDST: true})
+
+	if dow := binary.LittleEndian.Uint16(buf[4:6]); dow != uint16(time.Sunday) {
+		t.Errorf("day of week = %d, want %d", dow, time.Sunday)
+	}
+
+	got, err := decodeSystemTime(buf)
+	if err != nil {
+		t.Fatalf("decodeSystemTime() error = %v", err)
+	}
+	if !got.Time.Equal(want) || !got.AdjustForDST {
+		t.Errorf("decodeSystemTime() = %+v, want %s with DST adjust", got, want)
+	}
+}
+
+func TestDecodeSystemTimeInvalid(t *testing.T) {
+	if _, err := decodeSystemTime(make([]byte, 16)); err == nil {
+		t.Error("decodeSystemTime() should reject a short answer")
+	}
+
+	// An unset controller clock reports all zeros
+	if _, err := decodeSystemTime(make([]byte, systemTimeLength)); err == nil {
+		t.Error("decodeSystemTime() should reject an unset clock")
+	}
+}
@@ -1,20 +1,30 @@
 package gateway
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
 // Connection manages a TCP connection to the Pentair gateway.
 type Connection struct {
-	conn net.Conn
-	ip   string
-	port int
+	conn   net.Conn
+	reader *bufio.Reader
+	ip     string
+	port   int
+
+	// pushes holds unsolicited messages that arrived while Send was
+	// waiting for an answer, oldest first.
+	pushes [][]byte
 }
 
+// maxBufferedPushes bounds Connection.pushes; older messages are discarded.
+const maxBufferedPushes = 16
+
 // NewConnection creates a new gateway connection.
 func NewConnection(ip string, port int) *Connection {
 	return &Connection{
@@ -26,12 +36,15 @@ func NewConnection(ip string, port int) *Connection {
 // Connect establishes a connection to the gateway and performs login.
 func (c *Connection) Connect(timeout time.Duration) error {
 	// Establish TCP connection
-	addr := fmt.Sprintf("%s:%d", c.ip, c.port)
+	addr := net.JoinHostPort(c.ip, strconv.Itoa(c.port))
+	start := time.Now()
 	conn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
 		return fmt.Errorf("failed to connect to gateway: %w", err)
 	}
+	connectSeconds.Observe(time.Since(start).Seconds())
 	c.conn = conn
+	c.reader = bufio.NewReader(conn)
 
 	// Set read/write deadline
 	c.conn.SetDeadline(time.Now().Add(timeout))
@@ -44,6 +57,7 @@ func (c *Connection) Connect(timeout time.Duration) error {
 	}
 
 	// Challenge exchange
+	start = time.Now()
 	err = c.sendChallenge()
 	if err != nil {
 		c.Close()
@@ -56,6 +70,7 @@ func (c *Connection) Connect(timeout time.Duration) error {
 		c.Close()
 		return fmt.Errorf("login failed: %w", err)
 	}
+	loginSeconds.Observe(time.Since(start).Seconds())
 
 	// Clear deadline for future operations
 	c.conn.SetDeadline(time.Time{})
@@ -71,16 +86,12 @@ func (c *Connection) sendChallenge() error {
 		return err
 	}
 
-	resp := make([]byte, 256)
-	n, err := c.conn.Read(resp)
+	resp, err := c.readMessage()
 	if err != nil {
 		return err
 	}
-	if n < HeaderSize {
-		return fmt.Errorf("challenge response too short")
-	}
 
-	code, _, err := DecodeMessage(resp[:n])
+	code, _, err := DecodeMessage(resp)
 	if err != nil {
 		return err
 	}
@@ -115,16 +126,12 @@ func (c *Connection) sendLogin() error {
 		return err
 	}
 
-	resp := make([]byte, 256)
-	n, err := c.conn.Read(resp)
+	resp, err := c.readMessage()
 	if err != nil {
 		return err
 	}
-	if n < HeaderSize {
-		return fmt.Errorf("login response too short")
-	}
 
-	code, _, err := DecodeMessage(resp[:n])
+	code, _, err := DecodeMessage(resp)
 	if err != nil {
 		return err
 	}
@@ -143,7 +150,8 @@ func (c *Connection) Close() error {
 	return nil
 }
 
-// Send sends a message and returns the response.
+// Send sends a message and returns the response. Unsolicited messages that
+// arrive before the answer are buffered and can be collected with Pushes.
 func (c *Connection) Send(msgCode uint16, data []byte, timeout time.Duration) ([]byte, error) {
 	if c.conn == nil {
 		return nil, fmt.Errorf("not connected")
@@ -152,20 +160,92 @@ func (c *Connection) Send(msgCode uint16, data []byte, timeout time.Duration) ([
 	c.conn.SetDeadline(time.Now().Add(timeout))
 	defer c.conn.SetDeadline(time.Time{})
 
+	if err := c.writeMessage(msgCode, data); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		code := binary.LittleEndian.Uint16(resp[2:4])
+		if code == msgCode+1 || isErrorAnswer(code) {
+			return resp, nil
+		}
+		c.bufferPush(resp)
+	}
+}
+
+// SendFollowed sends a query whose answer is only an acknowledgement and
+// returns the message with followCode that the gateway sends after it.
+func (c *Connection) SendFollowed(msgCode uint16, data []byte, followCode uint16, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+
+	answer, err := c.Send(msgCode, data, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := DecodeMessage(answer); err != nil {
+		return nil, err
+	}
+
+	// The follow-up may have been buffered while waiting for the answer
+	for i, msg := range c.pushes {
+		if binary.LittleEndian.Uint16(msg[2:4]) == followCode {
+			c.pushes = append(c.pushes[:i], c.pushes[i+1:]...)
+			return msg, nil
+		}
+	}
+
+	c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint16(msg[2:4]) == followCode {
+			return msg, nil
+		}
+		c.bufferPush(msg)
+	}
+}
+
+// Pushes returns and clears the unsolicited messages buffered by Send.
+func (c *Connection) Pushes() [][]byte {
+	pushes := c.pushes
+	c.pushes = nil
+	return pushes
+}
+
+// bufferPush keeps an unsolicited message, discarding the oldest when full.
+func (c *Connection) bufferPush(msg []byte) {
+	if len(c.pushes) >= maxBufferedPushes {
+		c.pushes = c.pushes[1:]
+	}
+	c.pushes = append(c.pushes, msg)
+}
+
+// writeMessage frames and writes a single message to the gateway.
+func (c *Connection) writeMessage(msgCode uint16, data []byte) error {
 	msg := MakeMessage(msgCode, data)
 	_, err := c.conn.Write(msg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send message: %w", err)
+		return fmt.Errorf("failed to send message: %w", err)
 	}
+	return nil
+}
 
-	// Read response - may need multiple reads for large responses
-	resp := make([]byte, 2048)
-	n, err := c.conn.Read(resp)
+// readMessage reads the next complete message from the gateway.
+func (c *Connection) readMessage() ([]byte, error) {
+	msg, err := ReadMessage(c.reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	return resp[:n], nil
+	return msg, nil
 }
 
 // IsConnected returns true if the connection is established.
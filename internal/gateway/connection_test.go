@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionSendBuffersPushes(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := &Connection{conn: client, reader: bufio.NewReader(client)}
+
+	go func() {
+		if _, err := ReadMessage(server); err != nil {
+			return
+		}
+		// A status push sneaks in ahead of the answer
+		server.Write(MakeMessage(12500, []byte{1, 2, 3, 4}))
+		server.Write(MakeMessage(ButtonPressAnswer, nil))
+	}()
+
+	resp, err := c.Send(ButtonPressQuery, make([]byte, 12), 2*time.Second)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if code, _, _ := DecodeMessage(resp); code != ButtonPressAnswer {
+		t.Errorf("Send() answer code = %d, want %d", code, ButtonPressAnswer)
+	}
+
+	pushes := c.Pushes()
+	if len(pushes) != 1 {
+		t.Fatalf("Pushes() len = %d, want 1", len(pushes))
+	}
+	if code, data, _ := DecodeMessage(pushes[0]); code != 12500 || len(data) != 4 {
+		t.Errorf("push code = %d len = %d, want 12500 len 4", code, len(data))
+	}
+	if len(c.Pushes()) != 0 {
+		t.Error("Pushes() should be empty after draining")
+	}
+}
+
+func TestConnectionSendFollowed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := &Connection{conn: client, reader: bufio.NewReader(client)}
+	data := MakeMessage(HistoryDataPush, make([]byte, 64))
+
+	go func() {
+		if _, err := ReadMessage(server); err != nil {
+			return
+		}
+		server.Write(MakeMessage(HistoryAnswer, nil))
+		server.Write(MakeMessage(12500, []byte{1, 2, 3, 4}))
+		// The data arrives in pieces, as a large message does over TCP
+		server.Write(data[:20])
+		server.Write(data[20:])
+	}()
+
+	resp, err := c.SendFollowed(HistoryQuery, make([]byte, 40), HistoryDataPush, 2*time.Second)
+	if err != nil {
+		t.Fatalf("SendFollowed() error = %v", err)
+	}
+	if code, buf, _ := DecodeMessage(resp); code != HistoryDataPush || len(buf) != 64 {
+		t.Errorf("SendFollowed() code = %d len = %d, want %d len 64", code, len(buf), HistoryDataPush)
+	}
+	if pushes := c.Pushes(); len(pushes) != 1 {
+		t.Errorf("Pushes() len = %d, want the status push", len(pushes))
+	}
+}
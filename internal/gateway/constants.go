@@ -2,6 +2,11 @@
 // Protocol documentation: https://github.com/ceisenach/screenlogic_over_ip
 package gateway
 
+import (
+	"strings"
+	"unicode"
+)
+
 // Message codes for the Pentair protocol
 const (
 	MsgCode1 = 0
@@ -19,6 +24,87 @@ const (
 	CtrlConfigQuery   = 12532
 	CtrlConfigAnswer  = 12533
 	UnknownAnswer     = 13
+
+	// Heat control
+	SetHeatSetPointQuery  = 12528
+	SetHeatSetPointAnswer = 12529
+	SetHeatModeQuery      = 12538
+	SetHeatModeAnswer     = 12539
+
+	// Color light command (applies to all color lights)
+	ColorLightsQuery  = 12556
+	ColorLightsAnswer = 12557
+
+	// Client registration for push updates
+	AddClientQuery     = 12522
+	AddClientAnswer    = 12523
+	RemoveClientQuery  = 12524
+	RemoveClientAnswer = 12525
+
+	// Push messages sent by the gateway to registered clients
+	StatusChangedPush    = 12500
+	ColorUpdatePush      = 12504
+	ChemistryChangedPush = 12505
+
+	// Error answers the gateway may send in place of the expected answer
+	InvalidRequestAnswer = 30
+	BadParameterAnswer   = 31
+)
+
+// Controller clock
+const (
+	SystemTimeQuery     = 8110
+	SystemTimeAnswer    = 8111
+	SetSystemTimeQuery  = 8112
+	SetSystemTimeAnswer = 8113
+)
+
+// History data. The answer only acknowledges the query; the samples follow
+// in a HistoryDataPush addressed to the client ID in the query.
+const (
+	HistoryQuery    = 12534
+	HistoryAnswer   = 12535
+	HistoryDataPush = 12502
+)
+
+// IntelliChem chemistry controller
+const (
+	ChemistryQuery  = 12592
+	ChemistryAnswer = 12593
+)
+
+// Salt chlorinator (IntelliChlor) configuration and output
+const (
+	SCGConfigQuery  = 12572
+	SCGConfigAnswer = 12573
+	SetSCGQuery     = 12576
+	SetSCGAnswer    = 12577
+)
+
+// Variable-speed pumps
+const (
+	PumpStatusQuery   = 12584
+	PumpStatusAnswer  = 12585
+	SetPumpFlowQuery  = 12586
+	SetPumpFlowAnswer = 12587
+)
+
+// Controller schedules
+const (
+	ScheduleQuery        = 12542
+	ScheduleAnswer       = 12543
+	AddScheduleQuery     = 12544
+	AddScheduleAnswer    = 12545
+	DeleteScheduleQuery  = 12546
+	DeleteScheduleAnswer = 12547
+	SetScheduleQuery     = 12548
+	SetScheduleAnswer    = 12549
+)
+
+// Config equipment flags for optional equipment
+const (
+	EquipmentChlorinator = 0x0001
+	EquipmentIntelliChem = 0x8000
 )
 
 // Circuit IDs
@@ -46,6 +132,33 @@ var ColorMode = []string{
 	"Reset", "Hold",
 }
 
+// Circuit functions that drive color-capable lights
+const (
+	FunctionSamLight     = 9
+	FunctionSalLight     = 10
+	FunctionPhotonGen    = 11
+	FunctionColorWheel   = 12
+	FunctionIntelliBrite = 16
+	FunctionMagicStream  = 17
+)
+
+// InterfaceLights is the circuit interface tab for lights.
+const InterfaceLights = 4
+
+// LightShows lists the ColorMode commands that select a show or fixed color.
+var LightShows = []string{
+	"Party", "Romantic", "Caribbean", "American", "Sunset", "Royal",
+	"Blue", "Green", "Red", "White", "Magenta",
+}
+
+// HeatModeDontChange is the HeatMode index that leaves the mode as is. It is
+// only meaningful inside schedules, never as a direct command.
+const HeatModeDontChange = 4
+
+// FreezeModeActive is the status freeze mode bit set while freeze
+// protection is running.
+const FreezeModeActive = 0x08
+
 // HeaderSize is the size of the message header (8 bytes)
 const HeaderSize = 8
 
@@ -67,3 +180,36 @@ const (
 
 // ConnectString is sent to initiate connection with gateway
 const ConnectString = "CONNECTSERVERHOST\r\n\r\n"
+
+// HeatModeByName looks up a HeatMode index by name, ignoring case and
+// treating spaces and underscores alike ("solar_preferred" works).
+func HeatModeByName(name string) (int, bool) {
+	return lookupName(HeatMode, name)
+}
+
+// ColorModeByName looks up a ColorMode index by name, ignoring case.
+func ColorModeByName(name string) (int, bool) {
+	return lookupName(ColorMode, name)
+}
+
+// lookupName finds name in a state mapping, ignoring case and separators.
+func lookupName(names []string, name string) (int, bool) {
+	want := normalizeName(name)
+	for i, n := range names {
+		if normalizeName(n) == want {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeName lowercases s and strips spaces, underscores and apostrophes.
+func normalizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-', '\'':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
@@ -50,3 +50,25 @@ func TestMappings(t *testing.T) {
 		t.Error("OnOff should start with [Off, On]")
 	}
 }
+
+func TestHeatModeByName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   int
+		wantOK bool
+	}{
+		{name: "Heat", want: 3, wantOK: true},
+		{name: "off", want: 0, wantOK: true},
+		{name: "solar_preferred", want: 2, wantOK: true},
+		{name: "Solar Preferred", want: 2, wantOK: true},
+		{name: "dont change", want: HeatModeDontChange, wantOK: true},
+		{name: "boil", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := HeatModeByName(tt.name)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("HeatModeByName(%q) = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
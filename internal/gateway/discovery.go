@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -19,6 +20,12 @@ type GatewayInfo struct {
 // DiscoverGateway broadcasts to find a Pentair gateway on the local network.
 // Returns gateway information or an error if not found.
 func DiscoverGateway(timeout time.Duration) (*GatewayInfo, error) {
+	return DiscoverGatewayAt(net.JoinHostPort(DiscoveryBroadcast, strconv.Itoa(DiscoveryPort)), timeout)
+}
+
+// DiscoverGatewayAt sends the discovery packet to addr (host:port) instead
+// of the standard broadcast address, e.g. to reach a simulator.
+func DiscoverGatewayAt(addr string, timeout time.Duration) (*GatewayInfo, error) {
 	// Create UDP socket
 	conn, err := net.ListenUDP("udp4", nil)
 	if err != nil {
@@ -30,7 +37,7 @@ func DiscoverGateway(timeout time.Duration) (*GatewayInfo, error) {
 	conn.SetReadDeadline(time.Now().Add(timeout))
 
 	// Prepare broadcast address
-	bcastAddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("%s:%d", DiscoveryBroadcast, DiscoveryPort))
+	bcastAddr, err := net.ResolveUDPAddr("udp4", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve broadcast address: %w", err)
 	}
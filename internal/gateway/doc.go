@@ -19,6 +19,8 @@
 //
 // Gateways are discovered via UDP broadcast to 255.255.255.255:1444.
 // The gateway responds with its IP address, port, and name.
+// DiscoverGatewayAt sends the same packet to any address, which is how the
+// gatewaysim simulator is found.
 //
 // # Connection Flow
 //
@@ -28,21 +30,53 @@
 //  4. Login with credentials
 //  5. Query config and status as needed
 //
+// # Sessions
+//
+// A Session keeps one logged-in connection open for the life of the process.
+// Requests from concurrent callers are serialized over it and answers are
+// matched by message code. The session sends a VersionQuery keepalive and
+// reconnects with exponential backoff when the socket drops. Query functions
+// accept any Sender, so they work with either a Connection or a Session.
+// Connect and login latency and per-message query and error counts are
+// kept in the metrics Default registry.
+//
+// # IntelliChem
+//
+// Systems with the EquipmentIntelliChem config flag answer ChemistryQuery
+// with set points, water balance readings and alerts. Its readings are
+// big-endian, unlike the rest of the protocol.
+//
+// # History
+//
+// HistoryQuery asks for the temperature and run log over a time range. The
+// HistoryAnswer only acknowledges it; the data follows as a separate
+// HistoryDataPush, which SendFollowed waits for on either a Connection or
+// a Session. Times in history and clock messages are SYSTEMTIMEs holding
+// the controller's local wall time.
+//
+// # Push Updates
+//
+// Clients registered with AddClient receive unsolicited messages whenever
+// equipment changes, e.g. StatusChangedPush (same layout as PoolStatusAnswer)
+// and ChemistryChangedPush (same layout as ChemistryAnswer).
+// Session.Subscribe registers the client (again after every reconnect) and
+// hands each push to a callback; ApplyPush decodes it into PoolData.
+//
 // # Usage
 //
 //	// Discover gateway
 //	info, _ := gateway.DiscoverGateway(5 * time.Second)
 //
-//	// Connect
-//	conn := gateway.NewConnection(info.IP, info.Port)
-//	conn.Connect(10 * time.Second)
-//	defer conn.Close()
+//	// Open a persistent session
+//	session := gateway.NewSession(info.IP, info.Port, 10*time.Second)
+//	session.Start()
+//	defer session.Close()
 //
 //	// Query status
 //	data := gateway.NewPoolData()
-//	gateway.QueryConfig(conn, data, 10*time.Second)
-//	gateway.QueryStatus(conn, data, 10*time.Second)
+//	gateway.QueryConfig(session, data, 10*time.Second)
+//	gateway.QueryStatus(session, data, 10*time.Second)
 //
 //	// Control circuit
-//	gateway.SetCircuit(conn, gateway.CircuitSpa, 1, 10*time.Second)
+//	gateway.SetCircuit(session, gateway.CircuitSpa, 1, 10*time.Second)
 package gateway
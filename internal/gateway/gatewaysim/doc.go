@@ -0,0 +1,30 @@
+// Package gatewaysim is a fake Pentair ScreenLogic gateway for offline
+// development and integration tests.
+//
+// # Overview
+//
+// A Server accepts TCP connections and speaks the gateway protocol: the
+// connect string, challenge and login, then version, config, status,
+// button press, heat set point/mode, color light and push registration
+// messages. Changes are applied to the simulated state and pushed to
+// registered clients, so a Bridge behaves exactly as it would against a
+// real adapter. Discovery is answered on a configurable UDP port.
+//
+// # Scenarios
+//
+// The simulated equipment and its starting state come from a Scenario:
+// circuits, bodies (temperatures, set points, heat modes) and chemistry.
+// DefaultScenario matches a typical pool and spa; LoadScenario reads a JSON
+// file such as testdata/home.json.
+//
+// # Usage
+//
+//	sim := gatewaysim.NewServer(gatewaysim.DefaultScenario())
+//	sim.Listen("127.0.0.1:0")
+//	defer sim.Close()
+//
+//	addr := sim.Addr()
+//	bridge, _ := pool.NewBridge(addr.IP.String(), addr.Port, 30*time.Second)
+//
+// The gatewaysim command runs a simulator from the command line.
+package gatewaysim
@@ -0,0 +1,321 @@
+package gatewaysim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// encodeConfig builds a CtrlConfigAnswer payload, the inverse of
+// gateway.QueryConfig's decoder.
+func encodeConfig(sc *Scenario) []byte {
+	buf := new(bytes.Buffer)
+	put := func(v any) { binary.Write(buf, binary.LittleEndian, v) }
+
+	put(sc.ControllerID)
+
+	// Min/max set points, pool then spa
+	for bodyType := 0; bodyType < 2; bodyType++ {
+		var min, max byte
+		if b := sc.body(bodyType); b != nil {
+			min, max = byte(b.MinSetPoint), byte(b.MaxSetPoint)
+		}
+		buf.WriteByte(min)
+		buf.WriteByte(max)
+	}
+
+	buf.WriteByte(boolByte(sc.Celsius))
+	buf.WriteByte(0) // controller type
+	buf.WriteByte(0) // hardware type
+	buf.WriteByte(0) // controller buffer
+	var equipment int32
+	if sc.Chlorinator.Installed {
+		equipment |= gateway.EquipmentChlorinator
+	}
+	if sc.Chemistry.IntelliChem {
+		equipment |= gateway.EquipmentIntelliChem
+	}
+	put(equipment)
+	buf.Write(encodeString("Unused"))
+
+	put(uint32(len(sc.Circuits)))
+	for _, c := range sc.Circuits {
+		put(int32(c.ID))
+		buf.Write(encodeString(c.Name))
+		buf.WriteByte(0) // name index
+		buf.WriteByte(c.Function)
+		buf.WriteByte(c.Interface)
+		buf.WriteByte(0) // flags
+		buf.WriteByte(c.ColorSet)
+		buf.WriteByte(c.ColorPosition)
+		buf.WriteByte(c.ColorStagger)
+		buf.WriteByte(0) // device ID
+		put(c.DefaultRuntime)
+		buf.Write([]byte{0, 0})
+	}
+
+	put(uint32(0)) // colors
+
+	var pumps [gateway.MaxPumps]byte
+	for _, p := range sc.Pumps {
+		pumps[p.Index] = 1
+	}
+	buf.Write(pumps[:])
+
+	put(uint32(0)) // interface tab flags
+	put(uint32(0)) // show alarms
+
+	return buf.Bytes()
+}
+
+// encodeStatus builds a PoolStatusAnswer (and StatusChangedPush) payload.
+func encodeStatus(sc *Scenario) []byte {
+	buf := new(bytes.Buffer)
+	put := func(v any) { binary.Write(buf, binary.LittleEndian, v) }
+
+	put(uint32(1)) // OK
+	var freeze byte
+	if sc.FreezeMode {
+		freeze = gateway.FreezeModeActive
+	}
+	buf.WriteByte(freeze)
+	buf.WriteByte(0) // remotes
+	buf.WriteByte(boolByte(sc.PoolDelay))
+	buf.WriteByte(boolByte(sc.SpaDelay))
+	buf.WriteByte(boolByte(sc.CleanerDelay))
+	buf.Write(make([]byte, 3)) // padding
+	put(int32(sc.AirTemperature))
+
+	put(uint32(len(sc.Bodies)))
+	for _, b := range sc.Bodies {
+		put(uint32(b.Type))
+		put(int32(b.Temperature))
+		put(int32(b.HeatStatus))
+		put(int32(b.SetPoint))
+		put(int32(b.CoolSetPoint))
+		put(int32(b.HeatMode))
+	}
+
+	put(uint32(len(sc.Circuits)))
+	for _, c := range sc.Circuits {
+		put(uint32(c.ID))
+		put(uint32(c.State))
+		buf.WriteByte(c.ColorSet)
+		buf.WriteByte(c.ColorPosition)
+		buf.WriteByte(c.ColorStagger)
+		buf.WriteByte(boolByte(c.Delay))
+	}
+
+	chem := sc.Chemistry
+	put(int32(math.Round(chem.PH * 100)))
+	put(int32(chem.ORP))
+	put(int32(math.Round(chem.Saturation * 100)))
+	put(int32(chem.SaltPPM))
+	put(int32(chem.PHTankLevel))
+	put(int32(chem.ORPTankLevel))
+	put(int32(chem.Alarms))
+
+	return buf.Bytes()
+}
+
+// encodeChemistry builds a ChemistryAnswer (and ChemistryChangedPush)
+// payload. The readings are big-endian, unlike the rest of the protocol.
+func encodeChemistry(sc *Scenario) []byte {
+	buf := new(bytes.Buffer)
+	put := func(v any) { binary.Write(buf, binary.BigEndian, v) }
+
+	chem := sc.Chemistry
+	binary.Write(buf, binary.LittleEndian, uint32(42)) // size
+	buf.WriteByte(0)
+	put(uint16(math.Round(chem.PH * 100)))
+	put(uint16(chem.ORP))
+	put(uint16(math.Round(chem.PHSetPoint * 100)))
+	put(uint16(chem.ORPSetPoint))
+	put(uint32(0)) // pH dose time
+	put(uint32(0)) // ORP dose time
+	put(uint16(0)) // pH dose volume
+	put(uint16(0)) // ORP dose volume
+	buf.WriteByte(byte(chem.PHTankLevel))
+	buf.WriteByte(byte(chem.ORPTankLevel))
+	buf.WriteByte(byte(int8(math.Round(chem.Saturation * 100))))
+	put(uint16(chem.CalciumHardness))
+	put(uint16(chem.CyanuricAcid))
+	put(uint16(chem.TotalAlkalinity))
+	buf.WriteByte(byte(chem.SaltPPM / 50))
+	buf.WriteByte(boolByte(sc.Celsius))
+	buf.WriteByte(byte(chem.WaterTemperature))
+	buf.WriteByte(byte(chem.Alarms))
+	buf.WriteByte(byte(chem.Alerts))
+	buf.WriteByte(0)        // dose status
+	buf.WriteByte(0)        // flags
+	buf.Write([]byte{0, 1}) // firmware minor, major
+	buf.WriteByte(0)        // balance
+
+	return buf.Bytes()
+}
+
+// encodeSCG builds an SCGConfigAnswer payload. The chlorinator reads the
+// same salt level as the status.
+func encodeSCG(sc *Scenario) []byte {
+	buf := new(bytes.Buffer)
+	put := func(v any) { binary.Write(buf, binary.LittleEndian, v) }
+
+	scg := sc.Chlorinator
+	put(uint32(boolByte(scg.Installed)))
+	put(uint32(scg.Status))
+	put(uint32(scg.PoolOutput))
+	put(uint32(scg.SpaOutput))
+	put(uint32(sc.Chemistry.SaltPPM / 50))
+	var flags uint32
+	if scg.SuperChlorinate {
+		flags |= gateway.SCGFlagSuperChlorinate
+	}
+	put(flags)
+	put(uint32(scg.SuperChlorHours))
+
+	return buf.Bytes()
+}
+
+// encodePump builds a PumpStatusAnswer payload. The pump runs at its
+// fastest preset whose circuit is on; power follows the cube of speed.
+func encodePump(sc *Scenario, p *PumpSpec) []byte {
+	buf := new(bytes.Buffer)
+	put := func(v any) { binary.Write(buf, binary.LittleEndian, v) }
+
+	var rpm, gpm int
+	for _, preset := range p.Presets {
+		c := sc.circuit(preset.Circuit)
+		if c == nil || c.State == 0 {
+			continue
+		}
+		speed := preset.Speed
+		if !preset.IsRPM {
+			speed = speed * gateway.PumpMaxRPM / gateway.PumpMaxGPM
+		}
+		rpm = max(rpm, speed)
+	}
+	if rpm > 0 {
+		gpm = rpm * gateway.PumpMaxGPM / gateway.PumpMaxRPM
+	}
+	watts := int(math.Round(2000 * math.Pow(float64(rpm)/gateway.PumpMaxRPM, 3)))
+
+	put(uint32(p.Type))
+	put(uint32(boolByte(rpm > 0)))
+	put(uint32(watts))
+	put(uint32(rpm))
+	put(uint32(0)) // unknown
+	put(uint32(gpm))
+	put(uint32(0)) // unknown
+	for i := 0; i < 8; i++ {
+		var preset PumpPresetSpec
+		if i < len(p.Presets) {
+			preset = p.Presets[i]
+		}
+		put(uint32(preset.Circuit))
+		put(uint32(preset.Speed))
+		buf.Write([]byte{boolByte(preset.IsRPM), 0, 0, 0})
+	}
+
+	return buf.Bytes()
+}
+
+// encodeSchedules builds a ScheduleAnswer payload with the schedules of
+// one type.
+func encodeSchedules(sc *Scenario, scheduleType int) []byte {
+	var events []ScheduleSpec
+	for _, e := range sc.Schedules {
+		if e.Type == scheduleType {
+			events = append(events, e)
+		}
+	}
+
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(events)))
+	for _, e := range events {
+		for _, v := range []int{e.ID, e.Circuit, e.Start, e.Stop, e.DayMask, e.Flags, e.HeatMode, e.HeatSetPoint} {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+		}
+	}
+	return buf
+}
+
+// encodeSystemTime builds a SystemTimeAnswer payload: a SYSTEMTIME with
+// the local wall time, then the adjust-for-DST flag.
+func encodeSystemTime(t time.Time, adjustForDST bool) []byte {
+	buf := appendSystemTime(nil, t)
+	return binary.LittleEndian.AppendUint32(buf, uint32(boolByte(adjustForDST)))
+}
+
+// appendSystemTime appends t as a SYSTEMTIME; the zero time is all zeros.
+func appendSystemTime(buf []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(buf, make([]byte, 16)...)
+	}
+	t = t.In(time.Local)
+	for _, v := range []int{
+		t.Year(), int(t.Month()), int(t.Weekday()), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / int(time.Millisecond),
+	} {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(v))
+	}
+	return buf
+}
+
+// decodeSystemTime parses a SetSystemTimeQuery payload.
+func decodeSystemTime(data []byte) (time.Time, bool, bool) {
+	if len(data) < 20 {
+		return time.Time{}, false, false
+	}
+	t, ok := readSystemTime(data)
+	return t, binary.LittleEndian.Uint32(data[16:]) != 0, ok
+}
+
+// readSystemTime parses the SYSTEMTIME at the start of data.
+func readSystemTime(data []byte) (time.Time, bool) {
+	if len(data) < 16 {
+		return time.Time{}, false
+	}
+	f := make([]int, 8)
+	for i := range f {
+		f[i] = int(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	if f[1] < 1 || f[1] > 12 || f[3] < 1 || f[3] > 31 || f[4] > 23 || f[5] > 59 || f[6] > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(f[0], time.Month(f[1]), f[3], f[4], f[5], f[6], f[7]*int(time.Millisecond), time.Local), true
+}
+
+// encodeDiscovery builds the UDP discovery reply.
+func encodeDiscovery(ip [4]byte, port int, name string) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint32(gateway.ExpectedChecksum))
+	buf.Write(ip[:])
+	binary.Write(buf, binary.LittleEndian, uint16(port))
+	buf.WriteByte(2)  // gateway type
+	buf.WriteByte(12) // gateway subtype
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+// encodeString encodes a string the way the gateway sends them: length
+// prefix, then padding to a 4-byte boundary. Unlike
+// gateway.MakeMessageString, exact multiples of 4 get no extra padding, so
+// names like "Pool" don't shift everything after them.
+func encodeString(s string) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(s)))
+	buf = append(buf, s...)
+	if pad := len(s) % 4; pad != 0 {
+		buf = append(buf, make([]byte, 4-pad)...)
+	}
+	return buf
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
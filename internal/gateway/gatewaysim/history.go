@@ -0,0 +1,120 @@
+package gatewaysim
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// History simulation. Temperatures are logged every historySampleInterval
+// at their current values; runs are recorded as the simulated equipment
+// turns on and off.
+const (
+	historySampleInterval = 30 * time.Minute
+	maxHistorySamples     = 2000
+)
+
+// Run kinds, in HistoryDataPush order.
+var runKinds = []string{"pool", "spa", "solar", "heater", "light"}
+
+// simRun is a logged run; off is zero while it is still on.
+type simRun struct {
+	on, off time.Time
+}
+
+// runState reports which kinds of equipment are on in sc.
+func runState(sc *Scenario) map[string]bool {
+	on := make(map[string]bool)
+	for _, c := range sc.Circuits {
+		if c.State == 0 {
+			continue
+		}
+		switch {
+		case c.ID == gateway.CircuitPool:
+			on["pool"] = true
+		case c.ID == gateway.CircuitSpa:
+			on["spa"] = true
+		case (&gateway.Circuit{Function: c.Function}).IsColorLight():
+			on["light"] = true
+		}
+	}
+	for _, b := range sc.Bodies {
+		// Heat status 1 is solar, 2 the heater and 3 both
+		if b.HeatStatus&1 != 0 {
+			on["solar"] = true
+		}
+		if b.HeatStatus&2 != 0 {
+			on["heater"] = true
+		}
+	}
+	return on
+}
+
+// recordRuns opens and closes runs to match the scenario. Caller must hold
+// s.mu.
+func (s *Server) recordRuns(now time.Time) {
+	// The controller logs to the millisecond
+	now = now.Truncate(time.Millisecond)
+	on := runState(s.scenario)
+	for _, kind := range runKinds {
+		runs := s.runs[kind]
+		running := len(runs) > 0 && runs[len(runs)-1].off.IsZero()
+		switch {
+		case on[kind] && !running:
+			s.runs[kind] = append(runs, simRun{on: now})
+		case !on[kind] && running:
+			runs[len(runs)-1].off = now
+		}
+	}
+}
+
+// encodeHistory builds a HistoryDataPush payload for from-to.
+func (s *Server) encodeHistory(from, to time.Time) []byte {
+	sc := s.scenario
+	now := s.now()
+	if to.After(now) {
+		to = now
+	}
+
+	var times []time.Time
+	for t := from.Truncate(historySampleInterval); !t.After(to); t = t.Add(historySampleInterval) {
+		if !t.Before(from) {
+			times = append(times, t)
+		}
+	}
+	if len(times) > maxHistorySamples {
+		times = times[len(times)-maxHistorySamples:]
+	}
+
+	pool, spa := sc.body(0), sc.body(1)
+	var buf []byte
+	for _, temp := range []func() int{
+		func() int { return sc.AirTemperature },
+		func() int { return pool.Temperature },
+		func() int { return pool.SetPoint },
+		func() int { return spa.Temperature },
+		func() int { return spa.SetPoint },
+	} {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(times)))
+		for _, t := range times {
+			buf = appendSystemTime(buf, t)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(temp())))
+		}
+	}
+
+	for _, kind := range runKinds {
+		var runs []simRun
+		for _, r := range s.runs[kind] {
+			if !r.on.After(to) && (r.off.IsZero() || r.off.After(from)) {
+				runs = append(runs, r)
+			}
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(runs)))
+		for _, r := range runs {
+			buf = appendSystemTime(buf, r.on)
+			buf = appendSystemTime(buf, r.off)
+		}
+	}
+	return buf
+}
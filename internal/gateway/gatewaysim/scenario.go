@@ -0,0 +1,288 @@
+package gatewaysim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// Scenario describes the simulated pool: its equipment and starting state.
+// Scenarios are JSON files; see testdata/home.json for an example.
+type Scenario struct {
+	Name           string          `json:"name"`
+	Version        string          `json:"version"`
+	ControllerID   uint32          `json:"controllerId"`
+	Celsius        bool            `json:"celsius"`
+	AirTemperature int             `json:"airTemperature"`
+	FreezeMode     bool            `json:"freezeMode"`
+	PoolDelay      bool            `json:"poolDelay"`
+	SpaDelay       bool            `json:"spaDelay"`
+	CleanerDelay   bool            `json:"cleanerDelay"`
+	ClockOffset    int             `json:"clockOffset"` // seconds the controller clock runs ahead of the host
+	AdjustForDST   bool            `json:"adjustForDST"`
+	RejectPushes   bool            `json:"rejectPushes"` // refuse push registration
+	FailQueries    []uint16        `json:"failQueries"`  // message codes answered with BAD_PARAMETER
+	Circuits       []CircuitSpec   `json:"circuits"`
+	Bodies         []BodySpec      `json:"bodies"`
+	Chemistry      ChemistrySpec   `json:"chemistry"`
+	Chlorinator    ChlorinatorSpec `json:"chlorinator"`
+	Pumps          []PumpSpec      `json:"pumps"`
+	Schedules      []ScheduleSpec  `json:"schedules"`
+}
+
+// CircuitSpec is a simulated circuit.
+type CircuitSpec struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Function       byte   `json:"function"`
+	Interface      byte   `json:"interface"`
+	State          int    `json:"state"`
+	ColorSet       byte   `json:"colorSet"`
+	ColorPosition  byte   `json:"colorPosition"`
+	ColorStagger   byte   `json:"colorStagger"`
+	DefaultRuntime uint16 `json:"defaultRuntime"`
+	Delay          bool   `json:"delay"`
+}
+
+// BodySpec is a simulated body of water (type 0 = pool, 1 = spa).
+type BodySpec struct {
+	Type         int `json:"type"`
+	Temperature  int `json:"temperature"`
+	SetPoint     int `json:"setPoint"`
+	CoolSetPoint int `json:"coolSetPoint"`
+	HeatMode     int `json:"heatMode"`
+	HeatStatus   int `json:"heatStatus"`
+	MinSetPoint  int `json:"minSetPoint"`
+	MaxSetPoint  int `json:"maxSetPoint"`
+}
+
+// ChemistrySpec holds the simulated chemistry readings. The fields after
+// Alarms are only reported when IntelliChem is set.
+type ChemistrySpec struct {
+	PH           float64 `json:"ph"`
+	ORP          int     `json:"orp"`
+	Saturation   float64 `json:"saturation"`
+	SaltPPM      int     `json:"saltPPM"`
+	PHTankLevel  int     `json:"phTankLevel"`
+	ORPTankLevel int     `json:"orpTankLevel"`
+	Alarms       int     `json:"alarms"`
+
+	IntelliChem      bool    `json:"intelliChem"`
+	PHSetPoint       float64 `json:"phSetPoint"`
+	ORPSetPoint      int     `json:"orpSetPoint"`
+	CalciumHardness  int     `json:"calciumHardness"`
+	CyanuricAcid     int     `json:"cyanuricAcid"`
+	TotalAlkalinity  int     `json:"totalAlkalinity"`
+	WaterTemperature int     `json:"waterTemperature"`
+	Alerts           int     `json:"alerts"`
+}
+
+// ChlorinatorSpec is a simulated salt chlorinator.
+type ChlorinatorSpec struct {
+	Installed       bool `json:"installed"`
+	Status          int  `json:"status"`
+	PoolOutput      int  `json:"poolOutput"`
+	SpaOutput       int  `json:"spaOutput"`
+	SuperChlorinate bool `json:"superChlorinate"`
+	SuperChlorHours int  `json:"superChlorHours"`
+}
+
+// PumpSpec is a simulated variable-speed pump. It runs at the fastest
+// preset whose circuit is on.
+type PumpSpec struct {
+	Index   int              `json:"index"`
+	Type    int              `json:"type"`
+	Presets []PumpPresetSpec `json:"presets"`
+}
+
+// PumpPresetSpec is the speed a pump runs at for a circuit.
+type PumpPresetSpec struct {
+	Circuit int  `json:"circuit"`
+	Speed   int  `json:"speed"`
+	IsRPM   bool `json:"isRPM"`
+}
+
+// ScheduleSpec is a schedule stored on the simulated controller. Type is
+// gateway.ScheduleRecurring or gateway.ScheduleRunOnce; times are minutes
+// after midnight.
+type ScheduleSpec struct {
+	ID           int `json:"id"`
+	Type         int `json:"type"`
+	Circuit      int `json:"circuit"`
+	Start        int `json:"start"`
+	Stop         int `json:"stop"`
+	DayMask      int `json:"dayMask"`
+	Flags        int `json:"flags"`
+	HeatMode     int `json:"heatMode"`
+	HeatSetPoint int `json:"heatSetPoint"`
+}
+
+// LoadScenario reads a scenario from a JSON file.
+func LoadScenario(path string) (*Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	var sc Scenario
+	if err := json.Unmarshal(raw, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+	if err := sc.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+
+	return &sc, nil
+}
+
+// DefaultScenario returns a typical pool and spa: the circuits from the
+// README, IntelliBrite lights, a heated spa, a salt chlorinator, one
+// variable-speed pump and a daily pool schedule.
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		Name:           "Pentair: 00-00-00",
+		Version:        "POOL: 5.2 Build 736.0 Rel",
+		ControllerID:   100,
+		AirTemperature: 68,
+		Circuits: []CircuitSpec{
+			{ID: gateway.CircuitSpa, Name: "Spa", Function: 1, Interface: 1},
+			{ID: gateway.CircuitCleaner, Name: "Cleaner", Function: 5, Interface: 0},
+			{ID: gateway.CircuitSwimJets, Name: "Swim Jets", Interface: 2},
+			{ID: gateway.CircuitPoolLight, Name: "Pool Light", Function: gateway.FunctionIntelliBrite, Interface: gateway.InterfaceLights},
+			{ID: gateway.CircuitSpaLight, Name: "Spa Light", Function: gateway.FunctionIntelliBrite, Interface: gateway.InterfaceLights},
+			{ID: gateway.CircuitPool, Name: "Pool", Function: 2, Interface: 0},
+		},
+		Bodies: []BodySpec{
+			{Type: 0, Temperature: 78, SetPoint: 80, CoolSetPoint: 100, MinSetPoint: 40, MaxSetPoint: 104},
+			{Type: 1, Temperature: 99, SetPoint: 102, CoolSetPoint: 100, HeatMode: 3, MinSetPoint: 40, MaxSetPoint: 104},
+		},
+		Chemistry: ChemistrySpec{
+			PH:           7.4,
+			ORP:          720,
+			Saturation:   -0.1,
+			SaltPPM:      3200,
+			PHTankLevel:  4,
+			ORPTankLevel: 5,
+		},
+		Chlorinator: ChlorinatorSpec{
+			Installed:  true,
+			PoolOutput: 50,
+			SpaOutput:  20,
+		},
+		Schedules: []ScheduleSpec{
+			{ID: 700, Type: gateway.ScheduleRecurring, Circuit: gateway.CircuitPool, Start: 8 * 60, Stop: 16 * 60,
+				DayMask: 0x7f, HeatMode: gateway.HeatModeDontChange},
+		},
+		Pumps: []PumpSpec{
+			{Index: 0, Type: 3, Presets: []PumpPresetSpec{
+				{Circuit: gateway.CircuitPool, Speed: 2500, IsRPM: true},
+				{Circuit: gateway.CircuitSpa, Speed: 2800, IsRPM: true},
+				{Circuit: gateway.CircuitCleaner, Speed: 3000, IsRPM: true},
+				{Circuit: gateway.CircuitSwimJets, Speed: 3450, IsRPM: true},
+			}},
+		},
+	}
+}
+
+// validate checks what the protocol cannot represent.
+func (sc *Scenario) validate() error {
+	if len(sc.Bodies) > 2 {
+		return fmt.Errorf("at most 2 bodies, got %d", len(sc.Bodies))
+	}
+	seen := make(map[int]bool)
+	for _, b := range sc.Bodies {
+		if b.Type != 0 && b.Type != 1 {
+			return fmt.Errorf("body type must be 0 (pool) or 1 (spa), got %d", b.Type)
+		}
+		if seen[b.Type] {
+			return fmt.Errorf("duplicate body type %d", b.Type)
+		}
+		seen[b.Type] = true
+	}
+
+	ids := make(map[int]bool)
+	for _, c := range sc.Circuits {
+		if ids[c.ID] {
+			return fmt.Errorf("duplicate circuit %d", c.ID)
+		}
+		ids[c.ID] = true
+	}
+
+	pumps := make(map[int]bool)
+	for _, p := range sc.Pumps {
+		if p.Index < 0 || p.Index >= gateway.MaxPumps {
+			return fmt.Errorf("pump index must be 0-%d, got %d", gateway.MaxPumps-1, p.Index)
+		}
+		if pumps[p.Index] {
+			return fmt.Errorf("duplicate pump %d", p.Index)
+		}
+		pumps[p.Index] = true
+		if len(p.Presets) > 8 {
+			return fmt.Errorf("pump %d: at most 8 presets, got %d", p.Index, len(p.Presets))
+		}
+	}
+
+	schedules := make(map[int]bool)
+	for _, e := range sc.Schedules {
+		if schedules[e.ID] {
+			return fmt.Errorf("duplicate schedule %d", e.ID)
+		}
+		schedules[e.ID] = true
+	}
+	return nil
+}
+
+// circuit returns the circuit with id, or nil.
+func (sc *Scenario) circuit(id int) *CircuitSpec {
+	for i := range sc.Circuits {
+		if sc.Circuits[i].ID == id {
+			return &sc.Circuits[i]
+		}
+	}
+	return nil
+}
+
+// pump returns the pump at index, or nil.
+func (sc *Scenario) pump(index int) *PumpSpec {
+	for i := range sc.Pumps {
+		if sc.Pumps[i].Index == index {
+			return &sc.Pumps[i]
+		}
+	}
+	return nil
+}
+
+// schedule returns the index of the schedule with id, or -1.
+func (sc *Scenario) schedule(id int) int {
+	for i := range sc.Schedules {
+		if sc.Schedules[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// body returns the body of the given type, or nil.
+func (sc *Scenario) body(bodyType int) *BodySpec {
+	for i := range sc.Bodies {
+		if sc.Bodies[i].Type == bodyType {
+			return &sc.Bodies[i]
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of sc.
+func (sc *Scenario) clone() *Scenario {
+	c := *sc
+	c.Circuits = append([]CircuitSpec(nil), sc.Circuits...)
+	c.Bodies = append([]BodySpec(nil), sc.Bodies...)
+	c.Schedules = append([]ScheduleSpec(nil), sc.Schedules...)
+	c.Pumps = append([]PumpSpec(nil), sc.Pumps...)
+	for i := range c.Pumps {
+		c.Pumps[i].Presets = append([]PumpPresetSpec(nil), c.Pumps[i].Presets...)
+	}
+	return &c
+}
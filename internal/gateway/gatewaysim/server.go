@@ -0,0 +1,540 @@
+package gatewaysim
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// firstScheduleID is the ID the controller gives its first schedule.
+const firstScheduleID = 700
+
+// simulatedMAC is returned in the challenge answer, as a real adapter does.
+const simulatedMAC = "00-C0-33-00-00-00"
+
+// Server is a fake ScreenLogic gateway. It speaks enough of the protocol
+// for the Bridge: connect string, challenge and login, version, clock,
+// config, status, history, chemistry, chlorinator, pumps, schedules, button
+// presses, heat and light commands, and push registration. Every change is pushed to
+// registered clients as a StatusChangedPush (and a ChemistryChangedPush with
+// an IntelliChem).
+type Server struct {
+	// AdvertiseIP is the address sent in discovery replies. It defaults to
+	// the TCP listen address, or 127.0.0.1 when listening on all interfaces.
+	AdvertiseIP string
+
+	mu           sync.Mutex
+	scenario     *Scenario
+	lightCommand int
+	runs         map[string][]simRun
+	conns        map[*simConn]bool
+	listener     net.Listener
+	udp          *net.UDPConn
+	logger       *log.Logger
+	wg           sync.WaitGroup
+	now          func() time.Time // the controller's clock; tests may fix it
+}
+
+// simConn is one client connection.
+type simConn struct {
+	net.Conn
+	writeMu    sync.Mutex
+	subscribed bool // guarded by Server.mu
+}
+
+// write sends msg, serialized with pushes from other goroutines.
+func (c *simConn) write(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Write(msg)
+	return err
+}
+
+// NewServer creates a simulator in the state described by sc. The
+// scenario is copied, so sc itself is never modified.
+func NewServer(sc *Scenario) *Server {
+	s := &Server{
+		scenario:     sc.clone(),
+		lightCommand: -1,
+		runs:         make(map[string][]simRun),
+		conns:        make(map[*simConn]bool),
+		logger:       log.New(os.Stdout, "[gatewaysim] ", log.LstdFlags),
+		now:          time.Now,
+	}
+	s.recordRuns(s.now())
+	return s
+}
+
+// Listen starts accepting gateway connections on addr (e.g. "127.0.0.1:0").
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.accept(l)
+	return nil
+}
+
+// ListenDiscovery answers UDP discovery packets on addr (e.g. ":1444").
+// Listen must be called first so the reply can carry the TCP port.
+func (s *Server) ListenDiscovery(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.udp = conn
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.serveDiscovery(conn)
+	return nil
+}
+
+// Addr returns the TCP address the server listens on.
+func (s *Server) Addr() *net.TCPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
+// DiscoveryAddr returns the UDP address discovery is answered on.
+func (s *Server) DiscoveryAddr() *net.UDPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.udp.LocalAddr().(*net.UDPAddr)
+}
+
+// Close stops listening and drops every client.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// DropConnections closes every client connection, as a gateway reboot would.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Scenario returns a copy of the current simulated state.
+func (s *Server) Scenario() *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenario.clone()
+}
+
+// Update changes the simulated state, e.g. to mimic someone pressing a
+// button at the pool, and pushes the new status to registered clients.
+func (s *Server) Update(fn func(sc *Scenario)) {
+	s.mu.Lock()
+	fn(s.scenario)
+	s.mu.Unlock()
+
+	s.pushStatus()
+}
+
+// LightCommand returns the last color light command received, or -1.
+func (s *Server) LightCommand() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lightCommand
+}
+
+// accept serves connections until the listener closes.
+func (s *Server) accept(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &simConn{Conn: conn}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// serve runs one client session.
+func (s *Server) serve(c *simConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	connect := make([]byte, len(gateway.ConnectString))
+	if _, err := io.ReadFull(c, connect); err != nil || string(connect) != gateway.ConnectString {
+		return
+	}
+	s.logger.Printf("Client connected from %s", c.RemoteAddr())
+
+	loggedIn := false
+	for {
+		msg, err := gateway.ReadMessage(c)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Printf("Client %s: %v", c.RemoteAddr(), err)
+			}
+			return
+		}
+		code := binary.LittleEndian.Uint16(msg[2:4])
+		data := msg[gateway.HeaderSize:]
+
+		var answer []byte
+		changed := false
+		switch {
+		case code == gateway.ChallengeQuery:
+			answer = gateway.MakeMessage(gateway.ChallengeAnswer, encodeString(simulatedMAC))
+		case code == gateway.LocalLoginQuery:
+			loggedIn = true
+			answer = gateway.MakeMessage(gateway.LocalLoginAnswer, nil)
+		case !loggedIn:
+			answer = gateway.MakeMessage(gateway.InvalidRequestAnswer, nil)
+		default:
+			answer, changed = s.handle(c, code, data)
+		}
+
+		if err := c.write(answer); err != nil {
+			return
+		}
+		if changed {
+			s.pushStatus()
+		}
+	}
+}
+
+// handle answers a query from a logged-in client. It reports whether the
+// simulated state changed.
+func (s *Server) handle(c *simConn, code uint16, data []byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.scenario
+	if slices.Contains(sc.FailQueries, code) {
+		s.logger.Printf("Failing message %d", code)
+		return badParameter(), false
+	}
+
+	switch code {
+	case gateway.VersionQuery:
+		return gateway.MakeMessage(gateway.VersionAnswer, encodeString(sc.Version)), false
+
+	case gateway.SystemTimeQuery:
+		now := s.now().Add(time.Duration(sc.ClockOffset) * time.Second)
+		return gateway.MakeMessage(gateway.SystemTimeAnswer, encodeSystemTime(now, sc.AdjustForDST)), false
+
+	case gateway.SetSystemTimeQuery:
+		t, adjustForDST, ok := decodeSystemTime(data)
+		if !ok {
+			return badParameter(), false
+		}
+		sc.ClockOffset = int(time.Until(t).Round(time.Second) / time.Second)
+		sc.AdjustForDST = adjustForDST
+		s.logger.Printf("Clock set to %s (DST adjust %t)", t.Format("2006-01-02 15:04:05"), adjustForDST)
+		return gateway.MakeMessage(gateway.SetSystemTimeAnswer, nil), false
+
+	case gateway.HistoryQuery:
+		// Padding, from and to SYSTEMTIMEs, client ID
+		if len(data) < 40 {
+			return badParameter(), false
+		}
+		from, okFrom := readSystemTime(data[4:])
+		to, okTo := readSystemTime(data[20:])
+		if !okFrom || !okTo || to.Before(from) {
+			return badParameter(), false
+		}
+		// The data follows the acknowledgement as a separate message
+		answer := gateway.MakeMessage(gateway.HistoryAnswer, nil)
+		return append(answer, gateway.MakeMessage(gateway.HistoryDataPush, s.encodeHistory(from, to))...), false
+
+	case gateway.CtrlConfigQuery:
+		return gateway.MakeMessage(gateway.CtrlConfigAnswer, encodeConfig(sc)), false
+
+	case gateway.PoolStatusQuery:
+		return gateway.MakeMessage(gateway.PoolStatusAnswer, encodeStatus(sc)), false
+
+	case gateway.ChemistryQuery:
+		return gateway.MakeMessage(gateway.ChemistryAnswer, encodeChemistry(sc)), false
+
+	case gateway.SCGConfigQuery:
+		return gateway.MakeMessage(gateway.SCGConfigAnswer, encodeSCG(sc)), false
+
+	case gateway.SetSCGQuery:
+		args, ok := readArgs(data, 5)
+		scg := &sc.Chlorinator
+		if !ok || !scg.Installed || args[1] > 100 || args[2] > 100 || args[3] > 1 || args[4] > gateway.MaxSuperChlorHours {
+			return badParameter(), false
+		}
+		scg.PoolOutput, scg.SpaOutput = int(args[1]), int(args[2])
+		scg.SuperChlorinate, scg.SuperChlorHours = args[3] == 1, int(args[4])
+		s.logger.Printf("Chlorinator -> pool %d%%, spa %d%%, super chlorinate %v (%dh)",
+			scg.PoolOutput, scg.SpaOutput, scg.SuperChlorinate, scg.SuperChlorHours)
+		return gateway.MakeMessage(gateway.SetSCGAnswer, nil), true
+
+	case gateway.PumpStatusQuery:
+		args, ok := readArgs(data, 2)
+		pump := sc.pump(int(args[1]))
+		if !ok || pump == nil {
+			return badParameter(), false
+		}
+		return gateway.MakeMessage(gateway.PumpStatusAnswer, encodePump(sc, pump)), false
+
+	case gateway.SetPumpFlowQuery:
+		args, ok := readArgs(data, 5)
+		pump := sc.pump(int(args[1]))
+		if !ok || pump == nil || int(args[2]) >= len(pump.Presets) {
+			return badParameter(), false
+		}
+		preset := &pump.Presets[args[2]]
+		preset.Speed, preset.IsRPM = int(args[3]), args[4] == 1
+		s.logger.Printf("Pump %d circuit %d -> %d %s", pump.Index, preset.Circuit, preset.Speed, speedUnit(preset.IsRPM))
+		return gateway.MakeMessage(gateway.SetPumpFlowAnswer, nil), true
+
+	case gateway.ScheduleQuery:
+		args, ok := readArgs(data, 2)
+		if !ok || args[1] > gateway.ScheduleRunOnce {
+			return badParameter(), false
+		}
+		return gateway.MakeMessage(gateway.ScheduleAnswer, encodeSchedules(sc, int(args[1]))), false
+
+	case gateway.AddScheduleQuery:
+		args, ok := readArgs(data, 2)
+		if !ok || args[1] > gateway.ScheduleRunOnce {
+			return badParameter(), false
+		}
+		id := firstScheduleID
+		for _, e := range sc.Schedules {
+			id = max(id, e.ID+1)
+		}
+		sc.Schedules = append(sc.Schedules, ScheduleSpec{ID: id, Type: int(args[1]), HeatMode: gateway.HeatModeDontChange})
+		s.logger.Printf("Schedule %d added", id)
+		return gateway.MakeMessage(gateway.AddScheduleAnswer, binary.LittleEndian.AppendUint32(nil, uint32(id))), false
+
+	case gateway.DeleteScheduleQuery:
+		args, ok := readArgs(data, 2)
+		i := sc.schedule(int(args[1]))
+		if !ok || i < 0 {
+			return badParameter(), false
+		}
+		sc.Schedules = append(sc.Schedules[:i], sc.Schedules[i+1:]...)
+		s.logger.Printf("Schedule %d deleted", args[1])
+		return gateway.MakeMessage(gateway.DeleteScheduleAnswer, nil), false
+
+	case gateway.SetScheduleQuery:
+		args, ok := readArgs(data, 9)
+		i := sc.schedule(int(args[1]))
+		if !ok || i < 0 || sc.circuit(int(args[2])) == nil || args[3] >= 24*60 || args[4] >= 24*60 ||
+			int(args[7]) >= len(gateway.HeatMode) {
+			return badParameter(), false
+		}
+		e := &sc.Schedules[i]
+		e.Circuit, e.Start, e.Stop = int(args[2]), int(args[3]), int(args[4])
+		e.DayMask, e.Flags, e.HeatMode, e.HeatSetPoint = int(args[5]), int(args[6]), int(args[7]), int(args[8])
+		s.logger.Printf("Schedule %d -> circuit %d %02d:%02d-%02d:%02d days 0x%02x",
+			e.ID, e.Circuit, e.Start/60, e.Start%60, e.Stop/60, e.Stop%60, e.DayMask)
+		return gateway.MakeMessage(gateway.SetScheduleAnswer, nil), false
+
+	case gateway.ButtonPressQuery:
+		args, ok := readArgs(data, 3)
+		circuit := sc.circuit(int(args[1]))
+		if !ok || circuit == nil || args[2] > 1 {
+			return badParameter(), false
+		}
+		circuit.State = int(args[2])
+		s.logger.Printf("Circuit %d (%s) -> %s", circuit.ID, circuit.Name, gateway.OnOff[circuit.State])
+		return gateway.MakeMessage(gateway.ButtonPressAnswer, nil), true
+
+	case gateway.SetHeatSetPointQuery:
+		args, ok := readArgs(data, 3)
+		body := sc.body(int(args[1]))
+		temp := int(int32(args[2]))
+		if !ok || body == nil || temp < body.MinSetPoint || temp > body.MaxSetPoint {
+			return badParameter(), false
+		}
+		body.SetPoint = temp
+		s.logger.Printf("%s set point -> %d", gateway.BodyType[body.Type], temp)
+		return gateway.MakeMessage(gateway.SetHeatSetPointAnswer, nil), true
+
+	case gateway.SetHeatModeQuery:
+		args, ok := readArgs(data, 3)
+		body := sc.body(int(args[1]))
+		if !ok || body == nil || int(args[2]) >= len(gateway.HeatMode) {
+			return badParameter(), false
+		}
+		if int(args[2]) != gateway.HeatModeDontChange {
+			body.HeatMode = int(args[2])
+			s.logger.Printf("%s heat mode -> %s", gateway.BodyType[body.Type], gateway.HeatMode[body.HeatMode])
+		}
+		return gateway.MakeMessage(gateway.SetHeatModeAnswer, nil), true
+
+	case gateway.ColorLightsQuery:
+		args, ok := readArgs(data, 2)
+		if !ok || int(args[1]) >= len(gateway.ColorMode) {
+			return badParameter(), false
+		}
+		s.lightCommand = int(args[1])
+		s.logger.Printf("Light command -> %s", gateway.ColorMode[s.lightCommand])
+
+		// Off and On switch every color light; shows leave them as they are
+		if s.lightCommand <= 1 {
+			for i := range sc.Circuits {
+				if isColorLight(sc.Circuits[i]) {
+					sc.Circuits[i].State = s.lightCommand
+				}
+			}
+		}
+		return gateway.MakeMessage(gateway.ColorLightsAnswer, nil), true
+
+	case gateway.AddClientQuery:
+		if sc.RejectPushes {
+			return badParameter(), false
+		}
+		c.subscribed = true
+		return gateway.MakeMessage(gateway.AddClientAnswer, nil), false
+
+	case gateway.RemoveClientQuery:
+		c.subscribed = false
+		return gateway.MakeMessage(gateway.RemoveClientAnswer, nil), false
+	}
+
+	s.logger.Printf("Unsupported message %d", code)
+	return gateway.MakeMessage(gateway.UnknownAnswer, nil), false
+}
+
+// pushStatus sends the current status (and chemistry) to every registered
+// client.
+func (s *Server) pushStatus() {
+	s.mu.Lock()
+	s.recordRuns(s.now())
+	msgs := [][]byte{gateway.MakeMessage(gateway.StatusChangedPush, encodeStatus(s.scenario))}
+	if s.scenario.Chemistry.IntelliChem {
+		msgs = append(msgs, gateway.MakeMessage(gateway.ChemistryChangedPush, encodeChemistry(s.scenario)))
+	}
+	var targets []*simConn
+	for c := range s.conns {
+		if c.subscribed {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range targets {
+		for _, msg := range msgs {
+			c.write(msg)
+		}
+	}
+}
+
+// serveDiscovery answers discovery packets until conn closes.
+func (s *Server) serveDiscovery(conn *net.UDPConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, 64)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < 8 || buf[0] != 1 {
+			continue
+		}
+
+		s.mu.Lock()
+		tcp := s.listener.Addr().(*net.TCPAddr)
+		ip := s.advertiseIP(tcp)
+		reply := encodeDiscovery(ip, tcp.Port, s.scenario.Name)
+		s.mu.Unlock()
+
+		conn.WriteToUDP(reply, from)
+	}
+}
+
+// advertiseIP picks the IPv4 address to put in discovery replies. Caller
+// must hold s.mu.
+func (s *Server) advertiseIP(tcp *net.TCPAddr) [4]byte {
+	ip := net.ParseIP(s.AdvertiseIP)
+	if ip == nil && !tcp.IP.IsUnspecified() {
+		ip = tcp.IP
+	}
+	var out [4]byte
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(out[:], ip4)
+	} else {
+		out = [4]byte{127, 0, 0, 1}
+	}
+	return out
+}
+
+// readArgs decodes n little-endian uint32 arguments. The slice is always n
+// long so callers can index it before checking ok.
+func readArgs(data []byte, n int) ([]uint32, bool) {
+	args := make([]uint32, n)
+	if len(data) < 4*n {
+		return args, false
+	}
+	for i := range args {
+		args[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return args, true
+}
+
+// badParameter is the gateway's answer to out-of-range values.
+func badParameter() []byte {
+	return gateway.MakeMessage(gateway.BadParameterAnswer, nil)
+}
+
+// speedUnit names the unit of a pump speed.
+func speedUnit(isRPM bool) string {
+	if isRPM {
+		return "RPM"
+	}
+	return "GPM"
+}
+
+// isColorLight matches gateway.Circuit.IsColorLight.
+func isColorLight(c CircuitSpec) bool {
+	circuit := gateway.Circuit{Function: c.Function, Interface: c.Interface, ColorSet: c.ColorSet}
+	return circuit.IsColorLight()
+}
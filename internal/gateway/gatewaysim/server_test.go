@@ -0,0 +1,392 @@
+package gatewaysim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+const testTimeout = 2 * time.Second
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	sc, err := LoadScenario("testdata/home.json")
+	if err != nil {
+		t.Fatalf("LoadScenario() error = %v", err)
+	}
+
+	s := NewServer(sc)
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	if err := s.ListenDiscovery("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenDiscovery() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func connect(t *testing.T, s *Server) *gateway.Session {
+	t.Helper()
+	session := gateway.NewSession("127.0.0.1", s.Addr().Port, testTimeout)
+	session.Start()
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestDiscovery(t *testing.T) {
+	s := startServer(t)
+
+	info, err := gateway.DiscoverGatewayAt(s.DiscoveryAddr().String(), testTimeout)
+	if err != nil {
+		t.Fatalf("DiscoverGatewayAt() error = %v", err)
+	}
+	if info.IP != "127.0.0.1" || info.Port != s.Addr().Port || info.Name != "Pentair: 12-34-56" {
+		t.Errorf("discovered %+v", info)
+	}
+}
+
+func TestConfigAndStatus(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	version, err := gateway.QueryVersion(session, testTimeout)
+	if err != nil || version != "POOL: 5.2 Build 736.0 Rel" {
+		t.Errorf("QueryVersion() = %q, %v", version, err)
+	}
+
+	data := gateway.NewPoolData()
+	if err := gateway.QueryConfig(session, data, testTimeout); err != nil {
+		t.Fatalf("QueryConfig() error = %v", err)
+	}
+	if err := gateway.QueryStatus(session, data, testTimeout); err != nil {
+		t.Fatalf("QueryStatus() error = %v", err)
+	}
+
+	if len(data.Circuits) != 6 || data.Circuits[gateway.CircuitSwimJets].Name != "Swim Jets" {
+		t.Errorf("circuits = %d, swim jets = %+v", len(data.Circuits), data.Circuits[gateway.CircuitSwimJets])
+	}
+	if !data.Circuits[gateway.CircuitPoolLight].IsColorLight() {
+		t.Error("pool light should be a color light")
+	}
+	if data.Circuits[gateway.CircuitPool].State != 1 {
+		t.Error("pool should be on")
+	}
+	if data.Config.MaxSetPoint[1] != 104 {
+		t.Errorf("spa max set point = %d, want 104", data.Config.MaxSetPoint[1])
+	}
+	if spa := data.Bodies[1]; spa.CurrentTemperature != 101 || spa.HeatSetPoint != 102 || spa.HeatMode != 3 {
+		t.Errorf("spa = %+v", spa)
+	}
+	if data.Chemistry.PH != 7.5 || data.Chemistry.SaltPPM != 3100 {
+		t.Errorf("chemistry = %+v", data.Chemistry)
+	}
+	if data.Sensors["air_temperature"].State != 64 {
+		t.Errorf("air temperature = %v", data.Sensors["air_temperature"].State)
+	}
+}
+
+func TestChemistry(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+	s.Update(func(sc *Scenario) {
+		sc.Chemistry.Saturation = -0.3
+		sc.Chemistry.Alarms = gateway.ChemAlarmFlow | gateway.ChemAlarmORPLow
+		sc.Chemistry.Alerts = gateway.ChemAlertPHLockout
+	})
+
+	data := gateway.NewPoolData()
+	if err := gateway.QueryConfig(session, data, testTimeout); err != nil {
+		t.Fatalf("QueryConfig() error = %v", err)
+	}
+	if !data.Config.HasIntelliChem() {
+		t.Fatal("HasIntelliChem() = false, want true")
+	}
+	if err := gateway.QueryChemistry(session, data, testTimeout); err != nil {
+		t.Fatalf("QueryChemistry() error = %v", err)
+	}
+
+	want := gateway.ChemistryData{
+		PH: 7.5, ORP: 680, Saturation: -0.3, SaltPPM: 3100, PHTankLevel: 3, ORPTankLevel: 6,
+		Alarms:      gateway.ChemAlarmFlow | gateway.ChemAlarmORPLow,
+		IntelliChem: true, PHSetPoint: 7.6, ORPSetPoint: 700,
+		CalciumHardness: 300, CyanuricAcid: 40, TotalAlkalinity: 90, WaterTemperature: 77,
+		Alerts: gateway.ChemAlertPHLockout, Firmware: "1.000",
+	}
+	if data.Chemistry != want {
+		t.Errorf("chemistry = %+v\nwant %+v", data.Chemistry, want)
+	}
+}
+
+func TestChlorinator(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	data := gateway.NewPoolData()
+	if err := gateway.QuerySCG(session, data, testTimeout); err != nil {
+		t.Fatalf("QuerySCG() error = %v", err)
+	}
+	want := gateway.SCGData{Installed: true, Status: 1, PoolOutput: 40, SpaOutput: 10, SaltPPM: 3100}
+	if data.SCG != want {
+		t.Errorf("SCG = %+v, want %+v", data.SCG, want)
+	}
+
+	if err := gateway.SetSCG(session, 60, 10, true, 12, testTimeout); err != nil {
+		t.Fatalf("SetSCG() error = %v", err)
+	}
+	if err := gateway.QuerySCG(session, data, testTimeout); err != nil {
+		t.Fatalf("QuerySCG() error = %v", err)
+	}
+	if !data.SCG.SuperChlorinating() || data.SCG.SuperChlorHours != 12 || data.SCG.PoolOutput != 60 {
+		t.Errorf("SCG after set = %+v", data.SCG)
+	}
+
+	if err := gateway.SetSCG(session, 101, 10, false, 0, testTimeout); err == nil {
+		t.Error("SetSCG() should reject output over 100%")
+	}
+}
+
+func TestPumps(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	data := gateway.NewPoolData()
+	if err := gateway.QueryConfig(session, data, testTimeout); err != nil {
+		t.Fatalf("QueryConfig() error = %v", err)
+	}
+	if got := data.Config.PumpIndexes(); len(got) != 1 || got[0] != 0 {
+		t.Fatalf("PumpIndexes() = %v, want [0]", got)
+	}
+
+	// Only the pool is on, so the pump runs at the pool speed
+	if err := gateway.QueryPump(session, data, 0, testTimeout); err != nil {
+		t.Fatalf("QueryPump() error = %v", err)
+	}
+	pump := data.Pumps[0]
+	if !pump.Running || pump.RPM != 2400 || pump.Watts == 0 || pump.TypeName() != "IntelliFlo VSF" {
+		t.Errorf("pump = %+v", pump)
+	}
+	if p := pump.Presets[3]; p.CircuitID != gateway.CircuitSwimJets || p.SetPoint != 60 || p.IsRPM {
+		t.Errorf("swim jets preset = %+v", p)
+	}
+
+	if err := gateway.SetPumpSpeed(session, 0, 0, 2000, true, testTimeout); err != nil {
+		t.Fatalf("SetPumpSpeed() error = %v", err)
+	}
+	if err := gateway.QueryPump(session, data, 0, testTimeout); err != nil {
+		t.Fatalf("QueryPump() error = %v", err)
+	}
+	if data.Pumps[0].RPM != 2000 || data.Pumps[0].Presets[0].SetPoint != 2000 {
+		t.Errorf("pump after speed change = %+v", data.Pumps[0])
+	}
+
+	if err := gateway.QueryPump(session, data, 5, testTimeout); err == nil {
+		t.Error("QueryPump() should fail for a missing pump")
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	events, err := gateway.QuerySchedules(session, gateway.ScheduleRecurring, testTimeout)
+	if err != nil {
+		t.Fatalf("QuerySchedules() error = %v", err)
+	}
+	if len(events) != 2 || events[1].CircuitID != gateway.CircuitCleaner || events[1].StartMinutes != 600 || events[1].DayMask != 9 {
+		t.Fatalf("recurring schedules = %+v", events)
+	}
+
+	id, err := gateway.AddSchedule(session, gateway.ScheduleRunOnce, testTimeout)
+	if err != nil {
+		t.Fatalf("AddSchedule() error = %v", err)
+	}
+	if id != 702 {
+		t.Errorf("AddSchedule() = %d, want 702", id)
+	}
+	event := gateway.ScheduleEvent{ID: id, CircuitID: gateway.CircuitSpa, StartMinutes: 19 * 60, StopMinutes: 21 * 60,
+		DayMask: 0x10, Flags: gateway.ScheduleFlagRunOnce, HeatMode: 3, HeatSetPoint: 102}
+	if err := gateway.SetSchedule(session, event, testTimeout); err != nil {
+		t.Fatalf("SetSchedule() error = %v", err)
+	}
+	events, err = gateway.QuerySchedules(session, gateway.ScheduleRunOnce, testTimeout)
+	if err != nil {
+		t.Fatalf("QuerySchedules() error = %v", err)
+	}
+	if len(events) != 1 || events[0] != event {
+		t.Errorf("run-once schedules = %+v, want [%+v]", events, event)
+	}
+
+	event.StopMinutes = 24 * 60
+	if err := gateway.SetSchedule(session, event, testTimeout); err == nil {
+		t.Error("SetSchedule() should reject a stop time past midnight")
+	}
+
+	if err := gateway.DeleteSchedule(session, id, testTimeout); err != nil {
+		t.Fatalf("DeleteSchedule() error = %v", err)
+	}
+	if err := gateway.DeleteSchedule(session, id, testTimeout); err == nil {
+		t.Error("DeleteSchedule() should fail for a missing schedule")
+	}
+}
+
+func TestClock(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	// home.json runs the controller clock seven minutes slow
+	st, err := gateway.QuerySystemTime(session, testTimeout)
+	if err != nil {
+		t.Fatalf("QuerySystemTime() error = %v", err)
+	}
+	if drift := time.Since(st.Time); drift < 6*time.Minute || drift > 8*time.Minute || !st.AdjustForDST {
+		t.Errorf("QuerySystemTime() = %+v, %s behind", st, drift)
+	}
+
+	if err := gateway.SetSystemTime(session, time.Now(), false, testTimeout); err != nil {
+		t.Fatalf("SetSystemTime() error = %v", err)
+	}
+	if sc := s.Scenario(); sc.ClockOffset < -1 || sc.ClockOffset > 1 || sc.AdjustForDST {
+		t.Errorf("clock offset = %ds, adjustForDST = %t after set", sc.ClockOffset, sc.AdjustForDST)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	// Pin the controller clock to half a minute past :29, where the six-hour
+	// window ends just before a sample and so holds 11 rather than 12
+	now := time.Now().Truncate(historySampleInterval).Add(historySampleInterval + 29*time.Minute + 30*time.Second)
+	s.mu.Lock()
+	s.now = func() time.Time { return now }
+	s.mu.Unlock()
+
+	// The pool has been on since the server started; run the spa briefly
+	if err := gateway.SetCircuit(session, gateway.CircuitSpa, 1, testTimeout); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if err := gateway.SetCircuit(session, gateway.CircuitSpa, 0, testTimeout); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+
+	to := now.Add(time.Minute)
+	h, err := gateway.QueryHistory(session, to.Add(-6*time.Hour), to, session.ClientID(), testTimeout)
+	if err != nil {
+		t.Fatalf("QueryHistory() error = %v", err)
+	}
+	if n := len(h.AirTemps); n != 11 || h.AirTemps[0].Temperature != 64 {
+		t.Errorf("AirTemps = %d samples, first %+v", n, h.AirTemps[0])
+	}
+	if len(h.PoolTemps) != len(h.AirTemps) || h.SpaSetPoints[0].Temperature != 102 {
+		t.Errorf("PoolTemps = %d samples, SpaSetPoints[0] = %+v", len(h.PoolTemps), h.SpaSetPoints[0])
+	}
+	if len(h.PoolRuns) != 1 || !h.PoolRuns[0].Off.IsZero() {
+		t.Errorf("PoolRuns = %+v, want one run still on", h.PoolRuns)
+	}
+	if len(h.SpaRuns) != 1 || h.SpaRuns[0].Off.IsZero() {
+		t.Errorf("SpaRuns = %+v, want one finished run", h.SpaRuns)
+	}
+
+	// The session keeps working after the follow-up message
+	if _, err := gateway.QueryVersion(session, testTimeout); err != nil {
+		t.Errorf("QueryVersion() after history error = %v", err)
+	}
+
+	if _, err := gateway.QueryHistory(session, to, to.Add(-time.Hour), session.ClientID(), testTimeout); err == nil {
+		t.Error("QueryHistory() should fail for a reversed range")
+	}
+}
+
+func TestButtonPressPushesStatus(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	// Connect first so Subscribe registers before the button press
+	if _, err := gateway.QueryVersion(session, testTimeout); err != nil {
+		t.Fatalf("QueryVersion() error = %v", err)
+	}
+	pushes := make(chan []byte, 4)
+	if err := session.Subscribe(func(msg []byte, _ time.Time) { pushes <- msg }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if err := gateway.SetCircuit(session, gateway.CircuitSpa, 1, testTimeout); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if s.Scenario().circuit(gateway.CircuitSpa).State != 1 {
+		t.Error("simulated spa should be on")
+	}
+
+	select {
+	case msg := <-pushes:
+		data := gateway.NewPoolData()
+		data.Circuits[gateway.CircuitSpa] = &gateway.Circuit{ID: gateway.CircuitSpa}
+		if _, err := gateway.ApplyPush(msg, data); err != nil || data.Circuits[gateway.CircuitSpa].State != 1 {
+			t.Errorf("push did not carry spa on (err %v)", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no status push after button press")
+	}
+
+	if err := gateway.SetCircuit(session, 999, 1, testTimeout); err == nil {
+		t.Error("SetCircuit() on unknown circuit should fail")
+	}
+}
+
+func TestHeatAndLights(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	if err := gateway.SetHeatSetPoint(session, 1, 104, testTimeout); err != nil {
+		t.Fatalf("SetHeatSetPoint() error = %v", err)
+	}
+	if err := gateway.SetHeatSetPoint(session, 1, 120, testTimeout); err == nil {
+		t.Error("SetHeatSetPoint() above max should fail")
+	}
+	if err := gateway.SetHeatMode(session, 0, 1, testTimeout); err != nil {
+		t.Fatalf("SetHeatMode() error = %v", err)
+	}
+
+	caribbean, _ := gateway.ColorModeByName("caribbean")
+	if err := gateway.SendLightCommand(session, caribbean, testTimeout); err != nil {
+		t.Fatalf("SendLightCommand() error = %v", err)
+	}
+	if err := gateway.SendLightCommand(session, 1, testTimeout); err != nil {
+		t.Fatalf("SendLightCommand(on) error = %v", err)
+	}
+
+	sc := s.Scenario()
+	if sc.body(1).SetPoint != 104 || sc.body(0).HeatMode != 1 {
+		t.Errorf("bodies = %+v", sc.Bodies)
+	}
+	if s.LightCommand() != 1 || sc.circuit(gateway.CircuitPoolLight).State != 1 || sc.circuit(gateway.CircuitSwimJets).State != 0 {
+		t.Error("light on should switch only the color lights")
+	}
+}
+
+func TestUnsupportedMessage(t *testing.T) {
+	s := startServer(t)
+	session := connect(t, s)
+
+	resp, err := session.Send(12600, nil, testTimeout)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if code, _, _ := gateway.DecodeMessage(resp); code != gateway.UnknownAnswer {
+		t.Errorf("answer code = %d, want UnknownAnswer", code)
+	}
+}
+
+func TestLoadScenarioInvalid(t *testing.T) {
+	sc := DefaultScenario()
+	sc.Circuits = append(sc.Circuits, sc.Circuits[0])
+	if err := sc.validate(); err == nil {
+		t.Error("duplicate circuit should be rejected")
+	}
+
+	if _, err := LoadScenario("testdata/missing.json"); err == nil {
+		t.Error("LoadScenario() of a missing file should fail")
+	}
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// TemperatureSample is one logged temperature.
+type TemperatureSample struct {
+	Time        time.Time
+	Temperature int
+}
+
+// Run is a period a circuit or heater was on. Off is zero for a run still
+// in progress.
+type Run struct {
+	On  time.Time
+	Off time.Time
+}
+
+// HistoryData is the controller's log over a time range. Times are local.
+type HistoryData struct {
+	AirTemps      []TemperatureSample
+	PoolTemps     []TemperatureSample
+	PoolSetPoints []TemperatureSample
+	SpaTemps      []TemperatureSample
+	SpaSetPoints  []TemperatureSample
+	PoolRuns      []Run
+	SpaRuns       []Run
+	SolarRuns     []Run
+	HeaterRuns    []Run
+	LightRuns     []Run
+}
+
+// QueryHistory fetches the controller's log between from and to. The
+// gateway acknowledges the query and then sends the data to clientID as a
+// HistoryDataPush, which can take several seconds on a busy week.
+func QueryHistory(conn FollowSender, from, to time.Time, clientID uint32, timeout time.Duration) (*HistoryData, error) {
+	// Payload: padding (4 bytes), from (SYSTEMTIME), to (SYSTEMTIME), client ID (4 bytes)
+	payload := make([]byte, 4, 4+2*systemTimeSize+4)
+	payload = appendSystemTime(payload, from.In(time.Local))
+	payload = appendSystemTime(payload, to.In(time.Local))
+	payload = binary.LittleEndian.AppendUint32(payload, clientID)
+
+	resp, err := conn.SendFollowed(HistoryQuery, payload, HistoryDataPush, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return nil, err
+	}
+	if code != HistoryDataPush {
+		return nil, fmt.Errorf("unexpected history response code: %d", code)
+	}
+
+	return decodeHistory(buf)
+}
+
+// decodeHistory decodes a HistoryDataPush: five temperature lists (air,
+// pool, pool set point, spa, spa set point) then five run lists (pool, spa,
+// solar, heater, light), each prefixed with its count.
+func decodeHistory(buf []byte) (*HistoryData, error) {
+	h := &HistoryData{}
+	offset := 0
+	var err error
+
+	for _, samples := range []*[]TemperatureSample{
+		&h.AirTemps, &h.PoolTemps, &h.PoolSetPoints, &h.SpaTemps, &h.SpaSetPoints,
+	} {
+		*samples, offset, err = getTemperatureSamples(buf, offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, runs := range []*[]Run{
+		&h.PoolRuns, &h.SpaRuns, &h.SolarRuns, &h.HeaterRuns, &h.LightRuns,
+	} {
+		*runs, offset, err = getRuns(buf, offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// getTemperatureSamples reads a count and that many (SYSTEMTIME, int32)
+// samples.
+func getTemperatureSamples(buf []byte, offset int) ([]TemperatureSample, int, error) {
+	count, offset, err := getHistoryCount(buf, offset, systemTimeSize+4)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	samples := make([]TemperatureSample, 0, count)
+	for range count {
+		var s TemperatureSample
+		if s.Time, offset, err = getSystemTime(buf, offset); err != nil {
+			return nil, offset, err
+		}
+		var temp int32
+		temp, offset = GetInt32(buf, offset)
+		s.Temperature = int(temp)
+		samples = append(samples, s)
+	}
+	return samples, offset, nil
+}
+
+// getRuns reads a count and that many (on, off) SYSTEMTIME pairs.
+func getRuns(buf []byte, offset int) ([]Run, int, error) {
+	count, offset, err := getHistoryCount(buf, offset, 2*systemTimeSize)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	runs := make([]Run, 0, count)
+	for range count {
+		var r Run
+		if r.On, offset, err = getSystemTime(buf, offset); err != nil {
+			return nil, offset, err
+		}
+		if r.Off, offset, err = getSystemTime(buf, offset); err != nil {
+			return nil, offset, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, offset, nil
+}
+
+// getHistoryCount reads a list count and checks that the buffer holds that
+// many entries of entrySize bytes, so a corrupt count can't allocate
+// gigabytes.
+func getHistoryCount(buf []byte, offset, entrySize int) (int, int, error) {
+	if offset+4 > len(buf) {
+		return 0, offset, fmt.Errorf("history data truncated at byte %d", offset)
+	}
+	count, offset := GetUint32(buf, offset)
+	if int64(count)*int64(entrySize) > int64(len(buf)-offset) {
+		return 0, offset, fmt.Errorf("history list of %d entries exceeds the %d bytes left", count, len(buf)-offset)
+	}
+	return int(count), offset, nil
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeHistory(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, time.July, 4, h, m, 0, 0, time.Local) }
+
+	var buf []byte
+	putSamples := func(temps ...int) {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(temps)))
+		for i, temp := range temps {
+			buf = appendSystemTime(buf, at(20, 30*i))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(temp)))
+		}
+	}
+	putSamples(70, 68)  // air
+	putSamples(80)      // pool
+	putSamples(82)      // pool set point
+	putSamples(95, 101) // spa
+	putSamples()        // spa set point
+
+	// Pool, spa (one finished run), solar, heater (still on), light
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	buf = appendSystemTime(buf, at(20, 0))
+	buf = appendSystemTime(buf, at(22, 15))
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	buf = appendSystemTime(buf, at(20, 5))
+	buf = append(buf, make([]byte, systemTimeSize)...)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+
+	h, err := decodeHistory(buf)
+	if err != nil {
+		t.Fatalf("decodeHistory() error = %v", err)
+	}
+	if len(h.AirTemps) != 2 || h.AirTemps[1].Temperature != 68 || !h.AirTemps[1].Time.Equal(at(20, 30)) {
+		t.Errorf("AirTemps = %+v", h.AirTemps)
+	}
+	if len(h.SpaTemps) != 2 || h.SpaTemps[1].Temperature != 101 || len(h.SpaSetPoints) != 0 {
+		t.Errorf("SpaTemps = %+v, SpaSetPoints = %+v", h.SpaTemps, h.SpaSetPoints)
+	}
+	if len(h.SpaRuns) != 1 || !h.SpaRuns[0].Off.Equal(at(22, 15)) {
+		t.Errorf("SpaRuns = %+v", h.SpaRuns)
+	}
+	if len(h.HeaterRuns) != 1 || !h.HeaterRuns[0].Off.IsZero() {
+		t.Errorf("HeaterRuns = %+v, want one run still on", h.HeaterRuns)
+	}
+
+	if _, err := decodeHistory(buf[:len(buf)-4]); err == nil {
+		t.Error("decodeHistory() should reject truncated data")
+	}
+}
+
+func TestDecodeHistoryHugeCount(t *testing.T) {
+	buf := binary.LittleEndian.AppendUint32(nil, 0xffffffff)
+	_, err := decodeHistory(buf)
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("decodeHistory() error = %v, want a count that exceeds the data", err)
+	}
+}
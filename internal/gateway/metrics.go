@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/nstielau/pool-controller/internal/metrics"
+)
+
+// Session metrics, exported at /metrics.
+var (
+	connectSeconds = metrics.NewHistogram("pool_gateway_connect_seconds",
+		"Time to open the TCP connection to the gateway.", metrics.DefBuckets)
+	loginSeconds = metrics.NewHistogram("pool_gateway_login_seconds",
+		"Time for the challenge and login exchange after connecting.", metrics.DefBuckets)
+	connectFailures = metrics.NewCounter("pool_gateway_connect_failures_total",
+		"Failed attempts to connect and log in to the gateway.")
+	queriesSent = metrics.NewCounter("pool_gateway_queries_total",
+		"Queries sent over the gateway session, by message code.", "code")
+	queryErrors = metrics.NewCounter("pool_gateway_query_errors_total",
+		"Gateway queries that got no answer or a generic error answer, by message code.", "code")
+)
+
+// observeQuery counts a session query and whether it failed.
+func observeQuery(msgCode uint16, answer []byte, err error) {
+	code := strconv.Itoa(int(msgCode))
+	queriesSent.Inc(code)
+	if err != nil || (len(answer) >= HeaderSize && isErrorAnswer(binary.LittleEndian.Uint16(answer[2:4]))) {
+		queryErrors.Inc(code)
+	}
+}
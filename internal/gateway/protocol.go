@@ -3,9 +3,31 @@ package gateway
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 )
 
+// MaxMessageSize is the largest message payload accepted from the gateway.
+// Config answers on big systems are a few KB; anything near this is garbage.
+const MaxMessageSize = 1 << 20
+
+// ErrMessageTooLarge is returned when a header announces a payload larger
+// than MaxMessageSize.
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+// ShortFrameError is returned when a message ends before the payload length
+// announced in its header.
+type ShortFrameError struct {
+	MsgCode uint16
+	Want    int
+	Got     int
+}
+
+func (e *ShortFrameError) Error() string {
+	return fmt.Sprintf("short frame for message %d: got %d of %d data bytes", e.MsgCode, e.Got, e.Want)
+}
+
 // MakeMessage creates a complete protocol message with header.
 // Header format (little-endian):
 //   - 2 bytes: MSG_CODE_1 (always 0)
@@ -31,16 +53,49 @@ func DecodeMessage(message []byte) (uint16, []byte, error) {
 	msgCode2 := binary.LittleEndian.Uint16(message[2:4])
 	dataLen := binary.LittleEndian.Uint32(message[4:8])
 
-	if msgCode2 == UnknownAnswer {
+	switch msgCode2 {
+	case UnknownAnswer:
 		return msgCode2, nil, fmt.Errorf("received UNKNOWN_ANSWER")
+	case InvalidRequestAnswer:
+		return msgCode2, nil, fmt.Errorf("received INVALID_REQUEST")
+	case BadParameterAnswer:
+		return msgCode2, nil, fmt.Errorf("received BAD_PARAMETER")
 	}
 
 	data := message[HeaderSize:]
 	if uint32(len(data)) < dataLen {
-		// Partial data is OK, just return what we have
+		return msgCode2, nil, &ShortFrameError{MsgCode: msgCode2, Want: int(dataLen), Got: len(data)}
+	}
+
+	return msgCode2, data[:dataLen], nil
+}
+
+// ReadMessage reads exactly one framed message from r: the 8-byte header
+// followed by the number of data bytes it announces. The returned slice
+// holds the complete message, header included.
+func ReadMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	msgCode2 := binary.LittleEndian.Uint16(header[2:4])
+	dataLen := binary.LittleEndian.Uint32(header[4:8])
+	if dataLen > MaxMessageSize {
+		return nil, fmt.Errorf("%w: message %d announces %d bytes", ErrMessageTooLarge, msgCode2, dataLen)
+	}
+
+	message := make([]byte, HeaderSize+int(dataLen))
+	copy(message, header)
+	n, err := io.ReadFull(r, message[HeaderSize:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, &ShortFrameError{MsgCode: msgCode2, Want: int(dataLen), Got: n}
+		}
+		return nil, err
 	}
 
-	return msgCode2, data, nil
+	return message, nil
 }
 
 // MakeMessageString encodes a string for the protocol.
@@ -120,6 +175,25 @@ func GetUint16(data []byte, offset int) (uint16, int) {
 	return val, offset + 2
 }
 
+// GetUint16BE reads a big-endian uint16 from buffer at offset. IntelliChem
+// data is the one place the gateway uses network byte order.
+func GetUint16BE(data []byte, offset int) (uint16, int) {
+	if offset+2 > len(data) {
+		return 0, offset
+	}
+	val := binary.BigEndian.Uint16(data[offset : offset+2])
+	return val, offset + 2
+}
+
+// GetUint32BE reads a big-endian uint32 from buffer at offset.
+func GetUint32BE(data []byte, offset int) (uint32, int) {
+	if offset+4 > len(data) {
+		return 0, offset
+	}
+	val := binary.BigEndian.Uint32(data[offset : offset+4])
+	return val, offset + 4
+}
+
 // GetByte reads a single byte from buffer at offset.
 func GetByte(data []byte, offset int) (byte, int) {
 	if offset >= len(data) {
@@ -161,3 +235,9 @@ func GetString(data []byte, offset int) (string, int) {
 
 	return str, offset + int(paddedLen)
 }
+
+// isErrorAnswer reports whether a message code is one of the generic error
+// answers the gateway sends instead of the expected answer.
+func isErrorAnswer(msgCode uint16) bool {
+	return msgCode == UnknownAnswer || msgCode == InvalidRequestAnswer || msgCode == BadParameterAnswer
+}
@@ -1,7 +1,10 @@
 package gateway
 
 import (
+	"bytes"
+	"errors"
 	"testing"
+	"testing/iotest"
 )
 
 func TestMakeMessage(t *testing.T) {
@@ -67,6 +70,18 @@ func TestDecodeMessage(t *testing.T) {
 			message: []byte{0x00, 0x00, 0x00},
 			wantErr: true,
 		},
+		{
+			name:    "truncated data",
+			message: []byte{0x00, 0x00, 0xb9, 0x1f, 0x08, 0x00, 0x00, 0x00, 0x01, 0x02},
+			wantErr: true,
+		},
+		{
+			name:        "trailing bytes ignored",
+			message:     []byte{0x00, 0x00, 0xb9, 0x1f, 0x02, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04},
+			wantCode:    VersionAnswer,
+			wantDataLen: 2,
+			wantErr:     false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -183,3 +198,66 @@ func TestGetByte(t *testing.T) {
 		t.Errorf("GetByte() offset = %d, want 1", offset)
 	}
 }
+
+func TestDecodeMessageShortFrameError(t *testing.T) {
+	_, _, err := DecodeMessage([]byte{0x00, 0x00, 0xb9, 0x1f, 0x08, 0x00, 0x00, 0x00, 0x01, 0x02})
+
+	var short *ShortFrameError
+	if !errors.As(err, &short) {
+		t.Fatalf("DecodeMessage() error = %v, want *ShortFrameError", err)
+	}
+	if short.Want != 8 || short.Got != 2 {
+		t.Errorf("ShortFrameError = %+v, want Want=8 Got=2", short)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xAB}, 5000)
+	stream := append(MakeMessage(CtrlConfigAnswer, payload), MakeMessage(VersionAnswer, nil)...)
+
+	// Deliver one byte per Read to prove frames are reassembled
+	r := iotest.OneByteReader(bytes.NewReader(stream))
+
+	msg, err := ReadMessage(r)
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	code, data, err := DecodeMessage(msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if code != CtrlConfigAnswer || len(data) != len(payload) {
+		t.Errorf("first message code = %d len = %d, want %d len %d", code, len(data), CtrlConfigAnswer, len(payload))
+	}
+
+	msg, err = ReadMessage(r)
+	if err != nil {
+		t.Fatalf("ReadMessage() second error = %v", err)
+	}
+	if code, _, _ := DecodeMessage(msg); code != VersionAnswer {
+		t.Errorf("second message code = %d, want %d", code, VersionAnswer)
+	}
+}
+
+func TestReadMessageShortFrame(t *testing.T) {
+	msg := MakeMessage(PoolStatusAnswer, make([]byte, 100))
+
+	_, err := ReadMessage(bytes.NewReader(msg[:HeaderSize+40]))
+
+	var short *ShortFrameError
+	if !errors.As(err, &short) {
+		t.Fatalf("ReadMessage() error = %v, want *ShortFrameError", err)
+	}
+	if short.MsgCode != PoolStatusAnswer || short.Want != 100 || short.Got != 40 {
+		t.Errorf("ShortFrameError = %+v", short)
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	header := []byte{0x00, 0x00, 0xf5, 0x30, 0xff, 0xff, 0xff, 0x7f}
+
+	_, err := ReadMessage(bytes.NewReader(header))
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("ReadMessage() error = %v, want ErrMessageTooLarge", err)
+	}
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// MaxPumps is the number of pumps a controller supports.
+const MaxPumps = 8
+
+// pumpPresets is the number of circuit speed settings per pump.
+const pumpPresets = 8
+
+// Speed limits of IntelliFlo pumps.
+const (
+	PumpMinRPM = 400
+	PumpMaxRPM = 3450
+	PumpMinGPM = 15
+	PumpMaxGPM = 130
+)
+
+// PumpType names the pump models, indexed by PumpData.Type.
+var PumpType = []string{"None", "IntelliFlo VF", "IntelliFlo VS", "IntelliFlo VSF"}
+
+// PumpData is the live status of a variable-speed pump.
+type PumpData struct {
+	Type    int
+	Running bool
+	Watts   int
+	RPM     int
+	GPM     int
+	Presets []PumpPreset
+}
+
+// PumpPreset is the speed a pump runs at while a circuit is on.
+type PumpPreset struct {
+	CircuitID int
+	SetPoint  int
+	IsRPM     bool
+}
+
+// TypeName returns the pump model name.
+func (p *PumpData) TypeName() string {
+	if p.Type >= 0 && p.Type < len(PumpType) {
+		return PumpType[p.Type]
+	}
+	return fmt.Sprintf("Unknown (%d)", p.Type)
+}
+
+// QueryPump queries the status of the pump at index (0-7).
+func QueryPump(conn Sender, data *PoolData, index int, timeout time.Duration) error {
+	// Payload: padding (4 bytes), pump index (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(index))
+
+	resp, err := conn.Send(PumpStatusQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != PumpStatusAnswer {
+		return fmt.Errorf("unexpected pump status response code: %d", code)
+	}
+
+	pump, err := decodePumpAnswer(buf)
+	if err != nil {
+		return err
+	}
+	if data.Pumps == nil {
+		data.Pumps = make(map[int]*PumpData)
+	}
+	data.Pumps[index] = pump
+	return nil
+}
+
+// SetPumpSpeed changes a pump's speed setting for one of its presets, in
+// RPM or GPM.
+func SetPumpSpeed(conn Sender, pump, preset, speed int, isRPM bool, timeout time.Duration) error {
+	// Payload: padding, pump index, preset index, speed, speed is RPM
+	payload := make([]byte, 20)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(pump))
+	binary.LittleEndian.PutUint32(payload[8:12], uint32(preset))
+	binary.LittleEndian.PutUint32(payload[12:16], uint32(speed))
+	if isRPM {
+		binary.LittleEndian.PutUint32(payload[16:20], 1)
+	}
+
+	resp, err := conn.Send(SetPumpFlowQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetPumpFlowAnswer {
+		return fmt.Errorf("unexpected pump speed response code: %d", code)
+	}
+
+	return nil
+}
+
+// decodePumpAnswer parses the pump status response.
+func decodePumpAnswer(buf []byte) (*PumpData, error) {
+	const headerLen, presetLen = 28, 12
+	if len(buf) < headerLen+pumpPresets*presetLen {
+		return nil, fmt.Errorf("pump status answer too short: %d bytes", len(buf))
+	}
+
+	offset := 0
+	var val uint32
+	pump := &PumpData{}
+
+	val, offset = GetUint32(buf, offset)
+	pump.Type = int(val)
+	val, offset = GetUint32(buf, offset)
+	pump.Running = val != 0
+	val, offset = GetUint32(buf, offset)
+	pump.Watts = int(val)
+	val, offset = GetUint32(buf, offset)
+	pump.RPM = int(val)
+	_, offset = GetUint32(buf, offset) // unknown
+	val, offset = GetUint32(buf, offset)
+	pump.GPM = int(val)
+	_, offset = GetUint32(buf, offset) // unknown
+
+	pump.Presets = make([]PumpPreset, pumpPresets)
+	for i := range pump.Presets {
+		val, offset = GetUint32(buf, offset)
+		pump.Presets[i].CircuitID = int(val)
+		val, offset = GetUint32(buf, offset)
+		pump.Presets[i].SetPoint = int(val)
+
+		var isRPM byte
+		isRPM, offset = GetByte(buf, offset)
+		pump.Presets[i].IsRPM = isRPM != 0
+		offset += 3 // padding
+	}
+
+	return pump, nil
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// NewClientID returns a random client ID for push registration. The gateway
+// only needs it to be unique among the clients currently registered.
+func NewClientID() uint32 {
+	return uint32(32767 + rand.IntN(32768))
+}
+
+// AddClient registers clientID to receive push messages on this connection.
+func AddClient(conn Sender, clientID uint32, timeout time.Duration) error {
+	return sendClientMessage(conn, AddClientQuery, AddClientAnswer, clientID, timeout)
+}
+
+// RemoveClient unregisters clientID from push messages.
+func RemoveClient(conn Sender, clientID uint32, timeout time.Duration) error {
+	return sendClientMessage(conn, RemoveClientQuery, RemoveClientAnswer, clientID, timeout)
+}
+
+// sendClientMessage sends an add/remove client query.
+func sendClientMessage(conn Sender, query, answer uint16, clientID uint32, timeout time.Duration) error {
+	// Payload: padding (4 bytes), client ID (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], clientID)
+
+	resp, err := conn.Send(query, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != answer {
+		return fmt.Errorf("unexpected client registration response code: %d", code)
+	}
+
+	return nil
+}
+
+// ApplyPush decodes a push message into data. It returns false for push
+// types that carry nothing PoolData tracks.
+func ApplyPush(msg []byte, data *PoolData) (bool, error) {
+	code, buf, err := DecodeMessage(msg)
+	if err != nil {
+		return false, err
+	}
+
+	switch code {
+	case StatusChangedPush:
+		// Same layout as PoolStatusAnswer
+		return true, decodeStatusAnswer(buf, data)
+	case ChemistryChangedPush:
+		// Same layout as ChemistryAnswer
+		return true, decodeChemistryAnswer(buf, data)
+	default:
+		return false, nil
+	}
+}
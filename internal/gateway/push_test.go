@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testStatusPayload builds a PoolStatusAnswer payload with one pool body at
+// 80 degrees and the given circuit states.
+func testStatusPayload(airTemp int, circuits map[int]int) []byte {
+	var buf []byte
+	u32 := func(v int) {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+	}
+
+	u32(1)                                // OK flag
+	buf = append(buf, make([]byte, 8)...) // freeze mode, remotes, delays
+	u32(airTemp)
+	u32(1) // bodies
+	u32(0) // pool
+	u32(80)
+	u32(0)
+	u32(82)
+	u32(90)
+	u32(3)
+	u32(len(circuits))
+	for id, state := range circuits {
+		u32(id)
+		u32(state)
+		buf = append(buf, 0, 0, 0, 0) // color bytes, delay
+	}
+	for i := 0; i < 7; i++ {
+		u32(0) // chemistry
+	}
+	return buf
+}
+
+func TestApplyPushStatusChanged(t *testing.T) {
+	data := NewPoolData()
+	data.Circuits[CircuitPool] = &Circuit{ID: CircuitPool, Name: "Pool"}
+
+	msg := MakeMessage(StatusChangedPush, testStatusPayload(65, map[int]int{CircuitPool: 1}))
+	applied, err := ApplyPush(msg, data)
+	if err != nil {
+		t.Fatalf("ApplyPush() error = %v", err)
+	}
+	if !applied {
+		t.Fatal("ApplyPush() should apply status pushes")
+	}
+
+	if data.Circuits[CircuitPool].State != 1 {
+		t.Errorf("pool state = %d, want 1", data.Circuits[CircuitPool].State)
+	}
+	if data.Bodies[0].CurrentTemperature != 80 {
+		t.Errorf("pool temperature = %d, want 80", data.Bodies[0].CurrentTemperature)
+	}
+	if data.Sensors["air_temperature"].State != 65 {
+		t.Errorf("air temperature = %v, want 65", data.Sensors["air_temperature"].State)
+	}
+}
+
+func TestDecodeStatusFlagsAndColors(t *testing.T) {
+	payload := testStatusPayload(65, map[int]int{CircuitPoolLight: 1})
+	copy(payload[4:9], []byte{FreezeModeActive, 0, 1, 0, 1})
+	copy(payload[56:60], []byte{3, 2, 10, 1}) // after the single circuit's ID and state
+
+	data := NewPoolData()
+	if err := decodeStatusAnswer(payload, data); err != nil {
+		t.Fatalf("decodeStatusAnswer() error = %v", err)
+	}
+
+	if !data.Status.FreezeProtection() {
+		t.Error("FreezeProtection() = false, want true")
+	}
+	if data.Status.PoolDelay != 1 || data.Status.SpaDelay != 0 || data.Status.CleanerDelay != 1 {
+		t.Errorf("delays = %d/%d/%d, want 1/0/1", data.Status.PoolDelay, data.Status.SpaDelay, data.Status.CleanerDelay)
+	}
+
+	want := CircuitStatus{ColorSet: 3, ColorPosition: 2, ColorStagger: 10, Delay: 1}
+	if got := data.Status.Circuits[CircuitPoolLight]; got != want {
+		t.Errorf("circuit status = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyPushIgnoresOtherMessages(t *testing.T) {
+	applied, err := ApplyPush(MakeMessage(ColorUpdatePush, nil), NewPoolData())
+	if err != nil {
+		t.Fatalf("ApplyPush() error = %v", err)
+	}
+	if applied {
+		t.Error("ApplyPush() should ignore color updates")
+	}
+}
@@ -9,10 +9,13 @@ import (
 // PoolData contains all pool information from the gateway.
 type PoolData struct {
 	Config    ConfigData
+	Status    StatusData
 	Circuits  map[int]*Circuit
 	Bodies    map[int]*Body
 	Sensors   map[string]*Sensor
 	Chemistry ChemistryData
+	SCG       SCGData
+	Pumps     map[int]*PumpData
 }
 
 // ConfigData contains pool configuration.
@@ -31,6 +34,27 @@ type ConfigData struct {
 	ShowAlarms        uint32
 }
 
+// PumpIndexes returns the indexes of the installed pumps.
+func (c ConfigData) PumpIndexes() []int {
+	var indexes []int
+	for i := 0; i < MaxPumps; i++ {
+		if c.Pumps[i] != 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// HasChlorinator returns true if a salt chlorinator is installed.
+func (c ConfigData) HasChlorinator() bool {
+	return c.EquipmentFlags&EquipmentChlorinator != 0
+}
+
+// HasIntelliChem returns true if an IntelliChem controller is installed.
+func (c ConfigData) HasIntelliChem() bool {
+	return c.EquipmentFlags&EquipmentIntelliChem != 0
+}
+
 // Circuit represents a pool circuit (switch).
 type Circuit struct {
 	ID            int
@@ -46,6 +70,40 @@ type Circuit struct {
 	DefaultRT     uint16
 }
 
+// IsColorLight returns true if the circuit drives a color-capable light.
+func (c *Circuit) IsColorLight() bool {
+	switch c.Function {
+	case FunctionSamLight, FunctionSalLight, FunctionPhotonGen,
+		FunctionColorWheel, FunctionIntelliBrite, FunctionMagicStream:
+		return true
+	}
+	return c.Interface == InterfaceLights && c.ColorSet != 0
+}
+
+// StatusData holds the controller-wide flags from the status answer and the
+// live per-circuit light and delay state.
+type StatusData struct {
+	FreezeMode   byte
+	Remotes      byte
+	PoolDelay    byte
+	SpaDelay     byte
+	CleanerDelay byte
+	Circuits     map[int]CircuitStatus
+}
+
+// CircuitStatus is the per-circuit part of the status answer.
+type CircuitStatus struct {
+	ColorSet      byte
+	ColorPosition byte
+	ColorStagger  byte
+	Delay         byte
+}
+
+// FreezeProtection returns true while freeze protection is running pumps.
+func (s StatusData) FreezeProtection() bool {
+	return s.FreezeMode&FreezeModeActive != 0
+}
+
 // Body represents a body of water (pool or spa).
 type Body struct {
 	BodyType           int
@@ -64,7 +122,9 @@ type Sensor struct {
 	HassType string
 }
 
-// ChemistryData contains chemistry readings.
+// ChemistryData contains chemistry readings. The status answer fills the
+// first block; the rest is only set on systems with an IntelliChem (see
+// QueryChemistry).
 type ChemistryData struct {
 	PH           float64
 	ORP          int
@@ -73,6 +133,16 @@ type ChemistryData struct {
 	PHTankLevel  int
 	ORPTankLevel int
 	Alarms       int
+
+	IntelliChem      bool // true once an IntelliChem answer was decoded
+	PHSetPoint       float64
+	ORPSetPoint      int
+	CalciumHardness  int
+	CyanuricAcid     int
+	TotalAlkalinity  int
+	WaterTemperature int
+	Alerts           int
+	Firmware         string
 }
 
 // Color represents a light color.
@@ -89,14 +159,18 @@ func NewPoolData() *PoolData {
 		Circuits: make(map[int]*Circuit),
 		Bodies:   make(map[int]*Body),
 		Sensors:  make(map[string]*Sensor),
+		Pumps:    make(map[int]*PumpData),
 		Config: ConfigData{
 			Pumps: make(map[int]byte),
 		},
+		Status: StatusData{
+			Circuits: make(map[int]CircuitStatus),
+		},
 	}
 }
 
 // QueryVersion queries the gateway version.
-func QueryVersion(conn *Connection, timeout time.Duration) (string, error) {
+func QueryVersion(conn Sender, timeout time.Duration) (string, error) {
 	resp, err := conn.Send(VersionQuery, nil, timeout)
 	if err != nil {
 		return "", err
@@ -115,7 +189,7 @@ func QueryVersion(conn *Connection, timeout time.Duration) (string, error) {
 }
 
 // QueryConfig queries the pool configuration.
-func QueryConfig(conn *Connection, data *PoolData, timeout time.Duration) error {
+func QueryConfig(conn Sender, data *PoolData, timeout time.Duration) error {
 	// Send config query with two zeros
 	payload := make([]byte, 8)
 	binary.LittleEndian.PutUint32(payload[0:4], 0)
@@ -138,7 +212,7 @@ func QueryConfig(conn *Connection, data *PoolData, timeout time.Duration) error
 }
 
 // QueryStatus queries the current pool status.
-func QueryStatus(conn *Connection, data *PoolData, timeout time.Duration) error {
+func QueryStatus(conn Sender, data *PoolData, timeout time.Duration) error {
 	// Send status query with one zero
 	payload := make([]byte, 4)
 	binary.LittleEndian.PutUint32(payload[0:4], 0)
@@ -160,7 +234,7 @@ func QueryStatus(conn *Connection, data *PoolData, timeout time.Duration) error
 }
 
 // SetCircuit sends a button press to change circuit state.
-func SetCircuit(conn *Connection, circuitID, state int, timeout time.Duration) error {
+func SetCircuit(conn Sender, circuitID, state int, timeout time.Duration) error {
 	// Payload: padding (4 bytes), circuit ID (4 bytes), state (4 bytes)
 	payload := make([]byte, 12)
 	binary.LittleEndian.PutUint32(payload[0:4], 0)
@@ -183,6 +257,78 @@ func SetCircuit(conn *Connection, circuitID, state int, timeout time.Duration) e
 	return nil
 }
 
+// SetHeatSetPoint changes the heat set point for a body (0=Pool, 1=Spa).
+func SetHeatSetPoint(conn Sender, bodyType, temp int, timeout time.Duration) error {
+	// Payload: padding (4 bytes), body type (4 bytes), temperature (4 bytes)
+	payload := make([]byte, 12)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(bodyType))
+	binary.LittleEndian.PutUint32(payload[8:12], uint32(temp))
+
+	resp, err := conn.Send(SetHeatSetPointQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetHeatSetPointAnswer {
+		return fmt.Errorf("unexpected set point response code: %d", code)
+	}
+
+	return nil
+}
+
+// SetHeatMode changes the heat mode for a body (see HeatMode for values).
+func SetHeatMode(conn Sender, bodyType, mode int, timeout time.Duration) error {
+	// Payload: padding (4 bytes), body type (4 bytes), heat mode (4 bytes)
+	payload := make([]byte, 12)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(bodyType))
+	binary.LittleEndian.PutUint32(payload[8:12], uint32(mode))
+
+	resp, err := conn.Send(SetHeatModeQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetHeatModeAnswer {
+		return fmt.Errorf("unexpected heat mode response code: %d", code)
+	}
+
+	return nil
+}
+
+// SendLightCommand sends a ColorMode command (e.g. Party, Caribbean) to the
+// color lights. The controller applies it to every color light circuit.
+func SendLightCommand(conn Sender, command int, timeout time.Duration) error {
+	// Payload: padding (4 bytes), command (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(command))
+
+	resp, err := conn.Send(ColorLightsQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != ColorLightsAnswer {
+		return fmt.Errorf("unexpected light command response code: %d", code)
+	}
+
+	return nil
+}
+
 // decodeConfigAnswer parses the configuration response.
 func decodeConfigAnswer(buf []byte, data *PoolData) error {
 	offset := 0
@@ -259,8 +405,8 @@ func decodeConfigAnswer(buf []byte, data *PoolData) error {
 		data.Config.Colors[i].B, offset = GetUint32(buf, offset)
 	}
 
-	// Pump data (8 entries)
-	for i := 0; i < 8; i++ {
+	// Pump data, nonzero for installed pumps
+	for i := 0; i < MaxPumps; i++ {
 		data.Config.Pumps[i], offset = GetByte(buf, offset)
 	}
 
@@ -279,11 +425,11 @@ func decodeStatusAnswer(buf []byte, data *PoolData) error {
 	_, offset = GetUint32(buf, offset)
 
 	// Freeze mode, remotes, delays
-	_, offset = GetByte(buf, offset) // freezeMode
-	_, offset = GetByte(buf, offset) // remotes
-	_, offset = GetByte(buf, offset) // poolDelay
-	_, offset = GetByte(buf, offset) // spaDelay
-	_, offset = GetByte(buf, offset) // cleanerDelay
+	data.Status.FreezeMode, offset = GetByte(buf, offset)
+	data.Status.Remotes, offset = GetByte(buf, offset)
+	data.Status.PoolDelay, offset = GetByte(buf, offset)
+	data.Status.SpaDelay, offset = GetByte(buf, offset)
+	data.Status.CleanerDelay, offset = GetByte(buf, offset)
 	_, offset = GetByte(buf, offset) // ff1
 	_, offset = GetByte(buf, offset) // ff2
 	_, offset = GetByte(buf, offset) // ff3
@@ -366,11 +512,15 @@ func decodeStatusAnswer(buf []byte, data *PoolData) error {
 			circuit.State = int(circuitState)
 		}
 
-		// Skip color bytes
-		_, offset = GetByte(buf, offset) // colorSet
-		_, offset = GetByte(buf, offset) // colorPos
-		_, offset = GetByte(buf, offset) // colorStagger
-		_, offset = GetByte(buf, offset) // delay
+		var cs CircuitStatus
+		cs.ColorSet, offset = GetByte(buf, offset)
+		cs.ColorPosition, offset = GetByte(buf, offset)
+		cs.ColorStagger, offset = GetByte(buf, offset)
+		cs.Delay, offset = GetByte(buf, offset)
+		if data.Status.Circuits == nil {
+			data.Status.Circuits = make(map[int]CircuitStatus)
+		}
+		data.Status.Circuits[int(circuitID)] = cs
 	}
 
 	// Chemistry data
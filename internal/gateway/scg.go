@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// SCGFlagSuperChlorinate is the SCGData.Flags bit set while the chlorinator
+// is super-chlorinating.
+const SCGFlagSuperChlorinate = 0x01
+
+// MaxSuperChlorHours is the longest super-chlorination the controller runs.
+const MaxSuperChlorHours = 72
+
+// SCGData is the salt chlorinator (IntelliChlor) configuration and status.
+type SCGData struct {
+	Installed       bool
+	Status          int
+	PoolOutput      int // percent
+	SpaOutput       int // percent
+	SaltPPM         int
+	Flags           int
+	SuperChlorHours int
+}
+
+// SuperChlorinating returns true while super-chlorination is running.
+func (s SCGData) SuperChlorinating() bool {
+	return s.Flags&SCGFlagSuperChlorinate != 0
+}
+
+// QuerySCG queries the salt chlorinator configuration and status.
+func QuerySCG(conn Sender, data *PoolData, timeout time.Duration) error {
+	// Send SCG query with one zero
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+
+	resp, err := conn.Send(SCGConfigQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SCGConfigAnswer {
+		return fmt.Errorf("unexpected chlorinator response code: %d", code)
+	}
+
+	return decodeSCGAnswer(buf, data)
+}
+
+// SetSCG sets the chlorinator output for each body (percent) and starts
+// super-chlorination for hours, or stops it when superChlorinate is false.
+func SetSCG(conn Sender, poolOutput, spaOutput int, superChlorinate bool, hours int, timeout time.Duration) error {
+	if !superChlorinate {
+		hours = 0
+	}
+
+	// Payload: padding, pool output, spa output, super chlorinate, hours
+	payload := make([]byte, 20)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(poolOutput))
+	binary.LittleEndian.PutUint32(payload[8:12], uint32(spaOutput))
+	if superChlorinate {
+		binary.LittleEndian.PutUint32(payload[12:16], 1)
+	}
+	binary.LittleEndian.PutUint32(payload[16:20], uint32(hours))
+
+	resp, err := conn.Send(SetSCGQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetSCGAnswer {
+		return fmt.Errorf("unexpected chlorinator set response code: %d", code)
+	}
+
+	return nil
+}
+
+// decodeSCGAnswer parses the chlorinator response: seven uint32s.
+func decodeSCGAnswer(buf []byte, data *PoolData) error {
+	if len(buf) < 28 {
+		return fmt.Errorf("chlorinator answer too short: %d bytes", len(buf))
+	}
+
+	offset := 0
+	var val uint32
+	scg := &data.SCG
+
+	val, offset = GetUint32(buf, offset)
+	scg.Installed = val != 0
+	val, offset = GetUint32(buf, offset)
+	scg.Status = int(val)
+	val, offset = GetUint32(buf, offset)
+	scg.PoolOutput = int(val)
+	val, offset = GetUint32(buf, offset)
+	scg.SpaOutput = int(val)
+
+	// Salt is reported in units of 50 ppm
+	val, offset = GetUint32(buf, offset)
+	scg.SaltPPM = int(val) * 50
+
+	val, offset = GetUint32(buf, offset)
+	scg.Flags = int(val)
+	val, _ = GetUint32(buf, offset)
+	scg.SuperChlorHours = int(val)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Schedule types, as used by ScheduleQuery and AddScheduleQuery.
+const (
+	ScheduleRecurring = 0
+	ScheduleRunOnce   = 1
+)
+
+// ScheduleFlagRunOnce is the ScheduleEvent.Flags bit set on run-once
+// schedules.
+const ScheduleFlagRunOnce = 0x01
+
+// ScheduleEvent is a schedule stored on the controller. Times are minutes
+// after midnight; DayMask has bit 0 for Monday through bit 6 for Sunday.
+type ScheduleEvent struct {
+	ID           int
+	CircuitID    int
+	StartMinutes int
+	StopMinutes  int
+	DayMask      int
+	Flags        int
+	HeatMode     int // HeatMode index; HeatModeDontChange leaves it alone
+	HeatSetPoint int
+}
+
+// QuerySchedules returns the controller's schedules of one type
+// (ScheduleRecurring or ScheduleRunOnce).
+func QuerySchedules(conn Sender, scheduleType int, timeout time.Duration) ([]ScheduleEvent, error) {
+	// Payload: padding (4 bytes), schedule type (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(scheduleType))
+
+	resp, err := conn.Send(ScheduleQuery, payload, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return nil, err
+	}
+	if code != ScheduleAnswer {
+		return nil, fmt.Errorf("unexpected schedule response code: %d", code)
+	}
+
+	return decodeScheduleAnswer(buf)
+}
+
+// AddSchedule creates an empty schedule of the given type and returns its
+// ID. Use SetSchedule to fill it in.
+func AddSchedule(conn Sender, scheduleType int, timeout time.Duration) (int, error) {
+	// Payload: padding (4 bytes), schedule type (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(scheduleType))
+
+	resp, err := conn.Send(AddScheduleQuery, payload, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	code, buf, err := DecodeMessage(resp)
+	if err != nil {
+		return 0, err
+	}
+	if code != AddScheduleAnswer {
+		return 0, fmt.Errorf("unexpected add schedule response code: %d", code)
+	}
+	if len(buf) < 4 {
+		return 0, fmt.Errorf("add schedule answer too short: %d bytes", len(buf))
+	}
+
+	id, _ := GetUint32(buf, 0)
+	return int(id), nil
+}
+
+// DeleteSchedule removes a schedule.
+func DeleteSchedule(conn Sender, id int, timeout time.Duration) error {
+	// Payload: padding (4 bytes), schedule ID (4 bytes)
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], 0)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(id))
+
+	resp, err := conn.Send(DeleteScheduleQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != DeleteScheduleAnswer {
+		return fmt.Errorf("unexpected delete schedule response code: %d", code)
+	}
+
+	return nil
+}
+
+// SetSchedule overwrites the schedule with event.ID.
+func SetSchedule(conn Sender, event ScheduleEvent, timeout time.Duration) error {
+	// Payload: padding, then every ScheduleEvent field in order
+	payload := make([]byte, 0, 36)
+	for _, v := range []int{
+		0, event.ID, event.CircuitID, event.StartMinutes, event.StopMinutes,
+		event.DayMask, event.Flags, event.HeatMode, event.HeatSetPoint,
+	} {
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(v))
+	}
+
+	resp, err := conn.Send(SetScheduleQuery, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	code, _, err := DecodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	if code != SetScheduleAnswer {
+		return fmt.Errorf("unexpected set schedule response code: %d", code)
+	}
+
+	return nil
+}
+
+// decodeScheduleAnswer parses the schedule list: a count, then eight
+// uint32s per schedule.
+func decodeScheduleAnswer(buf []byte) ([]ScheduleEvent, error) {
+	count, offset := GetUint32(buf, 0)
+	if len(buf) < offset+int(count)*32 {
+		return nil, fmt.Errorf("schedule answer too short for %d schedules: %d bytes", count, len(buf))
+	}
+
+	events := make([]ScheduleEvent, count)
+	for i := range events {
+		fields := []*int{
+			&events[i].ID, &events[i].CircuitID, &events[i].StartMinutes, &events[i].StopMinutes,
+			&events[i].DayMask, &events[i].Flags, &events[i].HeatMode, &events[i].HeatSetPoint,
+		}
+		for _, f := range fields {
+			var val uint32
+			val, offset = GetUint32(buf, offset)
+			*f = int(val)
+		}
+	}
+
+	return events, nil
+}
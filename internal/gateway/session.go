@@ -0,0 +1,511 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session tuning defaults.
+const (
+	DefaultKeepaliveInterval = 30 * time.Second
+	minReconnectBackoff      = 1 * time.Second
+	maxReconnectBackoff      = 60 * time.Second
+	pushQueueSize            = 32
+)
+
+// ErrSessionClosed is returned by Session.Send after Close has been called.
+var ErrSessionClosed = errors.New("gateway session closed")
+
+// Sender sends a query to the gateway and returns the raw answer message.
+// Both Connection and Session implement it.
+type Sender interface {
+	Send(msgCode uint16, data []byte, timeout time.Duration) ([]byte, error)
+}
+
+// FollowSender is a Sender that can also wait for the message the gateway
+// sends after an answer. Both Connection and Session implement it.
+type FollowSender interface {
+	Sender
+	SendFollowed(msgCode uint16, data []byte, followCode uint16, timeout time.Duration) ([]byte, error)
+}
+
+// Session keeps a single logged-in connection to the gateway open and
+// shares it between concurrent callers.
+//
+// Requests are serialized: one query is in flight at a time and its answer
+// is matched by message code (query code + 1). A VersionQuery keepalive is
+// sent periodically, and when the socket drops the session reconnects in
+// the background with exponential backoff.
+type Session struct {
+	ip        string
+	port      int
+	timeout   time.Duration
+	keepalive time.Duration
+	logger    *log.Logger
+
+	reqMu sync.Mutex // serializes requests
+
+	mu      sync.Mutex
+	conn    *Connection
+	ready   chan struct{} // closed once conn is usable
+	dead    chan struct{} // closed when conn is dropped
+	pending *pendingRequest
+	follow  *pendingRequest // message expected after pending's answer
+	started bool
+
+	// Push subscription; pushHandler is nil until Subscribe is called
+	clientID    uint32
+	pushHandler func(msg []byte, received time.Time)
+	pushes      chan push
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// push is an unsolicited message waiting for the push handler.
+type push struct {
+	msg      []byte
+	received time.Time
+}
+
+// pendingRequest is a query waiting for its answer.
+type pendingRequest struct {
+	answer uint16
+	result chan sessionResult
+}
+
+// sessionResult is the answer (or failure) delivered to a pending request,
+// with the time the answer was read.
+type sessionResult struct {
+	msg      []byte
+	received time.Time
+	err      error
+}
+
+// NewSession creates a session for the gateway at ip:port. Call Start to
+// begin connecting.
+func NewSession(ip string, port int, timeout time.Duration) *Session {
+	return &Session{
+		ip:        ip,
+		port:      port,
+		timeout:   timeout,
+		keepalive: DefaultKeepaliveInterval,
+		logger:    log.New(os.Stdout, "[gateway] ", log.LstdFlags),
+		clientID:  NewClientID(),
+		pushes:    make(chan push, pushQueueSize),
+		ready:     make(chan struct{}),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start connects to the gateway in the background and keeps the connection
+// alive until Close is called.
+func (s *Session) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+	go s.run()
+	go s.deliverPushes()
+}
+
+// Subscribe registers the session for push messages and calls handler with
+// each one and the time it was read. The registration is renewed after every
+// reconnect. Handlers run on a single goroutine, in arrival order, and may
+// call Send.
+//
+// A push read before the answer to a request describes an older state than
+// that answer, so callers that also query status can compare the received
+// time to drop pushes that were queued behind a newer answer.
+func (s *Session) Subscribe(handler func(msg []byte, received time.Time)) error {
+	s.mu.Lock()
+	s.pushHandler = handler
+	connected := s.conn != nil
+	s.mu.Unlock()
+
+	if !connected {
+		// serve registers as soon as the connection is up
+		return nil
+	}
+	return AddClient(s, s.clientID, s.timeout)
+}
+
+// Close shuts down the session and its connection.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	subscribed := s.pushHandler != nil && s.conn != nil
+	s.mu.Unlock()
+
+	if subscribed {
+		// Best effort; the gateway also forgets clients whose socket closes
+		RemoveClient(s, s.clientID, s.timeout)
+	}
+
+	s.closeOnce.Do(func() { close(s.closing) })
+
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	if started {
+		<-s.done
+	}
+	return nil
+}
+
+// ClientID returns the ID the session registers for push messages. The
+// gateway addresses history data to it.
+func (s *Session) ClientID() uint32 {
+	return s.clientID
+}
+
+// IsConnected returns true if the session currently has a logged-in connection.
+func (s *Session) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil
+}
+
+// retryableQueries are the queries Send repeats once when the connection
+// drops before the answer arrives. Each reads state or sets an absolute
+// value, so the gateway may safely see it twice. Queries that create or
+// delete something (AddScheduleQuery) or step through a sequence
+// (ColorLightsQuery) are left out.
+var retryableQueries = map[uint16]bool{
+	VersionQuery:         true,
+	PoolStatusQuery:      true,
+	CtrlConfigQuery:      true,
+	ButtonPressQuery:     true,
+	SetHeatSetPointQuery: true,
+	SetHeatModeQuery:     true,
+	SystemTimeQuery:      true,
+	ChemistryQuery:       true,
+	SCGConfigQuery:       true,
+	SetSCGQuery:          true,
+	PumpStatusQuery:      true,
+	SetPumpFlowQuery:     true,
+	ScheduleQuery:        true,
+	SetScheduleQuery:     true,
+}
+
+// Send sends a message over the shared connection and returns the answer.
+// If the session is reconnecting, Send waits up to timeout for it to come
+// back. A query in retryableQueries that is interrupted by a dropped
+// connection is retried once; any other query fails, since the gateway may
+// already have acted on it.
+func (s *Session) Send(msgCode uint16, data []byte, timeout time.Duration) ([]byte, error) {
+	msg, _, err := s.SendTimed(msgCode, data, timeout)
+	return msg, err
+}
+
+// SendTimed is Send that also returns when the answer was read, on the
+// same clock as the received time passed to push handlers. A push read
+// before that time describes an older state than the answer.
+func (s *Session) SendTimed(msgCode uint16, data []byte, timeout time.Duration) ([]byte, time.Time, error) {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	r := s.send(msgCode, data, timeout, deadline.C)
+	if errors.Is(r.err, errConnectionLost) && retryableQueries[msgCode] {
+		r = s.send(msgCode, data, timeout, deadline.C)
+	}
+	observeQuery(msgCode, r.msg, r.err)
+	return r.msg, r.received, r.err
+}
+
+// SendFollowed sends a query whose answer is only an acknowledgement and
+// waits for the message with followCode that carries the data, such as
+// history. No other query is sent in between. It returns the follow-up
+// message.
+func (s *Session) SendFollowed(msgCode uint16, data []byte, followCode uint16, timeout time.Duration) (msg []byte, err error) {
+	defer func() { observeQuery(msgCode, msg, err) }()
+
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Expect the follow-up before sending; it can arrive right behind the
+	// answer
+	f := &pendingRequest{
+		answer: followCode,
+		result: make(chan sessionResult, 1),
+	}
+	s.mu.Lock()
+	s.follow = f
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.follow == f {
+			s.follow = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	answer := s.send(msgCode, data, timeout, deadline.C)
+	if answer.err != nil {
+		return nil, answer.err
+	}
+	if _, _, err := DecodeMessage(answer.msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-f.result:
+		return r.msg, r.err
+	case <-deadline.C:
+		return nil, fmt.Errorf("timed out waiting for message %d after %d", followCode, msgCode)
+	case <-s.closing:
+		return nil, ErrSessionClosed
+	}
+}
+
+// errConnectionLost marks a request that failed because the socket dropped.
+var errConnectionLost = errors.New("gateway connection lost")
+
+// send performs a single request attempt.
+func (s *Session) send(msgCode uint16, data []byte, timeout time.Duration, deadline <-chan time.Time) sessionResult {
+	conn, err := s.waitReady(deadline)
+	if err != nil {
+		return sessionResult{err: err}
+	}
+
+	p := &pendingRequest{
+		answer: msgCode + 1,
+		result: make(chan sessionResult, 1),
+	}
+	s.mu.Lock()
+	s.pending = p
+	s.mu.Unlock()
+	defer s.clearPending(p)
+
+	conn.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := conn.writeMessage(msgCode, data); err != nil {
+		s.drop(conn, err)
+		return sessionResult{err: fmt.Errorf("%w: %v", errConnectionLost, err)}
+	}
+
+	select {
+	case r := <-p.result:
+		return r
+	case <-deadline:
+		// A late answer could be mistaken for the next query's, so start over
+		err := fmt.Errorf("timed out waiting for answer to message %d", msgCode)
+		s.drop(conn, err)
+		return sessionResult{err: err}
+	case <-s.closing:
+		return sessionResult{err: ErrSessionClosed}
+	}
+}
+
+// waitReady blocks until a connection is available.
+func (s *Session) waitReady(timeout <-chan time.Time) (*Connection, error) {
+	for {
+		s.mu.Lock()
+		conn, ready := s.conn, s.ready
+		s.mu.Unlock()
+
+		if conn != nil {
+			return conn, nil
+		}
+
+		select {
+		case <-ready:
+		case <-timeout:
+			return nil, fmt.Errorf("gateway not connected")
+		case <-s.closing:
+			return nil, ErrSessionClosed
+		}
+	}
+}
+
+// clearPending removes p if it is still the pending request.
+func (s *Session) clearPending(p *pendingRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == p {
+		s.pending = nil
+	}
+}
+
+// run is the connection supervisor: connect, serve until the connection
+// drops, then reconnect with backoff.
+func (s *Session) run() {
+	defer close(s.done)
+
+	backoff := minReconnectBackoff
+	for {
+		conn := NewConnection(s.ip, s.port)
+		err := conn.Connect(s.timeout)
+		if err != nil {
+			connectFailures.Inc()
+			s.logger.Printf("Connect to %s:%d failed, retrying in %v: %v", s.ip, s.port, backoff, err)
+			select {
+			case <-s.closing:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			continue
+		}
+
+		s.logger.Printf("Connected to gateway %s:%d", s.ip, s.port)
+		backoff = minReconnectBackoff
+		s.serve(conn)
+
+		select {
+		case <-s.closing:
+			return
+		default:
+		}
+	}
+}
+
+// serve publishes conn to callers and keeps it alive until it drops.
+func (s *Session) serve(conn *Connection) {
+	dead := make(chan struct{})
+
+	s.mu.Lock()
+	s.conn = conn
+	s.dead = dead
+	close(s.ready)
+	s.mu.Unlock()
+
+	go s.readLoop(conn)
+
+	s.mu.Lock()
+	subscribed := s.pushHandler != nil
+	s.mu.Unlock()
+	if subscribed {
+		if err := AddClient(s, s.clientID, s.timeout); err != nil {
+			s.logger.Printf("Push registration failed: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(s.keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dead:
+			return
+		case <-s.closing:
+			s.drop(conn, ErrSessionClosed)
+			return
+		case <-ticker.C:
+			if _, err := QueryVersion(s, s.timeout); err != nil {
+				s.logger.Printf("Keepalive failed: %v", err)
+			}
+		}
+	}
+}
+
+// readLoop reads messages from conn and hands answers to the pending request.
+func (s *Session) readLoop(conn *Connection) {
+	for {
+		msg, err := conn.readMessage()
+		if err != nil {
+			s.drop(conn, err)
+			return
+		}
+		s.dispatch(msg)
+	}
+}
+
+// dispatch delivers msg to the pending request if its code matches.
+// Anything else is unsolicited and queued for the push handler, if any.
+func (s *Session) dispatch(msg []byte) {
+	if len(msg) < HeaderSize {
+		return
+	}
+	code := binary.LittleEndian.Uint16(msg[2:4])
+	received := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.pending
+	if p != nil && (code == p.answer || isErrorAnswer(code)) {
+		s.pending = nil
+		p.result <- sessionResult{msg: msg, received: received}
+		return
+	}
+	if f := s.follow; f != nil && code == f.answer {
+		s.follow = nil
+		f.result <- sessionResult{msg: msg, received: received}
+		return
+	}
+
+	if s.pushHandler == nil {
+		return
+	}
+	select {
+	case s.pushes <- push{msg: msg, received: received}:
+	default:
+		s.logger.Printf("Push queue full, dropping message %d", code)
+	}
+}
+
+// deliverPushes runs push handlers off the read loop so a handler that
+// blocks (or sends its own query) cannot stall answers.
+func (s *Session) deliverPushes() {
+	for {
+		select {
+		case <-s.closing:
+			return
+		case p := <-s.pushes:
+			s.mu.Lock()
+			handler := s.pushHandler
+			s.mu.Unlock()
+			if handler != nil {
+				handler(p.msg, p.received)
+			}
+		}
+	}
+}
+
+// drop closes conn, fails any pending request and marks the session as
+// reconnecting. It is a no-op if conn has already been dropped.
+func (s *Session) drop(conn *Connection, reason error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != conn {
+		return
+	}
+
+	if reason != ErrSessionClosed {
+		s.logger.Printf("Gateway connection lost: %v", reason)
+	}
+
+	s.conn = nil
+	s.ready = make(chan struct{})
+	close(s.dead)
+	conn.Close()
+
+	if s.pending != nil {
+		s.pending.result <- sessionResult{err: fmt.Errorf("%w: %v", errConnectionLost, reason)}
+		s.pending = nil
+	}
+	if s.follow != nil {
+		s.follow.result <- sessionResult{err: fmt.Errorf("%w: %v", errConnectionLost, reason)}
+		s.follow = nil
+	}
+}
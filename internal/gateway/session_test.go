@@ -0,0 +1,362 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway is a minimal ScreenLogic server for session tests. It logs in
+// any client and answers every query with the matching answer code, sending
+// an unsolicited message first when noise is set. The first query with code
+// hangUp is read but not answered: the connection is closed instead.
+type fakeGateway struct {
+	t        *testing.T
+	listener net.Listener
+	noise    bool
+	hangUp   uint16
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	logins   int
+	received map[uint16]int
+}
+
+func newFakeGateway(t *testing.T) *fakeGateway {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	g := &fakeGateway{t: t, listener: l, received: make(map[uint16]int)}
+	go g.accept()
+	t.Cleanup(func() { l.Close(); g.dropAll() })
+	return g
+}
+
+func (g *fakeGateway) addr() (string, int) {
+	a := g.listener.Addr().(*net.TCPAddr)
+	return a.IP.String(), a.Port
+}
+
+func (g *fakeGateway) receivedCount(code uint16) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.received[code]
+}
+
+func (g *fakeGateway) loginCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.logins
+}
+
+// dropAll closes every client connection, simulating a gateway reboot.
+func (g *fakeGateway) dropAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, c := range g.conns {
+		c.Close()
+	}
+	g.conns = nil
+}
+
+func (g *fakeGateway) accept() {
+	for {
+		c, err := g.listener.Accept()
+		if err != nil {
+			return
+		}
+		g.mu.Lock()
+		g.conns = append(g.conns, c)
+		g.mu.Unlock()
+		go g.serve(c)
+	}
+}
+
+func (g *fakeGateway) serve(c net.Conn) {
+	defer c.Close()
+
+	connect := make([]byte, len(ConnectString))
+	if _, err := io.ReadFull(c, connect); err != nil {
+		return
+	}
+
+	for {
+		header := make([]byte, HeaderSize)
+		if _, err := io.ReadFull(c, header); err != nil {
+			return
+		}
+		code := binary.LittleEndian.Uint16(header[2:4])
+		data := make([]byte, binary.LittleEndian.Uint32(header[4:8]))
+		if _, err := io.ReadFull(c, data); err != nil {
+			return
+		}
+
+		g.mu.Lock()
+		g.received[code]++
+		hangUp := code == g.hangUp && g.received[code] == 1
+		g.mu.Unlock()
+		if hangUp {
+			return
+		}
+
+		var answer []byte
+		switch code {
+		case LocalLoginQuery:
+			g.mu.Lock()
+			g.logins++
+			g.mu.Unlock()
+			answer = MakeMessage(LocalLoginAnswer, nil)
+		case VersionQuery:
+			answer = MakeMessage(VersionAnswer, MakeMessageString("POOL: 5.2 Build 736.0 Rel"))
+		case HistoryQuery:
+			// Acknowledge, then send the data in two pieces
+			c.Write(MakeMessage(HistoryAnswer, nil))
+			data := MakeMessage(HistoryDataPush, make([]byte, 40))
+			c.Write(data[:12])
+			time.Sleep(10 * time.Millisecond)
+			c.Write(data[12:])
+		case AddClientQuery:
+			// Answer, then immediately push the current status
+			c.Write(MakeMessage(AddClientAnswer, nil))
+			answer = MakeMessage(StatusChangedPush, testStatusPayload(71, map[int]int{CircuitSpa: 1}))
+		default:
+			answer = MakeMessage(code+1, nil)
+		}
+
+		if g.noise && code != ChallengeQuery && code != LocalLoginQuery {
+			c.Write(MakeMessage(12500, nil))
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Write(answer)
+	}
+}
+
+func TestSessionSend(t *testing.T) {
+	g := newFakeGateway(t)
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	version, err := QueryVersion(s, 2*time.Second)
+	if err != nil {
+		t.Fatalf("QueryVersion() error = %v", err)
+	}
+	if version != "POOL: 5.2 Build 736.0 Rel" {
+		t.Errorf("QueryVersion() = %q", version)
+	}
+
+	// Concurrent callers share the one login
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := SetCircuit(s, CircuitSpa, 1, 2*time.Second); err != nil {
+				t.Errorf("SetCircuit() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := g.loginCount(); got != 1 {
+		t.Errorf("logins = %d, want 1", got)
+	}
+}
+
+func TestSessionIgnoresUnsolicitedMessages(t *testing.T) {
+	g := newFakeGateway(t)
+	g.noise = true
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	if err := SetCircuit(s, CircuitSpa, 1, 2*time.Second); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+}
+
+func TestSessionSendFollowed(t *testing.T) {
+	g := newFakeGateway(t)
+	g.noise = true
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	// Ten empty lists make an empty history
+	h, err := QueryHistory(s, time.Now().Add(-time.Hour), time.Now(), s.ClientID(), 2*time.Second)
+	if err != nil {
+		t.Fatalf("QueryHistory() error = %v", err)
+	}
+	if len(h.AirTemps) != 0 || len(h.HeaterRuns) != 0 {
+		t.Errorf("QueryHistory() = %+v, want empty", h)
+	}
+
+	if err := SetCircuit(s, CircuitSpa, 1, 2*time.Second); err != nil {
+		t.Errorf("SetCircuit() after history error = %v", err)
+	}
+}
+
+func TestSessionReconnects(t *testing.T) {
+	g := newFakeGateway(t)
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	if _, err := QueryVersion(s, 2*time.Second); err != nil {
+		t.Fatalf("QueryVersion() error = %v", err)
+	}
+
+	g.dropAll()
+
+	// Send waits for the background reconnect
+	if _, err := QueryVersion(s, 5*time.Second); err != nil {
+		t.Fatalf("QueryVersion() after drop error = %v", err)
+	}
+	if got := g.loginCount(); got != 2 {
+		t.Errorf("logins = %d, want 2", got)
+	}
+}
+
+func TestSessionRetriesIdempotentQueries(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      uint16
+		send      func(s *Session) error
+		wantSends int
+	}{
+		{
+			name: "set circuit is retried",
+			code: ButtonPressQuery,
+			send: func(s *Session) error {
+				return SetCircuit(s, CircuitSpa, 1, 5*time.Second)
+			},
+			wantSends: 2,
+		},
+		{
+			name: "add schedule is not retried",
+			code: AddScheduleQuery,
+			send: func(s *Session) error {
+				_, err := AddSchedule(s, 0, 5*time.Second)
+				return err
+			},
+			wantSends: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGateway(t)
+			g.hangUp = tt.code
+			ip, port := g.addr()
+
+			s := NewSession(ip, port, 2*time.Second)
+			s.Start()
+			defer s.Close()
+
+			err := tt.send(s)
+			if got := g.receivedCount(tt.code); got != tt.wantSends {
+				t.Errorf("gateway received %d queries, want %d", got, tt.wantSends)
+			}
+			if retried := tt.wantSends > 1; retried != (err == nil) {
+				t.Errorf("send error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionClosed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close() // nothing listening: session keeps retrying
+
+	s := NewSession("127.0.0.1", port, 500*time.Millisecond)
+	s.Start()
+	s.Close()
+
+	if _, err := s.Send(VersionQuery, nil, time.Second); err != ErrSessionClosed {
+		t.Errorf("Send() after Close error = %v, want ErrSessionClosed", err)
+	}
+}
+
+func TestSessionSubscribe(t *testing.T) {
+	g := newFakeGateway(t)
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	got := make(chan []byte, 1)
+	if err := s.Subscribe(func(msg []byte, _ time.Time) { got <- msg }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	select {
+	case msg := <-got:
+		data := NewPoolData()
+		data.Circuits[CircuitSpa] = &Circuit{ID: CircuitSpa}
+		applied, err := ApplyPush(msg, data)
+		if err != nil || !applied {
+			t.Fatalf("ApplyPush() = %v, %v", applied, err)
+		}
+		if data.Circuits[CircuitSpa].State != 1 {
+			t.Error("spa should be on after push")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no push delivered")
+	}
+}
+
+func TestSessionSendTimed(t *testing.T) {
+	g := newFakeGateway(t)
+	ip, port := g.addr()
+
+	s := NewSession(ip, port, 2*time.Second)
+	s.Start()
+	defer s.Close()
+
+	pushed := make(chan time.Time, 2)
+	if err := s.Subscribe(func(_ []byte, received time.Time) { pushed <- received }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	waitPush := func() time.Time {
+		t.Helper()
+		select {
+		case received := <-pushed:
+			return received
+		case <-time.After(2 * time.Second):
+			t.Fatal("no push delivered")
+			return time.Time{}
+		}
+	}
+	waitPush() // from the registration
+
+	// The gateway pushes status right behind this answer
+	before := time.Now()
+	_, answered, err := s.SendTimed(AddClientQuery, make([]byte, 8), 2*time.Second)
+	if err != nil {
+		t.Fatalf("SendTimed() error = %v", err)
+	}
+	if answered.Before(before) || answered.After(time.Now()) {
+		t.Errorf("answer read at %v, want during the call", answered)
+	}
+	if received := waitPush(); received.Before(answered) {
+		t.Errorf("push read at %v, before the answer it followed at %v", received, answered)
+	}
+}
@@ -0,0 +1,30 @@
+// Package homeassistant publishes the pool to Home Assistant over MQTT.
+//
+// # Discovery
+//
+// The Publisher sends a retained MQTT discovery config for every Bridge
+// device under HASS_DISCOVERY_PREFIX (default "homeassistant"), using the
+// device's HassType: switches and color lights become switch and light
+// entities, sensors and binary sensors keep their type, and the pool and
+// spa heat set points become number entities. All entities belong to one
+// "Pool Controller" device.
+//
+// # Topics
+//
+// With MQTT_TOPIC_PREFIX (default "pool-controller"):
+//
+//	pool-controller/status          online, or offline (the LWT)
+//	pool-controller/<device>/state  ON/OFF, a number, or text; retained
+//	pool-controller/<device>/set    ON/OFF for circuits, a temperature for set points
+//
+// States are published when they change, checked every poll interval and
+// right after a command. Pushes from the gateway keep the Bridge current
+// between its updates, so changes made at the panel show up promptly.
+//
+// # Usage
+//
+//	if broker := os.Getenv(homeassistant.EnvBroker); broker != "" {
+//	    publisher := homeassistant.New(broker, bridge, homeassistant.DefaultPollInterval)
+//	    go publisher.Run(ctx)
+//	}
+package homeassistant
@@ -0,0 +1,346 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/mqtt"
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// Environment variables read by the publisher.
+const (
+	EnvBroker          = "MQTT_BROKER"
+	EnvUsername        = "MQTT_USERNAME"
+	EnvPassword        = "MQTT_PASSWORD"
+	EnvClientID        = "MQTT_CLIENT_ID"
+	EnvTopicPrefix     = "MQTT_TOPIC_PREFIX"
+	EnvDiscoveryPrefix = "HASS_DISCOVERY_PREFIX"
+)
+
+// DefaultPollInterval is how often device states are compared with what
+// was last published. Reading them is cheap: the Bridge only queries the
+// gateway once its update interval has passed, and pushes keep it current
+// in between.
+const DefaultPollInterval = 2 * time.Second
+
+// defaultBrokerPort is used when MQTT_BROKER has no port.
+const defaultBrokerPort = "1883"
+
+// Availability payloads on the status topic.
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// setPointBodies maps set point devices to the body they control.
+var setPointBodies = map[string]int{
+	"pool_heat_set_point": 0,
+	"spa_heat_set_point":  1,
+}
+
+// BridgeInterface is the part of pool.Bridge the publisher uses.
+type BridgeInterface interface {
+	Update() error
+	Devices() []pool.DeviceState
+	CircuitForDevice(key string) (int, error)
+	SetCircuit(circuitID, state int) error
+	GetBody(bodyIndex int) (pool.Body, bool)
+	SetHeatSetPoint(bodyIndex, temp int) error
+}
+
+// Publisher mirrors the Bridge's devices to Home Assistant over MQTT.
+//
+// On every connect it publishes a retained discovery config for each
+// device and marks itself online; the broker publishes the offline will if
+// the connection is lost. Device states are published (retained) when
+// they change, and commands on <prefix>/<device>/set switch circuits and
+// change set points.
+type Publisher struct {
+	bridge          BridgeInterface
+	client          *mqtt.Client
+	topicPrefix     string
+	discoveryPrefix string
+	nodeID          string
+	pollInterval    time.Duration
+	log             *log.Logger
+
+	mu        sync.Mutex
+	announced map[string]bool   // devices with a discovery config on this connection
+	states    map[string]string // state payloads published on this connection
+}
+
+// New creates a publisher for the broker at host[:port]. Credentials, the
+// client ID (default "pool-controller", also the Home Assistant node ID)
+// and topic prefixes (default "pool-controller" and "homeassistant") come
+// from the environment.
+func New(broker string, bridge BridgeInterface, pollInterval time.Duration) *Publisher {
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		broker = net.JoinHostPort(broker, defaultBrokerPort)
+	}
+
+	p := &Publisher{
+		bridge:          bridge,
+		topicPrefix:     envOr(EnvTopicPrefix, "pool-controller"),
+		discoveryPrefix: envOr(EnvDiscoveryPrefix, "homeassistant"),
+		nodeID:          envOr(EnvClientID, "pool-controller"),
+		pollInterval:    pollInterval,
+		log:             log.New(os.Stdout, "[homeassistant] ", log.LstdFlags),
+	}
+
+	p.client = mqtt.NewClient(mqtt.Options{
+		Broker:   broker,
+		ClientID: p.nodeID,
+		Username: os.Getenv(EnvUsername),
+		Password: os.Getenv(EnvPassword),
+		Will: &mqtt.Message{
+			Topic:   p.statusTopic(),
+			Payload: []byte(payloadOffline),
+			Retain:  true,
+		},
+		OnConnect: p.onConnect,
+	})
+	p.client.Subscribe(p.topicPrefix+"/+/set", p.handleCommand)
+
+	return p
+}
+
+// envOr returns the environment variable name, or def if it is unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// Run publishes until ctx is cancelled, then disconnects; the client
+// publishes the offline will on the way out.
+func (p *Publisher) Run(ctx context.Context) {
+	p.client.Start()
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.client.Close()
+			return
+		case <-ticker.C:
+			if err := p.bridge.Update(); err != nil {
+				p.log.Printf("Update failed: %v", err)
+			}
+			p.publishDevices()
+		}
+	}
+}
+
+// onConnect announces every device again; the broker may have restarted
+// and lost what was retained.
+func (p *Publisher) onConnect() {
+	p.mu.Lock()
+	p.announced = make(map[string]bool)
+	p.states = make(map[string]string)
+	p.mu.Unlock()
+
+	p.publish(p.statusTopic(), payloadOnline)
+	p.publishDevices()
+}
+
+// publishDevices announces new devices and publishes changed states.
+func (p *Publisher) publishDevices() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.announced == nil {
+		return // not connected yet
+	}
+
+	for _, d := range p.bridge.Devices() {
+		component, ok := p.component(d)
+		if !ok {
+			continue
+		}
+
+		if !p.announced[d.Key] {
+			config, err := json.Marshal(p.config(component, d))
+			if err != nil {
+				continue
+			}
+			topic := p.discoveryPrefix + "/" + component + "/" + p.nodeID + "/" + d.Key + "/config"
+			if p.publish(topic, string(config)) != nil {
+				return
+			}
+			p.announced[d.Key] = true
+		}
+
+		state := statePayload(component, d)
+		if last, ok := p.states[d.Key]; ok && last == state {
+			continue
+		}
+		if p.publish(p.stateTopic(d.Key), state) != nil {
+			return
+		}
+		p.states[d.Key] = state
+	}
+}
+
+// publish sends a retained message, logging failures other than being
+// disconnected.
+func (p *Publisher) publish(topic, payload string) error {
+	err := p.client.Publish(mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: true})
+	if err != nil && !errors.Is(err, mqtt.ErrNotConnected) {
+		p.log.Printf("Publish to %s failed: %v", topic, err)
+	}
+	return err
+}
+
+// component returns the Home Assistant component for a device.
+func (p *Publisher) component(d pool.DeviceState) (string, bool) {
+	if _, ok := setPointBodies[d.Key]; ok {
+		return "number", true
+	}
+	switch d.HassType {
+	case "switch", "light", "sensor", "binary_sensor":
+		return d.HassType, true
+	}
+	return "", false
+}
+
+// config returns the discovery config for a device.
+func (p *Publisher) config(component string, d pool.DeviceState) map[string]interface{} {
+	config := map[string]interface{}{
+		"name":               d.Name,
+		"unique_id":          p.nodeID + "_" + d.Key,
+		"state_topic":        p.stateTopic(d.Key),
+		"availability_topic": p.statusTopic(),
+		"device": map[string]interface{}{
+			"identifiers":  []string{p.nodeID},
+			"name":         "Pool Controller",
+			"manufacturer": "Pentair",
+			"model":        "ScreenLogic",
+		},
+	}
+
+	switch component {
+	case "switch", "light":
+		config["command_topic"] = p.commandTopic(d.Key)
+	case "number":
+		config["command_topic"] = p.commandTopic(d.Key)
+		config["device_class"] = "temperature"
+		config["unit_of_measurement"] = d.Unit
+		config["mode"] = "box"
+		config["step"] = 1
+		if body, ok := p.bridge.GetBody(setPointBodies[d.Key]); ok {
+			config["min"] = body.MinSetPoint
+			config["max"] = body.MaxSetPoint
+		}
+	case "sensor":
+		if d.Unit != "" {
+			config["unit_of_measurement"] = d.Unit
+		}
+		if d.Unit == "°F" || d.Unit == "°C" {
+			config["device_class"] = "temperature"
+		}
+		if _, numeric := number(d.State); numeric {
+			config["state_class"] = "measurement"
+		}
+	}
+	return config
+}
+
+// statePayload formats a device state the way its component expects.
+func statePayload(component string, d pool.DeviceState) string {
+	v, numeric := number(d.State)
+	switch component {
+	case "switch", "light", "binary_sensor":
+		if v != 0 {
+			return "ON"
+		}
+		return "OFF"
+	}
+	if numeric {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return d.FriendlyState
+}
+
+// number returns a numeric device state as a float64.
+func number(state interface{}) (float64, bool) {
+	switch v := state.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// handleCommand applies a message on <prefix>/<device>/set.
+func (p *Publisher) handleCommand(m mqtt.Message) {
+	key := strings.TrimSuffix(strings.TrimPrefix(m.Topic, p.topicPrefix+"/"), "/set")
+	payload := strings.TrimSpace(string(m.Payload))
+
+	var err error
+	if body, ok := setPointBodies[key]; ok {
+		var temp float64
+		temp, err = strconv.ParseFloat(payload, 64)
+		if err == nil {
+			p.log.Printf("Setting %s to %s", key, payload)
+			err = p.bridge.SetHeatSetPoint(body, int(math.Round(temp)))
+		}
+	} else {
+		err = p.setCircuit(key, payload)
+	}
+	if err != nil {
+		p.log.Printf("Command %q on %s failed: %v", payload, m.Topic, err)
+		return
+	}
+
+	p.publishDevices()
+}
+
+// setCircuit switches the circuit behind a device on or off.
+func (p *Publisher) setCircuit(key, payload string) error {
+	var state int
+	switch payload {
+	case "ON":
+		state = 1
+	case "OFF":
+		state = 0
+	default:
+		return fmt.Errorf("want ON or OFF")
+	}
+
+	circuitID, err := p.bridge.CircuitForDevice(key)
+	if err != nil {
+		return err
+	}
+	p.log.Printf("Turning %s %s", key, strings.ToLower(payload))
+	return p.bridge.SetCircuit(circuitID, state)
+}
+
+// statusTopic carries the availability payloads.
+func (p *Publisher) statusTopic() string {
+	return p.topicPrefix + "/status"
+}
+
+// stateTopic carries a device's state.
+func (p *Publisher) stateTopic(key string) string {
+	return p.topicPrefix + "/" + key + "/state"
+}
+
+// commandTopic receives commands for a device.
+func (p *Publisher) commandTopic(key string) string {
+	return p.topicPrefix + "/" + key + "/set"
+}
@@ -0,0 +1,171 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+	"github.com/nstielau/pool-controller/internal/mqtt"
+	"github.com/nstielau/pool-controller/internal/mqtt/mqttsim"
+	"github.com/nstielau/pool-controller/internal/pool"
+)
+
+// startPublisher runs a Publisher for a simulated gateway against an
+// in-process broker.
+func startPublisher(t *testing.T) (*gatewaysim.Server, *mqttsim.Broker, context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+
+	sim := gatewaysim.NewServer(gatewaysim.DefaultScenario())
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	t.Setenv("TIMERS_FILE", filepath.Join(t.TempDir(), "timers.json"))
+	bridge, err := pool.NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+
+	broker := mqttsim.NewBroker()
+	if err := broker.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("broker Listen() error = %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p := New(broker.Addr().String(), bridge, 20*time.Millisecond)
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return sim, broker, cancel, done
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// retained returns a func reporting whether topic holds want.
+func retained(b *mqttsim.Broker, topic, want string) func() bool {
+	return func() bool {
+		payload, _ := b.Retained(topic)
+		return string(payload) == want
+	}
+}
+
+// discoveryConfig returns a retained discovery config.
+func discoveryConfig(t *testing.T, b *mqttsim.Broker, topic string) map[string]interface{} {
+	t.Helper()
+	var config map[string]interface{}
+	waitFor(t, topic, func() bool {
+		payload, ok := b.Retained(topic)
+		return ok && json.Unmarshal(payload, &config) == nil
+	})
+	return config
+}
+
+func TestPublisherDiscoveryAndState(t *testing.T) {
+	sim, broker, _, _ := startPublisher(t)
+
+	waitFor(t, "online", retained(broker, "pool-controller/status", "online"))
+
+	spa := discoveryConfig(t, broker, "homeassistant/switch/pool-controller/spa/config")
+	if spa["command_topic"] != "pool-controller/spa/set" || spa["state_topic"] != "pool-controller/spa/state" ||
+		spa["availability_topic"] != "pool-controller/status" || spa["unique_id"] != "pool-controller_spa" {
+		t.Errorf("spa config = %v", spa)
+	}
+
+	temp := discoveryConfig(t, broker, "homeassistant/sensor/pool-controller/current_spa_temperature/config")
+	if temp["device_class"] != "temperature" || temp["unit_of_measurement"] != "°F" || temp["state_class"] != "measurement" {
+		t.Errorf("spa temperature config = %v", temp)
+	}
+
+	setPoint := discoveryConfig(t, broker, "homeassistant/number/pool-controller/spa_heat_set_point/config")
+	if setPoint["command_topic"] != "pool-controller/spa_heat_set_point/set" || setPoint["min"] == nil || setPoint["max"] == nil {
+		t.Errorf("spa set point config = %v", setPoint)
+	}
+
+	waitFor(t, "spa state", retained(broker, "pool-controller/spa/state", "OFF"))
+	waitFor(t, "spa temperature", retained(broker, "pool-controller/current_spa_temperature/state", "99"))
+	waitFor(t, "heat mode", func() bool {
+		payload, ok := broker.Retained("pool-controller/spa_heat_mode/state")
+		return ok && len(payload) > 0
+	})
+
+	// A change at the panel arrives as a push and is republished
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		for i := range sc.Circuits {
+			if sc.Circuits[i].ID == gateway.CircuitCleaner {
+				sc.Circuits[i].State = 1
+			}
+		}
+	})
+	waitFor(t, "cleaner on", retained(broker, "pool-controller/cleaner/state", "ON"))
+}
+
+func TestPublisherCommands(t *testing.T) {
+	sim, broker, _, _ := startPublisher(t)
+	waitFor(t, "spa state", retained(broker, "pool-controller/spa/state", "OFF"))
+
+	broker.Publish(mqtt.Message{Topic: "pool-controller/spa/set", Payload: []byte("ON")})
+	waitFor(t, "spa on", retained(broker, "pool-controller/spa/state", "ON"))
+	for _, c := range sim.Scenario().Circuits {
+		if c.ID == gateway.CircuitSpa && c.State != 1 {
+			t.Error("simulated spa should be on")
+		}
+	}
+
+	// Home Assistant number entities send floats
+	broker.Publish(mqtt.Message{Topic: "pool-controller/spa_heat_set_point/set", Payload: []byte("102.0")})
+	waitFor(t, "set point", retained(broker, "pool-controller/spa_heat_set_point/state", "102"))
+
+	// Sensors ignore commands
+	broker.Publish(mqtt.Message{Topic: "pool-controller/current_spa_temperature/set", Payload: []byte("ON")})
+	broker.Publish(mqtt.Message{Topic: "pool-controller/spa/set", Payload: []byte("maybe")})
+	time.Sleep(50 * time.Millisecond)
+	if payload, _ := broker.Retained("pool-controller/spa/state"); string(payload) != "ON" {
+		t.Errorf("spa state = %q after bad commands", payload)
+	}
+}
+
+func TestPublisherAvailability(t *testing.T) {
+	_, broker, cancel, done := startPublisher(t)
+	waitFor(t, "spa state", retained(broker, "pool-controller/spa/state", "OFF"))
+
+	// After a lost connection it reconnects and announces itself again
+	broker.Publish(mqtt.Message{Topic: "homeassistant/switch/pool-controller/spa/config", Retain: true})
+	if !broker.DropClient("pool-controller") {
+		t.Fatal("publisher is not connected")
+	}
+	waitFor(t, "rediscovery", func() bool {
+		_, ok := broker.Retained("homeassistant/switch/pool-controller/spa/config")
+		return ok
+	})
+	waitFor(t, "online", retained(broker, "pool-controller/status", "online"))
+
+	// Shutting down marks it offline without relying on the will
+	cancel()
+	<-done
+	waitFor(t, "offline", retained(broker, "pool-controller/status", "offline"))
+	waitFor(t, "disconnect", func() bool { return len(broker.Clients()) == 0 })
+}
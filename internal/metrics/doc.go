@@ -0,0 +1,20 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format.
+//
+// It covers what this service exports and nothing more, so the controller
+// needs no client library. Metrics are created once, usually as package
+// variables, in the Default registry:
+//
+//	var queries = metrics.NewCounter("pool_gateway_queries_total",
+//	    "Gateway queries sent, by message code.", "code")
+//
+//	queries.Inc("12526")
+//
+// Values only known when scraped, such as device states, are written
+// directly with a Writer after the registry:
+//
+//	w := metrics.NewWriter(resp)
+//	metrics.Default.Write(w)
+//	w.Family("pool_up", "Whether the pool is up.", metrics.GaugeType)
+//	w.Sample("pool_up", 1)
+package metrics
@@ -0,0 +1,362 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is a Prometheus metric type.
+type Type string
+
+// Metric types.
+const (
+	CounterType   Type = "counter"
+	GaugeType     Type = "gauge"
+	HistogramType Type = "histogram"
+)
+
+// DefBuckets are histogram buckets, in seconds, suited to network and
+// HTTP latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a registered metric family.
+type metric interface {
+	name() string
+	write(w *Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry the package-level constructors add to.
+var Default = NewRegistry()
+
+// register adds m, panicking if its name is taken.
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.metrics {
+		if existing.name() == m.name() {
+			panic(fmt.Sprintf("metrics: %s registered twice", m.name()))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every registered family to w.
+func (r *Registry) Write(w *Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+	return w.Err()
+}
+
+// desc describes a metric family and its label names.
+type desc struct {
+	fname  string
+	help   string
+	labels []string
+}
+
+func (d *desc) name() string { return d.fname }
+
+// key joins label values into a map key, panicking if the number of
+// values doesn't match the family's labels.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.fname, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// pairs interleaves the family's label names with values.
+func (d *desc) pairs(values []string, extra ...string) []string {
+	pairs := make([]string, 0, 2*len(values)+len(extra))
+	for i, v := range values {
+		pairs = append(pairs, d.labels[i], v)
+	}
+	return append(pairs, extra...)
+}
+
+// sortedKeys returns the keys of m in order, so output is stable.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// value is one labelled value of a counter or gauge.
+type value struct {
+	labels []string
+	v      float64
+}
+
+// Counter is a family of values that only go up.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+// NewCounter creates a counter in r with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, labels}, values: make(map[string]*value)}
+	r.register(c)
+	return c
+}
+
+// NewCounter creates a counter in the Default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given
+// label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values[k] == nil {
+		c.values[k] = &value{labels: append([]string(nil), labelValues...)}
+	}
+	c.values[k].v += v
+}
+
+// Value returns the counter with the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if val := c.values[k]; val != nil {
+		return val.v
+	}
+	return 0
+}
+
+func (c *Counter) write(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Family(c.fname, c.help, CounterType)
+	for _, k := range sortedKeys(c.values) {
+		val := c.values[k]
+		w.Sample(c.fname, val.v, c.pairs(val.labels)...)
+	}
+}
+
+// Gauge is a family of values that go up and down.
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+// NewGauge creates a gauge in r with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name, help, labels}, values: make(map[string]*value)}
+	r.register(g)
+	return g
+}
+
+// NewGauge creates a gauge in the Default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// Set sets the gauge with the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[k] = &value{labels: append([]string(nil), labelValues...), v: v}
+}
+
+// Value returns the gauge with the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if val := g.values[k]; val != nil {
+		return val.v
+	}
+	return 0
+}
+
+func (g *Gauge) write(w *Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w.Family(g.fname, g.help, GaugeType)
+	for _, k := range sortedKeys(g.values) {
+		val := g.values[k]
+		w.Sample(g.fname, val.v, g.pairs(val.labels)...)
+	}
+}
+
+// histogramValue is one labelled histogram.
+type histogramValue struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram is a family of observation distributions.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+// NewHistogram creates a histogram in r with the given upper bucket
+// bounds, in increasing order, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{name, help, labels}, buckets: buckets, values: make(map[string]*histogramValue)}
+	r.register(h)
+	return h
+}
+
+// NewHistogram creates a histogram in the Default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.values[k]
+	if hv == nil {
+		hv = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of observations with the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv := h.values[k]; hv != nil {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Family(h.fname, h.help, HistogramType)
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += hv.counts[i]
+			w.Sample(h.fname+"_bucket", float64(cumulative), h.pairs(hv.labels, "le", formatFloat(le))...)
+		}
+		w.Sample(h.fname+"_bucket", float64(hv.count), h.pairs(hv.labels, "le", "+Inf")...)
+		w.Sample(h.fname+"_sum", hv.sum, h.pairs(hv.labels)...)
+		w.Sample(h.fname+"_count", float64(hv.count), h.pairs(hv.labels)...)
+	}
+}
+
+// Writer writes metrics in the Prometheus text format. It keeps the first
+// write error, which Err returns.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter returns a Writer to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Family starts a metric family with its HELP and TYPE lines. Its samples
+// must follow before the next family.
+func (w *Writer) Family(name, help string, typ Type) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+// Sample writes one sample. labelPairs alternate label names and values.
+func (w *Writer) Sample(name string, v float64, labelPairs ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labelPairs) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labelPairs); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", labelPairs[i], escapeLabel(labelPairs[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+	w.printf("%s", b.String())
+}
+
+// Err returns the first error from the underlying writer.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// formatFloat formats v the way Prometheus parses it.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	queries := r.NewCounter("test_queries_total", "Queries sent.", "code")
+	connected := r.NewGauge("test_connected", "Whether connected.")
+	latency := r.NewHistogram("test_latency_seconds", "Query latency.", []float64{0.1, 1}, "code")
+
+	queries.Inc("8300")
+	queries.Add(2, "12526")
+	queries.Inc("8300")
+	connected.Set(1)
+	latency.Observe(0.05, "8300")
+	latency.Observe(0.5, "8300")
+	latency.Observe(3, "8300")
+
+	var b strings.Builder
+	if err := r.Write(NewWriter(&b)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `# HELP test_queries_total Queries sent.
+# TYPE test_queries_total counter
+test_queries_total{code="12526"} 2
+test_queries_total{code="8300"} 2
+# HELP test_connected Whether connected.
+# TYPE test_connected gauge
+test_connected 1
+# HELP test_latency_seconds Query latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{code="8300",le="0.1"} 1
+test_latency_seconds_bucket{code="8300",le="1"} 2
+test_latency_seconds_bucket{code="8300",le="+Inf"} 3
+test_latency_seconds_sum{code="8300"} 3.55
+test_latency_seconds_count{code="8300"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+
+	if queries.Value("8300") != 2 || connected.Value() != 1 || latency.Count("8300") != 3 || latency.Count("0") != 0 {
+		t.Error("Value/Count don't match what was recorded")
+	}
+}
+
+func TestWriterEscapes(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Family("test_device", "Device \\ state\nper line.", GaugeType)
+	w.Sample("test_device", 78.5, "name", `Spa "Jets"`, "unit", "°F")
+
+	want := "# HELP test_device Device \\\\ state\\nper line.\n# TYPE test_device gauge\n" +
+		`test_device{name="Spa \"Jets\"",unit="°F"} 78.5` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("test_up", "Up.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice should panic")
+		}
+	}()
+	r.NewCounter("test_up", "Up again.")
+}
@@ -0,0 +1,359 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client tuning defaults.
+const (
+	DefaultKeepAlive    = 30 * time.Second
+	dialTimeout         = 10 * time.Second
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 60 * time.Second
+	messageQueueSize    = 32
+)
+
+// ErrNotConnected is returned by Publish while the client is reconnecting.
+var ErrNotConnected = errors.New("mqtt: not connected")
+
+// Options configures a Client.
+type Options struct {
+	Broker    string // host:port
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // DefaultKeepAlive if 0
+	Will      *Message
+
+	// OnConnect is called after every successful connect, once
+	// subscriptions are renewed. It may call Publish.
+	OnConnect func()
+}
+
+// Client is an MQTT 3.1.1 client that publishes and receives at QoS 0.
+//
+// Like gateway.Session it keeps one connection open in the background and
+// reconnects with exponential backoff when it drops. Subscriptions are
+// renewed on every connect, and handlers run on a single goroutine in
+// arrival order.
+type Client struct {
+	opts   Options
+	logger *log.Logger
+
+	writeMu sync.Mutex // serializes packet writes
+
+	mu      sync.Mutex
+	conn    net.Conn
+	subs    []subscription
+	nextID  uint16
+	started bool
+
+	messages  chan Message
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// subscription is a topic filter and its handler.
+type subscription struct {
+	filter  string
+	handler func(Message)
+}
+
+// NewClient creates a client. Call Start to begin connecting.
+func NewClient(opts Options) *Client {
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	return &Client{
+		opts:     opts,
+		logger:   log.New(os.Stdout, "[mqtt] ", log.LstdFlags),
+		messages: make(chan Message, messageQueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start connects to the broker in the background and stays connected
+// until Close is called.
+func (c *Client) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		return
+	}
+	c.started = true
+	go c.run()
+	go c.deliver()
+}
+
+// Close publishes the will itself and disconnects cleanly, so subscribers
+// see the same message whether the client stopped or was lost.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	if started {
+		<-c.done
+	}
+	return nil
+}
+
+// IsConnected returns true while the client has a connection.
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Publish sends a QoS 0 message. It fails with ErrNotConnected while the
+// client is reconnecting; OnConnect is the place to publish state again.
+func (c *Client) Publish(m Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return c.write(conn, NewPublish(m))
+}
+
+// Subscribe calls handler with every message on topics matching filter.
+// The subscription is sent now if connected and renewed after reconnects.
+func (c *Client) Subscribe(filter string, handler func(Message)) error {
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{filter, handler})
+	conn := c.conn
+	id := c.packetID()
+	c.mu.Unlock()
+
+	if conn == nil {
+		// serve subscribes as soon as the connection is up
+		return nil
+	}
+	return c.write(conn, NewSubscribe(id, filter))
+}
+
+// packetID returns the next non-zero packet ID. Caller must hold c.mu.
+func (c *Client) packetID() uint16 {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+// write sends p on conn, dropping the connection if that fails.
+func (c *Client) write(conn net.Conn, p Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(c.opts.KeepAlive))
+	if _, err := conn.Write(p.Encode()); err != nil {
+		c.drop(conn, err)
+		return fmt.Errorf("mqtt: write failed: %w", err)
+	}
+	return nil
+}
+
+// run is the connection supervisor: connect, serve until the connection
+// drops, then reconnect with backoff.
+func (c *Client) run() {
+	defer close(c.done)
+
+	backoff := minReconnectBackoff
+	for {
+		conn, err := c.connect()
+		if err != nil {
+			c.logger.Printf("Connect to %s failed, retrying in %v: %v", c.opts.Broker, backoff, err)
+			select {
+			case <-c.closing:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			continue
+		}
+
+		c.logger.Printf("Connected to broker %s", c.opts.Broker)
+		backoff = minReconnectBackoff
+		c.serve(conn)
+
+		select {
+		case <-c.closing:
+			return
+		default:
+		}
+	}
+}
+
+// connect dials the broker and completes the CONNECT handshake.
+func (c *Client) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", c.opts.Broker, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	connect := Connect{
+		ClientID:  c.opts.ClientID,
+		Username:  c.opts.Username,
+		Password:  c.opts.Password,
+		KeepAlive: uint16(c.opts.KeepAlive / time.Second),
+		Will:      c.opts.Will,
+	}
+	if _, err := conn.Write(connect.Packet().Encode()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ack, err := ReadPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ack.Type != TypeConnAck || len(ack.Body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: expected CONNACK, got type %d", ErrMalformed, ack.Type)
+	}
+	if code := ack.Body[1]; code != ConnAccepted {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection: return code %d", code)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// serve publishes conn to callers and pings the broker until the
+// connection drops.
+func (c *Client) serve(conn net.Conn) {
+	dead := make(chan struct{})
+
+	c.mu.Lock()
+	c.conn = conn
+	var filters []string
+	for _, s := range c.subs {
+		filters = append(filters, s.filter)
+	}
+	id := c.packetID()
+	c.mu.Unlock()
+
+	go c.readLoop(conn, dead)
+
+	if len(filters) > 0 {
+		c.write(conn, NewSubscribe(id, filters...))
+	}
+	if c.opts.OnConnect != nil {
+		c.opts.OnConnect()
+	}
+
+	ticker := time.NewTicker(c.opts.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dead:
+			return
+		case <-c.closing:
+			if c.opts.Will != nil {
+				c.write(conn, NewPublish(*c.opts.Will))
+			}
+			c.write(conn, Packet{Type: TypeDisconnect})
+			c.drop(conn, nil)
+			<-dead
+			return
+		case <-ticker.C:
+			c.write(conn, Packet{Type: TypePingReq})
+		}
+	}
+}
+
+// readLoop reads packets from conn until it fails, queueing messages for
+// the handlers. The broker answers pings, so a silent connection is dead.
+func (c *Client) readLoop(conn net.Conn, dead chan struct{}) {
+	defer close(dead)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		p, err := ReadPacket(conn)
+		if err != nil {
+			c.drop(conn, err)
+			return
+		}
+
+		if p.Type != TypePublish {
+			continue // CONNACK, SUBACK and PINGRESP need no action
+		}
+		m, id, err := ParsePublish(p)
+		if err != nil {
+			c.logger.Printf("Ignoring bad PUBLISH: %v", err)
+			continue
+		}
+		if id != 0 {
+			// QoS 1 from a broker that didn't downgrade
+			c.write(conn, Packet{Type: TypePubAck, Body: binary.BigEndian.AppendUint16(nil, id)})
+		}
+
+		select {
+		case c.messages <- m:
+		default:
+			c.logger.Printf("Message queue full, dropping message on %s", m.Topic)
+		}
+	}
+}
+
+// deliver runs handlers off the read loop so a slow handler cannot stall
+// pings.
+func (c *Client) deliver() {
+	for {
+		select {
+		case <-c.closing:
+			return
+		case m := <-c.messages:
+			c.mu.Lock()
+			var handlers []func(Message)
+			for _, s := range c.subs {
+				if Match(s.filter, m.Topic) {
+					handlers = append(handlers, s.handler)
+				}
+			}
+			c.mu.Unlock()
+
+			for _, h := range handlers {
+				h(m)
+			}
+		}
+	}
+}
+
+// drop closes conn and marks the client as reconnecting. It is a no-op if
+// conn has already been dropped. A nil reason is a clean disconnect.
+func (c *Client) drop(conn net.Conn, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != conn {
+		return
+	}
+	if reason != nil {
+		c.logger.Printf("Broker connection lost: %v", reason)
+	}
+	c.conn = nil
+	conn.Close()
+}
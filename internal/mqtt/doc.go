@@ -0,0 +1,32 @@
+// Package mqtt is a small MQTT 3.1.1 client for publishing pool state to a
+// broker such as Mosquitto.
+//
+// # Scope
+//
+// Messages are sent and received at QoS 0, which is what Home Assistant
+// uses for state and commands. Retained messages, wills (LWT) and
+// username/password authentication are supported; QoS 1 deliveries from a
+// broker are acknowledged but treated like QoS 0. Sessions are always
+// clean, so subscriptions are renewed on every connect.
+//
+// # Client
+//
+// A Client keeps one connection to the broker, pings it every KeepAlive
+// and reconnects with exponential backoff when the connection drops.
+// OnConnect runs after each connect, which is where a publisher re-sends
+// its retained state. Close publishes the will before disconnecting, so
+// stopping the client looks the same to subscribers as losing it.
+//
+//	client := mqtt.NewClient(mqtt.Options{
+//	    Broker:   "192.168.0.10:1883",
+//	    ClientID: "pool-controller",
+//	    Will:     &mqtt.Message{Topic: "pool-controller/status", Payload: []byte("offline"), Retain: true},
+//	})
+//	client.Subscribe("pool-controller/+/set", func(m mqtt.Message) {
+//	    log.Printf("%s: %s", m.Topic, m.Payload)
+//	})
+//	client.Start()
+//	defer client.Close()
+//
+// The mqttsim subpackage is a broker for tests.
+package mqtt
@@ -0,0 +1,264 @@
+package mqttsim
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/mqtt"
+)
+
+// connectTimeout is how long a new client has to send CONNECT.
+const connectTimeout = 5 * time.Second
+
+// Broker is an in-process MQTT 3.1.1 broker for tests. It keeps retained
+// messages, routes publishes to matching subscriptions at QoS 0 and
+// publishes a client's will when it disconnects without DISCONNECT.
+type Broker struct {
+	mu       sync.Mutex
+	listener net.Listener
+	clients  map[*brokerConn]bool
+	retained map[string][]byte
+	logger   *log.Logger
+	wg       sync.WaitGroup
+}
+
+// brokerConn is one client connection.
+type brokerConn struct {
+	net.Conn
+	writeMu  sync.Mutex
+	clientID string
+	will     *mqtt.Message
+	filters  []string // guarded by Broker.mu
+}
+
+// write sends p, serialized with publishes from other clients.
+func (c *brokerConn) write(p mqtt.Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Write(p.Encode())
+	return err
+}
+
+// NewBroker creates a broker with no retained messages.
+func NewBroker() *Broker {
+	return &Broker{
+		clients:  make(map[*brokerConn]bool),
+		retained: make(map[string][]byte),
+		logger:   log.New(os.Stdout, "[mqttsim] ", log.LstdFlags),
+	}
+}
+
+// Listen starts accepting clients on addr (e.g. "127.0.0.1:0").
+func (b *Broker) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.listener = l
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go b.accept(l)
+	return nil
+}
+
+// Addr returns the address the broker listens on.
+func (b *Broker) Addr() *net.TCPAddr {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.listener.Addr().(*net.TCPAddr)
+}
+
+// Close stops listening and drops every client without publishing wills.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.listener != nil {
+		b.listener.Close()
+	}
+	for c := range b.clients {
+		c.will = nil
+		c.Close()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+// DropClient closes a client's connection as a network failure would, so
+// its will is published. It returns false if no such client is connected.
+func (b *Broker) DropClient(clientID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		if c.clientID == clientID {
+			c.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// Clients returns the IDs of the connected clients.
+func (b *Broker) Clients() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ids []string
+	for c := range b.clients {
+		ids = append(ids, c.clientID)
+	}
+	return ids
+}
+
+// Retained returns the retained message on topic.
+func (b *Broker) Retained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return payload, ok
+}
+
+// Publish routes m as if a client had published it.
+func (b *Broker) Publish(m mqtt.Message) {
+	b.route(m)
+}
+
+func (b *Broker) accept(l net.Listener) {
+	defer b.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go b.serve(&brokerConn{Conn: conn})
+	}
+}
+
+func (b *Broker) serve(c *brokerConn) {
+	defer b.wg.Done()
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(connectTimeout))
+	p, err := mqtt.ReadPacket(c)
+	if err != nil || p.Type != mqtt.TypeConnect {
+		return
+	}
+	connect, err := mqtt.ParseConnect(p)
+	if err != nil {
+		b.logger.Printf("Bad CONNECT from %s: %v", c.RemoteAddr(), err)
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+	c.clientID, c.will = connect.ClientID, connect.Will
+	if err := c.write(mqtt.NewConnAck(mqtt.ConnAccepted)); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.clients[c] = true
+	b.mu.Unlock()
+	b.logger.Printf("Client %q connected from %s", c.clientID, c.RemoteAddr())
+
+	clean := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		will := c.will
+		b.mu.Unlock()
+		if !clean && will != nil {
+			b.logger.Printf("Client %q lost, publishing will on %s", c.clientID, will.Topic)
+			b.route(*will)
+		}
+	}()
+
+	for {
+		p, err := mqtt.ReadPacket(c)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				b.logger.Printf("Client %q: %v", c.clientID, err)
+			}
+			return
+		}
+
+		switch p.Type {
+		case mqtt.TypePublish:
+			m, id, err := mqtt.ParsePublish(p)
+			if err != nil {
+				return
+			}
+			if id != 0 {
+				c.write(mqtt.Packet{Type: mqtt.TypePubAck, Body: []byte{byte(id >> 8), byte(id)}})
+			}
+			b.route(m)
+		case mqtt.TypeSubscribe:
+			id, filters, err := mqtt.ParseSubscribe(p)
+			if err != nil {
+				return
+			}
+			b.subscribe(c, id, filters)
+		case mqtt.TypePingReq:
+			c.write(mqtt.Packet{Type: mqtt.TypePingResp})
+		case mqtt.TypeDisconnect:
+			clean = true
+			return
+		}
+	}
+}
+
+// subscribe adds filters for c, acknowledges them and sends the matching
+// retained messages.
+func (b *Broker) subscribe(c *brokerConn, id uint16, filters []string) {
+	b.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	var retained []mqtt.Message
+	for topic, payload := range b.retained {
+		for _, f := range filters {
+			if mqtt.Match(f, topic) {
+				retained = append(retained, mqtt.Message{Topic: topic, Payload: payload, Retain: true})
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	c.write(mqtt.NewSubAck(id, len(filters)))
+	for _, m := range retained {
+		c.write(mqtt.NewPublish(m))
+	}
+}
+
+// route stores m if retained and forwards it to every matching client.
+func (b *Broker) route(m mqtt.Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m.Payload
+		}
+	}
+	var targets []*brokerConn
+	for c := range b.clients {
+		for _, f := range c.filters {
+			if mqtt.Match(f, m.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	// Live deliveries don't carry the retain flag
+	forward := mqtt.NewPublish(mqtt.Message{Topic: m.Topic, Payload: m.Payload})
+	for _, c := range targets {
+		c.write(forward)
+	}
+}
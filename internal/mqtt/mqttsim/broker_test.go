@@ -0,0 +1,123 @@
+package mqttsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/mqtt"
+)
+
+// startBroker starts a broker on a free port.
+func startBroker(t *testing.T) *Broker {
+	t.Helper()
+	b := NewBroker()
+	if err := b.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientPublishSubscribe(t *testing.T) {
+	b := startBroker(t)
+
+	received := make(chan mqtt.Message, 4)
+	c := mqtt.NewClient(mqtt.Options{Broker: b.Addr().String(), ClientID: "test"})
+	c.Subscribe("pool/+/set", func(m mqtt.Message) { received <- m })
+	c.Start()
+	defer c.Close()
+	waitFor(t, "connect", c.IsConnected)
+
+	if err := c.Publish(mqtt.Message{Topic: "pool/spa/state", Payload: []byte("ON"), Retain: true}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitFor(t, "retained state", func() bool {
+		payload, ok := b.Retained("pool/spa/state")
+		return ok && string(payload) == "ON"
+	})
+
+	// Wait for the subscription to land before publishing to it
+	waitFor(t, "subscription", func() bool {
+		b.Publish(mqtt.Message{Topic: "pool/spa/set", Payload: []byte("OFF")})
+		select {
+		case m := <-received:
+			return m.Topic == "pool/spa/set" && string(m.Payload) == "OFF"
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+
+	b.Publish(mqtt.Message{Topic: "pool/spa/state", Payload: []byte("OFF")})
+	select {
+	case m := <-received:
+		t.Errorf("received %s, which doesn't match the filter", m.Topic)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientWillAndReconnect(t *testing.T) {
+	b := startBroker(t)
+
+	// A second client watches the status topic, since the first reconnects
+	// and replaces the will faster than polling could see it
+	statuses := make(chan string, 8)
+	watcher := mqtt.NewClient(mqtt.Options{Broker: b.Addr().String(), ClientID: "watcher"})
+	watcher.Subscribe("pool/status", func(m mqtt.Message) { statuses <- string(m.Payload) })
+	watcher.Start()
+	defer watcher.Close()
+	waitFor(t, "watcher", watcher.IsConnected)
+
+	var c *mqtt.Client
+	c = mqtt.NewClient(mqtt.Options{
+		Broker:   b.Addr().String(),
+		ClientID: "test",
+		Will:     &mqtt.Message{Topic: "pool/status", Payload: []byte("offline"), Retain: true},
+		OnConnect: func() {
+			c.Publish(mqtt.Message{Topic: "pool/status", Payload: []byte("online"), Retain: true})
+		},
+	})
+	c.Start()
+	defer c.Close()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-statuses:
+			if got != want {
+				t.Fatalf("status = %q, want %q", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for status %q", want)
+		}
+	}
+	expect("online")
+
+	// A lost connection publishes the will; the client comes back on its own
+	if !b.DropClient("test") {
+		t.Fatal("DropClient() found no client")
+	}
+	expect("offline")
+	expect("online")
+
+	// Close publishes the will itself before disconnecting cleanly
+	c.Close()
+	expect("offline")
+	waitFor(t, "disconnect", func() bool { return len(b.Clients()) == 1 })
+	select {
+	case got := <-statuses:
+		t.Errorf("status %q after a clean disconnect", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
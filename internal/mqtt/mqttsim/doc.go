@@ -0,0 +1,15 @@
+// Package mqttsim is an in-process MQTT broker for tests.
+//
+// It speaks enough MQTT 3.1.1 for the mqtt package's Client: CONNECT with
+// a will, QoS 0 publish and subscribe with wildcards, retained messages
+// and pings. Tests inspect retained topics with Retained, inject commands
+// with Publish, and simulate a network failure with DropClient, which
+// publishes the client's will.
+//
+//	broker := mqttsim.NewBroker()
+//	broker.Listen("127.0.0.1:0")
+//	defer broker.Close()
+//
+//	client := mqtt.NewClient(mqtt.Options{Broker: broker.Addr().String(), ClientID: "test"})
+//	client.Start()
+package mqttsim
@@ -0,0 +1,319 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Control packet types (MQTT 3.1.1 section 2.2.1). Only what a QoS 0
+// client and the test broker need.
+const (
+	TypeConnect    byte = 1
+	TypeConnAck    byte = 2
+	TypePublish    byte = 3
+	TypePubAck     byte = 4
+	TypeSubscribe  byte = 8
+	TypeSubAck     byte = 9
+	TypePingReq    byte = 12
+	TypePingResp   byte = 13
+	TypeDisconnect byte = 14
+)
+
+// CONNACK return codes.
+const (
+	ConnAccepted       byte = 0
+	ConnBadCredentials byte = 4
+	ConnNotAuthorized  byte = 5
+)
+
+// Wire limits. maxPacketSize bounds the packets read; discovery configs
+// are well under a kilobyte.
+const (
+	protocolLevel311      = 4
+	maxRemainingLengthLen = 4
+	maxPacketSize         = 1 << 20
+)
+
+// ErrMalformed is returned for packets that don't follow the protocol.
+var ErrMalformed = errors.New("mqtt: malformed packet")
+
+// Packet is an MQTT control packet: the type and flags from the fixed
+// header, and everything after the remaining length.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// ReadPacket reads one control packet from r.
+func ReadPacket(r io.Reader) (Packet, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return Packet{}, err
+	}
+	p := Packet{Type: b[0] >> 4, Flags: b[0] & 0x0f}
+
+	// Remaining length: 7 bits per byte, least significant first
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == maxRemainingLengthLen {
+			return Packet{}, fmt.Errorf("%w: remaining length too long", ErrMalformed)
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Packet{}, err
+		}
+		length += int(b[0]&0x7f) * multiplier
+		if b[0]&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return Packet{}, fmt.Errorf("%w: %d byte packet", ErrMalformed, length)
+	}
+
+	p.Body = make([]byte, length)
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return Packet{}, err
+	}
+	return p, nil
+}
+
+// Encode returns the packet as sent on the wire.
+func (p Packet) Encode() []byte {
+	buf := make([]byte, 0, 5+len(p.Body))
+	buf = append(buf, p.Type<<4|p.Flags)
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(buf, p.Body...)
+}
+
+// appendString appends s with its two-byte length prefix.
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// readString reads a length-prefixed string at offset and returns it with
+// the offset after it.
+func readString(buf []byte, offset int) (string, int, error) {
+	if offset+2 > len(buf) {
+		return "", 0, ErrMalformed
+	}
+	n := int(binary.BigEndian.Uint16(buf[offset:]))
+	offset += 2
+	if offset+n > len(buf) {
+		return "", 0, ErrMalformed
+	}
+	return string(buf[offset : offset+n]), offset + n, nil
+}
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// NewPublish returns a QoS 0 PUBLISH packet for m.
+func NewPublish(m Message) Packet {
+	var flags byte
+	if m.Retain {
+		flags = 0x01
+	}
+	body := appendString(nil, m.Topic)
+	return Packet{Type: TypePublish, Flags: flags, Body: append(body, m.Payload...)}
+}
+
+// ParsePublish decodes a PUBLISH packet. The packet ID is 0 for QoS 0.
+func ParsePublish(p Packet) (Message, uint16, error) {
+	topic, offset, err := readString(p.Body, 0)
+	if err != nil {
+		return Message{}, 0, err
+	}
+
+	var id uint16
+	if qos := (p.Flags >> 1) & 0x03; qos > 0 {
+		if offset+2 > len(p.Body) {
+			return Message{}, 0, ErrMalformed
+		}
+		id = binary.BigEndian.Uint16(p.Body[offset:])
+		offset += 2
+	}
+
+	return Message{
+		Topic:   topic,
+		Payload: append([]byte(nil), p.Body[offset:]...),
+		Retain:  p.Flags&0x01 != 0,
+	}, id, nil
+}
+
+// Connect is the content of a CONNECT packet. Sessions are always clean.
+type Connect struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive uint16   // seconds
+	Will      *Message // published by the broker if the client vanishes
+}
+
+// CONNECT flag bits.
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// Packet returns the CONNECT packet.
+func (c Connect) Packet() Packet {
+	flags := byte(flagCleanSession)
+	if c.Will != nil {
+		flags |= flagWill
+		if c.Will.Retain {
+			flags |= flagWillRetain
+		}
+	}
+	if c.Username != "" {
+		flags |= flagUsername
+	}
+	if c.Password != "" {
+		flags |= flagPassword
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel311, flags)
+	body = binary.BigEndian.AppendUint16(body, c.KeepAlive)
+	body = appendString(body, c.ClientID)
+	if c.Will != nil {
+		body = appendString(body, c.Will.Topic)
+		body = appendString(body, string(c.Will.Payload))
+	}
+	if c.Username != "" {
+		body = appendString(body, c.Username)
+	}
+	if c.Password != "" {
+		body = appendString(body, c.Password)
+	}
+	return Packet{Type: TypeConnect, Body: body}
+}
+
+// ParseConnect decodes a CONNECT packet.
+func ParseConnect(p Packet) (Connect, error) {
+	name, offset, err := readString(p.Body, 0)
+	if err != nil {
+		return Connect{}, err
+	}
+	if name != "MQTT" || offset+4 > len(p.Body) {
+		return Connect{}, fmt.Errorf("%w: not MQTT 3.1.1", ErrMalformed)
+	}
+	flags := p.Body[offset+1]
+	c := Connect{KeepAlive: binary.BigEndian.Uint16(p.Body[offset+2:])}
+	offset += 4
+
+	if c.ClientID, offset, err = readString(p.Body, offset); err != nil {
+		return Connect{}, err
+	}
+	if flags&flagWill != 0 {
+		var topic, payload string
+		if topic, offset, err = readString(p.Body, offset); err != nil {
+			return Connect{}, err
+		}
+		if payload, offset, err = readString(p.Body, offset); err != nil {
+			return Connect{}, err
+		}
+		c.Will = &Message{Topic: topic, Payload: []byte(payload), Retain: flags&flagWillRetain != 0}
+	}
+	if flags&flagUsername != 0 {
+		if c.Username, offset, err = readString(p.Body, offset); err != nil {
+			return Connect{}, err
+		}
+	}
+	if flags&flagPassword != 0 {
+		if c.Password, _, err = readString(p.Body, offset); err != nil {
+			return Connect{}, err
+		}
+	}
+	return c, nil
+}
+
+// NewConnAck returns a CONNACK packet with the given return code.
+func NewConnAck(code byte) Packet {
+	return Packet{Type: TypeConnAck, Body: []byte{0, code}}
+}
+
+// NewSubscribe returns a SUBSCRIBE packet for filters at QoS 0.
+func NewSubscribe(id uint16, filters ...string) Packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+	return Packet{Type: TypeSubscribe, Flags: 0x02, Body: body}
+}
+
+// ParseSubscribe decodes a SUBSCRIBE packet.
+func ParseSubscribe(p Packet) (uint16, []string, error) {
+	if len(p.Body) < 2 {
+		return 0, nil, ErrMalformed
+	}
+	id := binary.BigEndian.Uint16(p.Body)
+
+	var filters []string
+	for offset := 2; offset < len(p.Body); {
+		f, next, err := readString(p.Body, offset)
+		if err != nil || next >= len(p.Body) {
+			return 0, nil, ErrMalformed
+		}
+		filters = append(filters, f)
+		offset = next + 1 // requested QoS
+	}
+	if len(filters) == 0 {
+		return 0, nil, ErrMalformed
+	}
+	return id, filters, nil
+}
+
+// NewSubAck returns a SUBACK granting QoS 0 to n filters.
+func NewSubAck(id uint16, n int) Packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	return Packet{Type: TypeSubAck, Body: append(body, make([]byte, n)...)}
+}
+
+// Match reports whether topic matches filter, which may use the + (one
+// level) and # (any remaining levels) wildcards. Wildcards don't match
+// topics starting with $.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && !strings.HasPrefix(filter, "$") {
+		return false
+	}
+
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	// Long enough to need a two-byte remaining length
+	payload := bytes.Repeat([]byte("x"), 300)
+	in := NewPublish(Message{Topic: "pool-controller/spa/state", Payload: payload, Retain: true})
+
+	p, err := ReadPacket(bytes.NewReader(in.Encode()))
+	if err != nil {
+		t.Fatalf("ReadPacket() error = %v", err)
+	}
+	m, id, err := ParsePublish(p)
+	if err != nil {
+		t.Fatalf("ParsePublish() error = %v", err)
+	}
+	if m.Topic != "pool-controller/spa/state" || !bytes.Equal(m.Payload, payload) || !m.Retain || id != 0 {
+		t.Errorf("ParsePublish() = %q retain %t id %d", m.Topic, m.Retain, id)
+	}
+
+	if _, err := ReadPacket(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})); err == nil {
+		t.Error("ReadPacket() should reject a five-byte remaining length")
+	}
+}
+
+func TestConnectRoundTrip(t *testing.T) {
+	in := Connect{
+		ClientID:  "pool-controller",
+		Username:  "pool",
+		Password:  "secret",
+		KeepAlive: 30,
+		Will:      &Message{Topic: "pool-controller/status", Payload: []byte("offline"), Retain: true},
+	}
+
+	got, err := ParseConnect(in.Packet())
+	if err != nil {
+		t.Fatalf("ParseConnect() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("ParseConnect() = %+v, want %+v", got, in)
+	}
+
+	bare, err := ParseConnect(Connect{ClientID: "c"}.Packet())
+	if err != nil || bare.Will != nil || bare.Username != "" {
+		t.Errorf("ParseConnect(bare) = %+v, %v", bare, err)
+	}
+}
+
+func TestSubscribeRoundTrip(t *testing.T) {
+	id, filters, err := ParseSubscribe(NewSubscribe(7, "a/+/set", "b/#"))
+	if err != nil || id != 7 || !reflect.DeepEqual(filters, []string{"a/+/set", "b/#"}) {
+		t.Errorf("ParseSubscribe() = %d %v %v", id, filters, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"pool-controller/+/set", "pool-controller/spa/set", true},
+		{"pool-controller/+/set", "pool-controller/spa/state", false},
+		{"pool-controller/+/set", "pool-controller/spa/light/set", false},
+		{"homeassistant/#", "homeassistant/switch/pool/spa/config", true},
+		{"homeassistant/#", "homeassistant", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %t, want %t", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -2,12 +2,25 @@ package pool
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/series"
+)
+
+// Errors returned by Bridge control methods. Callers can match them with
+// errors.Is to tell bad input apart from gateway failures.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidValue = errors.New("invalid value")
+	ErrReadOnly     = errors.New("read-only device")
 )
 
 // Bridge is the main interface to the pool system.
@@ -16,27 +29,80 @@ type Bridge struct {
 	data           *gateway.PoolData
 	devices        map[string]Device
 	switches       map[int]*Switch
-	conn           *gateway.Connection
+	lights         map[int]*Light
+	timers         *circuitTimers
+	clock          *clockSync
+	series         *series.Store
+	events         *eventBus
+	session        *gateway.Session
 	gatewayIP      string
 	gatewayPort    int
 	lastUpdate     time.Time
+	statusAt       time.Time // when the last status answer was read
 	updateInterval time.Duration
 	timeout        time.Duration
 }
 
 // NewBridge creates a new Bridge, discovering the gateway if needed.
+//
+// Discovery broadcasts to GATEWAY_DISCOVERY_ADDR if set (host:port, e.g. a
+// local gateway simulator), otherwise to the standard broadcast address.
+//
+// Pending auto-off timers are saved to TIMERS_FILE (default "timers.json").
+// CIRCUIT_MAX_RUNTIMES caps how long circuits may run, e.g. "502=45m,500=4h".
+//
+// Setting CLOCK_SYNC_INTERVAL (e.g. "1h") keeps the controller clock on
+// host time, correcting it when it drifts more than CLOCK_SYNC_MAX_DRIFT
+// (default 1m) or the host changes to or from DST.
+//
+// Setting SERIES_DIR records every status refresh and push there for GET
+// /pool/series; SERIES_RETENTION (e.g. "raw=7d,hourly=90d,daily=730d")
+// sets how long each resolution is kept.
 func NewBridge(gatewayIP string, gatewayPort int, updateInterval time.Duration) (*Bridge, error) {
 	b := &Bridge{
 		data:           gateway.NewPoolData(),
 		devices:        make(map[string]Device),
 		switches:       make(map[int]*Switch),
+		lights:         make(map[int]*Light),
+		events:         newEventBus(),
 		updateInterval: updateInterval,
 		timeout:        10 * time.Second,
 	}
 
+	timersFile := os.Getenv("TIMERS_FILE")
+	if timersFile == "" {
+		timersFile = "timers.json"
+	}
+	b.timers = newCircuitTimers(timersFile, func(circuitID int) error {
+		return b.SetCircuit(circuitID, 0)
+	})
+
+	maxRuntimes, err := parseMaxRuntimes(os.Getenv("CIRCUIT_MAX_RUNTIMES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIRCUIT_MAX_RUNTIMES: %w", err)
+	}
+	for id, d := range maxRuntimes {
+		b.timers.setMaxRuntime(id, d)
+	}
+
+	clockInterval, clockMaxDrift, err := parseClockSync(os.Getenv("CLOCK_SYNC_INTERVAL"), os.Getenv("CLOCK_SYNC_MAX_DRIFT"))
+	if err != nil {
+		return nil, err
+	}
+
+	b.series, err = openSeries()
+	if err != nil {
+		return nil, err
+	}
+
 	// Discover gateway if not provided
 	if gatewayIP == "" {
-		info, err := gateway.DiscoverGateway(5 * time.Second)
+		var info *gateway.GatewayInfo
+		if addr := os.Getenv("GATEWAY_DISCOVERY_ADDR"); addr != "" {
+			info, err = gateway.DiscoverGatewayAt(addr, 5*time.Second)
+		} else {
+			info, err = gateway.DiscoverGateway(5 * time.Second)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("gateway discovery failed: %w", err)
 		}
@@ -47,54 +113,124 @@ func NewBridge(gatewayIP string, gatewayPort int, updateInterval time.Duration)
 		b.gatewayPort = gatewayPort
 	}
 
-	// Initial connection and data load
-	err := b.loadInitialData()
+	// Persistent gateway session shared by all requests
+	b.session = gateway.NewSession(b.gatewayIP, b.gatewayPort, b.timeout)
+	b.session.Start()
+
+	// Restore auto-off timers from a previous run before the initial data
+	// load, so circuits that are already on keep their saved deadline rather
+	// than a fresh max runtime. A timer that expired while we were down
+	// waits on b.mu until the load is done.
+	b.mu.Lock()
+	if err := b.timers.load(); err != nil {
+		log.Printf("Ignoring saved timers: %v", err)
+	}
+	err = b.loadInitialData()
+	if err == nil {
+		b.syncTimers()
+	}
+	b.mu.Unlock()
 	if err != nil {
+		b.timers.stop()
+		b.session.Close()
 		return nil, err
 	}
 
+	// Apply status pushes as they arrive instead of waiting for a poll.
+	// Without them Update still polls, so a failed registration isn't fatal;
+	// the session retries it on the next reconnect.
+	if err := b.session.Subscribe(b.handlePush); err != nil {
+		log.Printf("Failed to subscribe to gateway pushes, polling only: %v", err)
+	}
+
+	if clockInterval > 0 {
+		b.clock = newClockSync(clockInterval, clockMaxDrift, b.querySystemTime, b.setSystemTime)
+		b.clock.start()
+	}
+
 	return b, nil
 }
 
-// loadInitialData connects to gateway and loads configuration and status.
-func (b *Bridge) loadInitialData() error {
-	conn := gateway.NewConnection(b.gatewayIP, b.gatewayPort)
-	err := conn.Connect(b.timeout)
-	if err != nil {
-		return err
+// handlePush applies a push message from the gateway to the device state.
+// Pushes read before the last status answer are older than it and would
+// undo changes (and cancel their timers), so they are dropped.
+func (b *Bridge) handlePush(msg []byte, received time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if received.Before(b.statusAt) {
+		return
+	}
+
+	applied, err := gateway.ApplyPush(msg, b.data)
+	if err != nil || !applied {
+		return
+	}
+
+	// A push stands in for the next poll, so it is recorded like one
+	b.updateDevices()
+	b.lastUpdate = time.Now()
+	b.recordSeries(b.lastUpdate)
+}
+
+// Close stops pending timers (they resume on the next start) and clock
+// sync, and shuts down the gateway session.
+func (b *Bridge) Close() error {
+	b.timers.stop()
+	if b.clock != nil {
+		b.clock.stop()
 	}
-	defer conn.Close()
+	return b.session.Close()
+}
 
+// loadInitialData loads configuration and status over the session.
+func (b *Bridge) loadInitialData() error {
 	// Query config first (needed for temperature unit)
-	err = gateway.QueryConfig(conn, b.data, b.timeout)
+	err := gateway.QueryConfig(b.session, b.data, b.timeout)
 	if err != nil {
 		return fmt.Errorf("failed to query config: %w", err)
 	}
 
 	// Query status
-	err = gateway.QueryStatus(conn, b.data, b.timeout)
+	err = b.queryStatus()
 	if err != nil {
 		return fmt.Errorf("failed to query status: %w", err)
 	}
 
+	b.queryEquipment()
+
 	// Build device abstractions
 	b.updateDevices()
 	b.lastUpdate = time.Now()
+	b.recordSeries(b.lastUpdate)
 
 	return nil
 }
 
-// updateDevices rebuilds the device map from raw data.
+// updateDevices rebuilds the device map from raw data and publishes an
+// event for each device that changed.
 func (b *Bridge) updateDevices() {
-	// Update switches from circuits
+	before := b.snapshotDevices()
+	defer b.publishChanges(before)
+
+	// Update switches (and color lights) from circuits
 	for id, circuit := range b.data.Circuits {
-		key := jsonName(circuit.Name)
+		key := circuitKey(circuit.Name)
 		if sw, ok := b.switches[id]; ok {
+			wasOn := sw.IsOn()
 			sw.Update(circuit)
+			b.circuitChanged(id, wasOn, sw.IsOn())
+		} else if circuit.IsColorLight() {
+			light := NewLight(circuit)
+			b.lights[id] = light
+			b.switches[id] = &light.Switch
+			b.devices[key] = light
+			b.circuitChanged(id, false, light.IsOn())
 		} else {
 			sw := NewSwitch(circuit)
 			b.switches[id] = sw
 			b.devices[key] = sw
+			b.circuitChanged(id, false, sw.IsOn())
 		}
 	}
 
@@ -133,9 +269,32 @@ func (b *Bridge) updateDevices() {
 			)
 		}
 
+		// Heat set point and mode
+		setPointKey := fmt.Sprintf("%s_heat_set_point", strings.ToLower(bodyName))
+		if s, ok := b.devices[setPointKey].(*Sensor); ok {
+			s.UpdateValue(body.HeatSetPoint)
+		} else {
+			b.devices[setPointKey] = NewBodySensor(
+				setPointKey,
+				fmt.Sprintf("%s Heat Set Point", bodyName),
+				body.HeatSetPoint,
+				unit,
+			)
+		}
+
+		modeKey := fmt.Sprintf("%s_heat_mode", strings.ToLower(bodyName))
+		b.devices[modeKey] = &Sensor{
+			id:       modeKey,
+			name:     fmt.Sprintf("%s Heat Mode", bodyName),
+			state:    heatModeName(body.HeatMode),
+			hassType: "sensor",
+		}
+
 		// Heat status
 		heatKey := fmt.Sprintf("%s_heater_%d", strings.ToLower(bodyName), i)
-		if _, ok := b.devices[heatKey]; !ok {
+		if s, ok := b.devices[heatKey].(*Sensor); ok {
+			s.UpdateValue(body.HeatStatus)
+		} else {
 			b.devices[heatKey] = &Sensor{
 				id:       heatKey,
 				name:     fmt.Sprintf("%s Heater", bodyName),
@@ -150,9 +309,99 @@ func (b *Bridge) updateDevices() {
 	b.devices["orp"] = NewChemistrySensor("orp", "ORP", b.data.Chemistry.ORP, "")
 	b.devices["saturation"] = NewChemistrySensor("saturation", "Saturation Index", b.data.Chemistry.Saturation, "")
 	b.devices["salt_ppm"] = NewChemistrySensor("salt_ppm", "Salt", b.data.Chemistry.SaltPPM, "ppm")
+	b.devices["ph_tank_level"] = NewChemistrySensor("ph_tank_level", "pH Tank Level", b.data.Chemistry.PHTankLevel, "")
+	b.devices["orp_tank_level"] = NewChemistrySensor("orp_tank_level", "ORP Tank Level", b.data.Chemistry.ORPTankLevel, "")
+	b.devices["chemistry_alarm"] = NewBinarySensor("chemistry_alarm", "Chemistry Alarm", b.data.Chemistry.Alarms != 0)
+	b.devices["chemistry_alarms"] = NewChemistrySensor("chemistry_alarms", "Chemistry Alarms", joinNames(b.data.Chemistry.AlarmNames()), "")
+
+	// IntelliChem-only readings
+	if chem := b.data.Chemistry; chem.IntelliChem {
+		b.devices["ph_set_point"] = NewChemistrySensor("ph_set_point", "pH Set Point", chem.PHSetPoint, "")
+		b.devices["orp_set_point"] = NewChemistrySensor("orp_set_point", "ORP Set Point", chem.ORPSetPoint, "")
+		b.devices["calcium_hardness"] = NewChemistrySensor("calcium_hardness", "Calcium Hardness", chem.CalciumHardness, "ppm")
+		b.devices["cyanuric_acid"] = NewChemistrySensor("cyanuric_acid", "Cyanuric Acid", chem.CyanuricAcid, "ppm")
+		b.devices["total_alkalinity"] = NewChemistrySensor("total_alkalinity", "Total Alkalinity", chem.TotalAlkalinity, "ppm")
+		b.devices["chemistry_alerts"] = NewChemistrySensor("chemistry_alerts", "Chemistry Alerts", joinNames(chem.AlertNames()), "")
+	}
+
+	// Salt chlorinator
+	if scg := b.data.SCG; scg.Installed {
+		b.devices["chlorinator_pool_output"] = NewChemistrySensor("chlorinator_pool_output", "Chlorinator Pool Output", scg.PoolOutput, "%")
+		b.devices["chlorinator_spa_output"] = NewChemistrySensor("chlorinator_spa_output", "Chlorinator Spa Output", scg.SpaOutput, "%")
+		b.devices["super_chlorinate"] = NewBinarySensor("super_chlorinate", "Super Chlorinate", scg.SuperChlorinating())
+	}
+
+	// Variable-speed pumps
+	for i, pump := range b.data.Pumps {
+		key, name := pumpKey(i), pumpName(i)
+		b.devices[key] = NewBinarySensor(key, name, pump.Running)
+		b.devices[key+"_rpm"] = NewChemistrySensor(key+"_rpm", name+" Speed", pump.RPM, "RPM")
+		b.devices[key+"_gpm"] = NewChemistrySensor(key+"_gpm", name+" Flow", pump.GPM, "GPM")
+		b.devices[key+"_watts"] = NewChemistrySensor(key+"_watts", name+" Power", pump.Watts, "W")
+	}
+
+	// Freeze protection and pump delays, which explain circuits that don't
+	// respond right away
+	status := b.data.Status
+	b.devices["freeze_protection"] = NewBinarySensor("freeze_protection", "Freeze Protection", status.FreezeProtection())
+	b.devices["pool_delay"] = NewBinarySensor("pool_delay", "Pool Delay", status.PoolDelay != 0)
+	b.devices["spa_delay"] = NewBinarySensor("spa_delay", "Spa Delay", status.SpaDelay != 0)
+	b.devices["cleaner_delay"] = NewBinarySensor("cleaner_delay", "Cleaner Delay", status.CleanerDelay != 0)
+
+	// Current color of each color light
+	for id, light := range b.lights {
+		key := circuitKey(light.Name()) + "_color"
+		b.devices[key] = &Sensor{
+			id:       key,
+			name:     light.Name() + " Color",
+			state:    b.colorName(status.Circuits[id].ColorSet),
+			hassType: "sensor",
+		}
+	}
+}
+
+// joinNames lists decoded flags for a sensor state, or "None".
+func joinNames(names []string) string {
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, ", ")
+}
+
+// colorName returns the configured name of a light color index. Caller
+// must hold b.mu.
+func (b *Bridge) colorName(colorSet byte) string {
+	if int(colorSet) < len(b.data.Config.Colors) {
+		return b.data.Config.Colors[colorSet].Name
+	}
+	return fmt.Sprintf("Color %d", colorSet)
+}
+
+// circuitChanged keeps auto-off timers in line with circuit state, including
+// changes made at the panel or in the vendor app. Caller must hold b.mu.
+func (b *Bridge) circuitChanged(circuitID int, wasOn, isOn bool) {
+	switch {
+	case !isOn:
+		// Turned off by someone else: nothing left to turn off
+		b.timers.cancel(circuitID)
+	case !wasOn:
+		b.timers.scheduleDefault(circuitID)
+	}
+}
+
+// syncTimers drops timers for circuits that are off or no longer exist.
+// Caller must hold b.mu.
+func (b *Bridge) syncTimers() {
+	for _, id := range b.timers.circuits() {
+		if sw, ok := b.switches[id]; !ok || !sw.IsOn() {
+			b.timers.cancel(id)
+		}
+	}
 }
 
 // Update refreshes data from the gateway if the update interval has elapsed.
+// Pushed status changes reset the interval, so this only polls when the
+// gateway has been quiet.
 func (b *Bridge) Update() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -161,22 +410,7 @@ func (b *Bridge) Update() error {
 		return nil
 	}
 
-	conn := gateway.NewConnection(b.gatewayIP, b.gatewayPort)
-	err := conn.Connect(b.timeout)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	err = gateway.QueryStatus(conn, b.data, b.timeout)
-	if err != nil {
-		return err
-	}
-
-	b.updateDevices()
-	b.lastUpdate = time.Now()
-
-	return nil
+	return b.refreshStatus()
 }
 
 // GetJSON returns all devices as a JSON string.
@@ -187,19 +421,8 @@ func (b *Bridge) GetJSON() (string, error) {
 	out := make(map[string]interface{})
 
 	for key, dev := range b.devices {
-		switch d := dev.(type) {
-		case *Switch:
-			out[key] = map[string]interface{}{
-				"id":            d.IntID(),
-				"name":          d.Name(),
-				"friendlyState": strings.ToLower(d.FriendlyState()),
-				"state":         d.IntState(),
-			}
-		case *Sensor:
-			out[key] = map[string]interface{}{
-				"name":  d.Name(),
-				"state": d.FriendlyState(),
-			}
+		if v, ok := b.deviceJSON(dev); ok {
+			out[key] = v
 		}
 	}
 
@@ -233,35 +456,476 @@ func (b *Bridge) GetCircuitState(circuitID int) int {
 	return -1
 }
 
-// SetCircuit changes a circuit's state.
+// SetCircuit changes a circuit's state. Any pending auto-off is replaced:
+// turning a circuit off cancels it, and turning one on arms the circuit's
+// max runtime if it has one.
 func (b *Bridge) SetCircuit(circuitID, state int) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	conn := gateway.NewConnection(b.gatewayIP, b.gatewayPort)
-	err := conn.Connect(b.timeout)
+	_, err := b.setCircuit(circuitID, state, 0)
+	return err
+}
+
+// SetCircuitFor changes a circuit's state and, when turning it on, turns it
+// off again after duration (capped by the circuit's max runtime). It returns
+// when the circuit is due to turn off, or the zero time if it is not.
+func (b *Bridge) SetCircuitFor(circuitID, state int, duration time.Duration) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.setCircuit(circuitID, state, duration)
+}
+
+// ToggleCircuit turns a circuit on if it is off and off if it is on, and
+// returns the new state. Like SetCircuitFor, a duration turns it off again
+// after that long; it is an ErrInvalidValue if the toggle turns the circuit
+// off.
+func (b *Bridge) ToggleCircuit(circuitID int, duration time.Duration) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := 1
+	if sw, ok := b.switches[circuitID]; ok && sw.IntState() > 0 {
+		state = 0
+	}
+	if state == 0 && duration > 0 {
+		return 1, fmt.Errorf("circuit %d is on, a duration only applies when turning on: %w", circuitID, ErrInvalidValue)
+	}
+
+	_, err := b.setCircuit(circuitID, state, duration)
+	return state, err
+}
+
+// CircuitOffAt returns when a circuit's auto-off timer will fire.
+func (b *Bridge) CircuitOffAt(circuitID int) (time.Time, bool) {
+	return b.timers.offAt(circuitID)
+}
+
+// CancelCircuitTimer cancels a circuit's auto-off without changing its state.
+func (b *Bridge) CancelCircuitTimer(circuitID int) {
+	b.timers.cancel(circuitID)
+}
+
+// setCircuit sends the change, arms or cancels the auto-off timer and
+// refreshes status. Caller must hold b.mu.
+func (b *Bridge) setCircuit(circuitID, state int, duration time.Duration) (time.Time, error) {
+	err := gateway.SetCircuit(b.session, circuitID, state, b.timeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Arm the timer before refreshing so a failed refresh can't leave the
+	// circuit running with no way to turn it off
+	b.timers.cancel(circuitID)
+	if state > 0 {
+		if duration > 0 {
+			b.timers.schedule(circuitID, duration)
+		} else {
+			b.timers.scheduleDefault(circuitID)
+		}
+	}
+	offAt, _ := b.timers.offAt(circuitID)
+
+	// Refresh status after change
+	return offAt, b.refreshStatus()
+}
+
+// SetHeatSetPoint changes the heat set point for a body (0=Pool, 1=Spa).
+// The temperature must be within the controller's configured range.
+func (b *Bridge) SetHeatSetPoint(bodyIndex, temp int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.data.Bodies[bodyIndex]; !ok {
+		return fmt.Errorf("body %d: %w", bodyIndex, ErrNotFound)
+	}
+
+	minTemp, maxTemp := b.data.Config.MinSetPoint[bodyIndex], b.data.Config.MaxSetPoint[bodyIndex]
+	if temp < minTemp || temp > maxTemp {
+		return fmt.Errorf("set point %d outside %d-%d: %w", temp, minTemp, maxTemp, ErrInvalidValue)
+	}
+
+	err := gateway.SetHeatSetPoint(b.session, bodyIndex, temp, b.timeout)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	err = gateway.SetCircuit(conn, circuitID, state, b.timeout)
+	return b.refreshStatus()
+}
+
+// SetHeatMode changes the heat mode for a body (0=Pool, 1=Spa). The mode is
+// a gateway.HeatMode name such as "Heat" or "Solar Preferred".
+func (b *Bridge) SetHeatMode(bodyIndex int, mode string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.data.Bodies[bodyIndex]; !ok {
+		return fmt.Errorf("body %d: %w", bodyIndex, ErrNotFound)
+	}
+
+	modeIndex, ok := gateway.HeatModeByName(mode)
+	if !ok || modeIndex == gateway.HeatModeDontChange {
+		return fmt.Errorf("heat mode %q: %w", mode, ErrInvalidValue)
+	}
+
+	err := gateway.SetHeatMode(b.session, bodyIndex, modeIndex, b.timeout)
 	if err != nil {
 		return err
 	}
 
-	// Refresh status after change
-	err = gateway.QueryStatus(conn, b.data, b.timeout)
+	return b.refreshStatus()
+}
+
+// SetLightMode sends a light command (see LightModes) to the color lights.
+// The controller applies it to every color light at once.
+func (b *Bridge) SetLightMode(mode string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.lights) == 0 {
+		return fmt.Errorf("color lights: %w", ErrNotFound)
+	}
+
+	name, command, ok := lightMode(mode)
+	if !ok {
+		return fmt.Errorf("light mode %q: %w", mode, ErrInvalidValue)
+	}
+
+	err := gateway.SendLightCommand(b.session, command, b.timeout)
 	if err != nil {
 		return err
 	}
 
+	// On and off switch the lights without changing the show
+	if name != "On" && name != "Off" {
+		for _, light := range b.lights {
+			light.SetMode(name)
+		}
+	}
+
+	return b.refreshStatus()
+}
+
+// GetLights returns the color lights keyed by device name, along with the
+// modes they accept.
+func (b *Bridge) GetLights() map[string]interface{} {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	lights := make(map[string]interface{})
+	for key, dev := range b.devices {
+		if light, ok := dev.(*Light); ok {
+			lights[key], _ = b.deviceJSON(light)
+		}
+	}
+
+	return map[string]interface{}{
+		"lights": lights,
+		"modes":  LightModes(),
+	}
+}
+
+// Chlorinator is the salt chlorinator's settings and readings. Outputs are
+// percentages.
+type Chlorinator struct {
+	PoolOutput        int  `json:"poolOutput"`
+	SpaOutput         int  `json:"spaOutput"`
+	SaltPPM           int  `json:"saltPPM"`
+	SuperChlorinating bool `json:"superChlorinating"`
+	SuperChlorHours   int  `json:"superChlorHours"`
+	Status            int  `json:"status"`
+}
+
+// GetChlorinator returns the salt chlorinator settings, or false if none is
+// installed.
+func (b *Bridge) GetChlorinator() (Chlorinator, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	scg := b.data.SCG
+	if !scg.Installed {
+		return Chlorinator{}, false
+	}
+
+	return Chlorinator{
+		PoolOutput:        scg.PoolOutput,
+		SpaOutput:         scg.SpaOutput,
+		SaltPPM:           scg.SaltPPM,
+		SuperChlorinating: scg.SuperChlorinating(),
+		SuperChlorHours:   scg.SuperChlorHours,
+		Status:            scg.Status,
+	}, true
+}
+
+// SetChlorinatorOutput sets the chlorinator output (0-100%) for the pool
+// and spa, leaving super-chlorination as it is.
+func (b *Bridge) SetChlorinatorOutput(poolOutput, spaOutput int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	scg := b.data.SCG
+	if !scg.Installed {
+		return fmt.Errorf("chlorinator: %w", ErrNotFound)
+	}
+	for _, output := range []int{poolOutput, spaOutput} {
+		if output < 0 || output > 100 {
+			return fmt.Errorf("chlorinator output %d outside 0-100: %w", output, ErrInvalidValue)
+		}
+	}
+
+	err := gateway.SetSCG(b.session, poolOutput, spaOutput, scg.SuperChlorinating(), scg.SuperChlorHours, b.timeout)
+	if err != nil {
+		return err
+	}
+
+	return b.refreshStatus()
+}
+
+// SuperChlorinate runs the chlorinator at full output for hours (up to
+// gateway.MaxSuperChlorHours), or stops super-chlorination when hours is 0.
+func (b *Bridge) SuperChlorinate(hours int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	scg := b.data.SCG
+	if !scg.Installed {
+		return fmt.Errorf("chlorinator: %w", ErrNotFound)
+	}
+	if hours < 0 || hours > gateway.MaxSuperChlorHours {
+		return fmt.Errorf("super-chlorinate hours %d outside 0-%d: %w", hours, gateway.MaxSuperChlorHours, ErrInvalidValue)
+	}
+
+	err := gateway.SetSCG(b.session, scg.PoolOutput, scg.SpaOutput, hours > 0, hours, b.timeout)
+	if err != nil {
+		return err
+	}
+
+	return b.refreshStatus()
+}
+
+// Pump is a pump's live readings and the speed it runs at for each circuit.
+type Pump struct {
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	Running bool         `json:"running"`
+	RPM     int          `json:"rpm"`
+	GPM     int          `json:"gpm"`
+	Watts   int          `json:"watts"`
+	Presets []PumpPreset `json:"presets"`
+}
+
+// PumpPreset is the speed a pump runs at while a circuit is on. Circuit is
+// the circuit's device name, if it has one.
+type PumpPreset struct {
+	Circuit   string `json:"circuit,omitempty"`
+	CircuitID int    `json:"circuitId"`
+	Speed     int    `json:"speed"`
+	Unit      string `json:"unit"`
+}
+
+// GetPumps returns the installed pumps keyed by device name ("pump_1"),
+// with their live readings and per-circuit speed settings.
+func (b *Bridge) GetPumps() map[string]Pump {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	pumps := make(map[string]Pump)
+	for i, pump := range b.data.Pumps {
+		presets := []PumpPreset{}
+		for _, p := range pump.Presets {
+			if p.CircuitID == 0 {
+				continue
+			}
+			preset := PumpPreset{
+				CircuitID: p.CircuitID,
+				Speed:     p.SetPoint,
+				Unit:      speedUnit(p.IsRPM),
+			}
+			if circuit, ok := b.data.Circuits[p.CircuitID]; ok {
+				preset.Circuit = circuitKey(circuit.Name)
+			}
+			presets = append(presets, preset)
+		}
+
+		pumps[pumpKey(i)] = Pump{
+			Name:    pumpName(i),
+			Type:    pump.TypeName(),
+			Running: pump.Running,
+			RPM:     pump.RPM,
+			GPM:     pump.GPM,
+			Watts:   pump.Watts,
+			Presets: presets,
+		}
+	}
+
+	return pumps
+}
+
+// SetPumpSpeed changes the speed a pump (0-7) runs at while circuitID is
+// on. The speed is in RPM or GPM, whichever the setting already uses.
+func (b *Bridge) SetPumpSpeed(pumpIndex, circuitID, speed int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pump, ok := b.data.Pumps[pumpIndex]
+	if !ok {
+		return fmt.Errorf("pump %d: %w", pumpIndex+1, ErrNotFound)
+	}
+
+	preset := -1
+	for i, p := range pump.Presets {
+		if p.CircuitID == circuitID {
+			preset = i
+			break
+		}
+	}
+	if preset < 0 {
+		return fmt.Errorf("pump %d has no speed for circuit %d: %w", pumpIndex+1, circuitID, ErrNotFound)
+	}
+
+	isRPM := pump.Presets[preset].IsRPM
+	minSpeed, maxSpeed := gateway.PumpMinGPM, gateway.PumpMaxGPM
+	if isRPM {
+		minSpeed, maxSpeed = gateway.PumpMinRPM, gateway.PumpMaxRPM
+	}
+	if speed < minSpeed || speed > maxSpeed {
+		return fmt.Errorf("speed %d %s outside %d-%d: %w", speed, speedUnit(isRPM), minSpeed, maxSpeed, ErrInvalidValue)
+	}
+
+	err := gateway.SetPumpSpeed(b.session, pumpIndex, preset, speed, isRPM, b.timeout)
+	if err != nil {
+		return err
+	}
+
+	return b.refreshStatus()
+}
+
+// pumpKey returns the device name of a pump. Pumps are numbered from 1, as
+// on the controller.
+func pumpKey(index int) string {
+	return fmt.Sprintf("pump_%d", index+1)
+}
+
+// pumpName returns the display name of a pump.
+func pumpName(index int) string {
+	return fmt.Sprintf("Pump %d", index+1)
+}
+
+// speedUnit names the unit of a pump speed setting.
+func speedUnit(isRPM bool) string {
+	if isRPM {
+		return "RPM"
+	}
+	return "GPM"
+}
+
+// Body is the temperature and heat settings of the pool or spa. The set
+// point may be changed within MinSetPoint and MaxSetPoint.
+type Body struct {
+	Name               string `json:"name"`
+	CurrentTemperature int    `json:"currentTemperature"`
+	HeatSetPoint       int    `json:"heatSetPoint"`
+	MinSetPoint        int    `json:"minSetPoint"`
+	MaxSetPoint        int    `json:"maxSetPoint"`
+	HeatMode           string `json:"heatMode"`
+	HeatStatus         int    `json:"heatStatus"`
+	Unit               string `json:"unit"`
+}
+
+// GetBody returns the temperature and heat settings for a body (0=Pool, 1=Spa).
+func (b *Bridge) GetBody(bodyIndex int) (Body, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	body, ok := b.data.Bodies[bodyIndex]
+	if !ok {
+		return Body{}, false
+	}
+
+	return Body{
+		Name:               gateway.BodyType[body.BodyType],
+		CurrentTemperature: body.CurrentTemperature,
+		HeatSetPoint:       body.HeatSetPoint,
+		MinSetPoint:        b.data.Config.MinSetPoint[bodyIndex],
+		MaxSetPoint:        b.data.Config.MaxSetPoint[bodyIndex],
+		HeatMode:           heatModeName(body.HeatMode),
+		HeatStatus:         body.HeatStatus,
+		Unit:               b.unit(),
+	}, true
+}
+
+// refreshStatus re-queries status after a change. Caller must hold b.mu.
+func (b *Bridge) refreshStatus() error {
+	err := b.queryStatus()
+	if err != nil {
+		return err
+	}
+
+	b.queryEquipment()
+
 	b.updateDevices()
 	b.lastUpdate = time.Now()
+	b.recordSeries(b.lastUpdate)
 
 	return nil
 }
 
+// queryStatus updates b.data from a status query and notes when the answer
+// was read, so handlePush can tell older pushes from newer ones. Caller must
+// hold b.mu.
+func (b *Bridge) queryStatus() error {
+	answer := &timedSender{session: b.session}
+	err := gateway.QueryStatus(answer, b.data, b.timeout)
+	if err != nil {
+		return err
+	}
+	b.statusAt = answer.received
+	return nil
+}
+
+// timedSender is a gateway.Sender that remembers when the last answer was
+// read.
+type timedSender struct {
+	session  *gateway.Session
+	received time.Time
+}
+
+// Send implements gateway.Sender.
+func (t *timedSender) Send(msgCode uint16, data []byte, timeout time.Duration) ([]byte, error) {
+	msg, received, err := t.session.SendTimed(msgCode, data, timeout)
+	t.received = received
+	return msg, err
+}
+
+// queryEquipment fetches readings from optional equipment that the status
+// answer doesn't cover. A failed query keeps that equipment's last readings
+// rather than failing the refresh, so a faulty IntelliChem or pump can't
+// block startup or make a control call that was applied look failed.
+// Caller must hold b.mu.
+func (b *Bridge) queryEquipment() {
+	if b.data.Config.HasIntelliChem() {
+		err := gateway.QueryChemistry(b.session, b.data, b.timeout)
+		if err != nil {
+			log.Printf("Keeping last chemistry readings: %v", err)
+		}
+	}
+
+	if b.data.Config.HasChlorinator() {
+		err := gateway.QuerySCG(b.session, b.data, b.timeout)
+		if err != nil {
+			log.Printf("Keeping last chlorinator readings: %v", err)
+		}
+	}
+
+	for _, i := range b.data.Config.PumpIndexes() {
+		err := gateway.QueryPump(b.session, b.data, i, b.timeout)
+		if err != nil {
+			log.Printf("Keeping last readings for pump %d: %v", i, err)
+		}
+	}
+}
+
 // GetBodyTemperature returns the current temperature for a body (0=Pool, 1=Spa).
 func (b *Bridge) GetBodyTemperature(bodyIndex int) (int, error) {
 	b.mu.RLock()
@@ -292,6 +956,61 @@ func (b *Bridge) GetDevice(key string) (Device, bool) {
 	return dev, ok
 }
 
+// DeviceState is a snapshot of one device, safe to use after the Bridge
+// has moved on.
+type DeviceState struct {
+	Key           string
+	Name          string
+	HassType      string
+	Unit          string // "" for switches, lights and unitless sensors
+	State         interface{}
+	FriendlyState string
+}
+
+// Devices returns a snapshot of every device, sorted by key.
+func (b *Bridge) Devices() []DeviceState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	out := make([]DeviceState, 0, len(b.devices))
+	for key, dev := range b.devices {
+		d := DeviceState{
+			Key:           key,
+			Name:          dev.Name(),
+			HassType:      dev.HassType(),
+			State:         dev.State(),
+			FriendlyState: dev.FriendlyState(),
+		}
+		if s, ok := dev.(*Sensor); ok {
+			d.Unit = s.Unit()
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// CircuitForDevice returns the circuit ID behind a switch or light device
+// key. It fails with ErrNotFound for unknown keys and ErrReadOnly for
+// sensors.
+func (b *Bridge) CircuitForDevice(key string) (int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	dev, ok := b.devices[key]
+	if !ok {
+		return 0, fmt.Errorf("device %q: %w", key, ErrNotFound)
+	}
+
+	switch d := dev.(type) {
+	case *Switch:
+		return d.IntID(), nil
+	case *Light:
+		return d.IntID(), nil
+	}
+	return 0, fmt.Errorf("device %q: %w", key, ErrReadOnly)
+}
+
 // GetAttribute returns a specific attribute from the pool data.
 func (b *Bridge) GetAttribute(attr string) (interface{}, bool) {
 	b.mu.RLock()
@@ -302,6 +1021,29 @@ func (b *Bridge) GetAttribute(attr string) (interface{}, bool) {
 		return nil, false
 	}
 
+	return b.deviceJSON(dev)
+}
+
+// deviceJSON returns the JSON representation of a device, including the
+// auto-off time of circuits with a pending timer.
+func (b *Bridge) deviceJSON(dev Device) (map[string]interface{}, bool) {
+	out, ok := deviceJSON(dev)
+	if !ok {
+		return nil, false
+	}
+
+	if circuit, isCircuit := dev.(interface{ IntID() int }); isCircuit {
+		if offAt, pending := b.timers.offAt(circuit.IntID()); pending {
+			out["offAt"] = offAt.Format(time.RFC3339)
+			out["remainingSeconds"] = int(time.Until(offAt).Round(time.Second).Seconds())
+		}
+	}
+
+	return out, true
+}
+
+// deviceJSON returns the JSON representation of a device.
+func deviceJSON(dev Device) (map[string]interface{}, bool) {
 	switch d := dev.(type) {
 	case *Switch:
 		return map[string]interface{}{
@@ -310,6 +1052,15 @@ func (b *Bridge) GetAttribute(attr string) (interface{}, bool) {
 			"friendlyState": strings.ToLower(d.FriendlyState()),
 			"state":         d.IntState(),
 		}, true
+	case *Light:
+		return map[string]interface{}{
+			"id":            d.IntID(),
+			"name":          d.Name(),
+			"friendlyState": strings.ToLower(d.FriendlyState()),
+			"state":         d.IntState(),
+			"mode":          d.Mode(),
+			"modes":         d.Modes(),
+		}, true
 	case *Sensor:
 		return map[string]interface{}{
 			"name":  d.Name(),
@@ -322,12 +1073,46 @@ func (b *Bridge) GetAttribute(attr string) (interface{}, bool) {
 
 // TemperatureUnit returns the temperature unit (°F or °C).
 func (b *Bridge) TemperatureUnit() string {
+	return b.unit()
+}
+
+// unit returns the temperature unit without locking.
+func (b *Bridge) unit() string {
 	if b.data.Config.IsCelsius {
 		return "°C"
 	}
 	return "°F"
 }
 
+// heatModeName returns the gateway.HeatMode name for a mode index.
+func heatModeName(mode int) string {
+	if mode >= 0 && mode < len(gateway.HeatMode) {
+		return gateway.HeatMode[mode]
+	}
+	return "Unknown"
+}
+
+// reservedKeys are the resources the API serves at /pool/{name}. A device
+// with one of these keys could not be read or switched at /pool/{attr}.
+var reservedKeys = map[string]bool{
+	"chlorinator": true,
+	"events":      true,
+	"history":     true,
+	"lights":      true,
+	"pumps":       true,
+	"schedules":   true,
+}
+
+// circuitKey returns the device key for a circuit. A circuit named like a
+// reserved resource (say "Lights") gets a "_circuit" suffix.
+func circuitKey(name string) string {
+	key := jsonName(name)
+	if reservedKeys[key] {
+		key += "_circuit"
+	}
+	return key
+}
+
 // jsonName converts a name to JSON-friendly format (lowercase, underscores).
 func jsonName(name string) string {
 	return strings.ToLower(strings.ReplaceAll(name, " ", "_"))
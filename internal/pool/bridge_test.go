@@ -0,0 +1,281 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// newTestBridge returns a Bridge over canned data with no gateway session.
+// Only use it for paths that fail validation before talking to the gateway.
+func newTestBridge() *Bridge {
+	data := gateway.NewPoolData()
+	data.Config.MinSetPoint = [2]int{40, 40}
+	data.Config.MaxSetPoint = [2]int{104, 104}
+	data.Circuits[gateway.CircuitSpa] = &gateway.Circuit{ID: gateway.CircuitSpa, Name: "Spa", State: 1}
+	data.Circuits[gateway.CircuitPoolLight] = &gateway.Circuit{
+		ID: gateway.CircuitPoolLight, Name: "Pool Light", Function: gateway.FunctionIntelliBrite,
+	}
+	data.Bodies[0] = &gateway.Body{BodyType: 0, CurrentTemperature: 78, HeatSetPoint: 82, HeatMode: 3}
+	data.Bodies[1] = &gateway.Body{BodyType: 1, CurrentTemperature: 101, HeatSetPoint: 102, HeatMode: 3}
+
+	b := &Bridge{
+		data:     data,
+		devices:  make(map[string]Device),
+		switches: make(map[int]*Switch),
+		lights:   make(map[int]*Light),
+		timers:   newCircuitTimers("", nil),
+		events:   newEventBus(),
+	}
+	b.updateDevices()
+	return b
+}
+
+func TestSetHeatSetPointValidation(t *testing.T) {
+	b := newTestBridge()
+
+	tests := []struct {
+		name    string
+		body    int
+		temp    int
+		wantErr error
+	}{
+		{name: "too hot", body: 1, temp: 110, wantErr: ErrInvalidValue},
+		{name: "too cold", body: 0, temp: 20, wantErr: ErrInvalidValue},
+		{name: "unknown body", body: 2, temp: 80, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := b.SetHeatSetPoint(tt.body, tt.temp)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetHeatSetPoint() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetHeatModeValidation(t *testing.T) {
+	b := newTestBridge()
+
+	for _, mode := range []string{"boil", "Don't Change", ""} {
+		if err := b.SetHeatMode(1, mode); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("SetHeatMode(%q) error = %v, want ErrInvalidValue", mode, err)
+		}
+	}
+}
+
+func TestGetBody(t *testing.T) {
+	b := newTestBridge()
+
+	body, ok := b.GetBody(1)
+	if !ok {
+		t.Fatal("GetBody(1) not found")
+	}
+	if body.Name != "Spa" || body.HeatSetPoint != 102 || body.HeatMode != "Heat" {
+		t.Errorf("GetBody(1) = %+v", body)
+	}
+
+	dev, ok := b.GetDevice("spa_heat_set_point")
+	if !ok || dev.FriendlyState() != "102 °F" {
+		t.Errorf("spa_heat_set_point device = %v", dev)
+	}
+}
+
+func TestUpdateDevicesBuildsLights(t *testing.T) {
+	b := newTestBridge()
+
+	dev, ok := b.GetDevice("pool_light")
+	if !ok {
+		t.Fatal("pool_light device missing")
+	}
+	if _, ok := dev.(*Light); !ok {
+		t.Errorf("pool_light is %T, want *Light", dev)
+	}
+	if _, ok := b.GetDevice("spa"); !ok {
+		t.Error("spa device missing")
+	}
+
+	// Lights still answer circuit state lookups
+	if got := b.GetCircuitState(gateway.CircuitPoolLight); got != 0 {
+		t.Errorf("GetCircuitState(pool light) = %d, want 0", got)
+	}
+
+	lights := b.GetLights()["lights"].(map[string]interface{})
+	if _, ok := lights["pool_light"]; !ok || len(lights) != 1 {
+		t.Errorf("GetLights() = %v, want only pool_light", lights)
+	}
+}
+
+func TestSetLightModeValidation(t *testing.T) {
+	b := newTestBridge()
+
+	if err := b.SetLightMode("disco"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetLightMode(disco) error = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestCircuitForDevice(t *testing.T) {
+	b := newTestBridge()
+
+	if id, err := b.CircuitForDevice("spa"); err != nil || id != gateway.CircuitSpa {
+		t.Errorf("CircuitForDevice(spa) = %d, %v", id, err)
+	}
+	if id, err := b.CircuitForDevice("pool_light"); err != nil || id != gateway.CircuitPoolLight {
+		t.Errorf("CircuitForDevice(pool_light) = %d, %v", id, err)
+	}
+	if _, err := b.CircuitForDevice("spa_heat_set_point"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CircuitForDevice(sensor) error = %v, want ErrReadOnly", err)
+	}
+	if _, err := b.CircuitForDevice("moat"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CircuitForDevice(moat) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateDevicesRenamesReservedKeys(t *testing.T) {
+	b := newTestBridge()
+	b.data.Circuits[gateway.CircuitSpaLight] = &gateway.Circuit{
+		ID: gateway.CircuitSpaLight, Name: "Lights", Function: gateway.FunctionIntelliBrite,
+	}
+	b.updateDevices()
+
+	if _, ok := b.devices["lights"]; ok {
+		t.Error("circuit took the reserved key lights")
+	}
+	if id, err := b.CircuitForDevice("lights_circuit"); err != nil || id != gateway.CircuitSpaLight {
+		t.Errorf("CircuitForDevice(lights_circuit) = %d, %v", id, err)
+	}
+	if _, ok := b.devices["lights_circuit_color"]; !ok {
+		t.Error("missing lights_circuit_color sensor")
+	}
+}
+
+func TestUpdateDevicesStatusSensors(t *testing.T) {
+	b := newTestBridge()
+	b.data.Config.Colors = []gateway.Color{{Name: "White"}, {Name: "Light Green"}}
+	b.data.Status.FreezeMode = gateway.FreezeModeActive
+	b.data.Status.SpaDelay = 1
+	b.data.Status.Circuits[gateway.CircuitPoolLight] = gateway.CircuitStatus{ColorSet: 1}
+	b.data.Bodies[1].HeatStatus = 1
+	b.updateDevices()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "freeze_protection", want: "On"},
+		{key: "pool_delay", want: "Off"},
+		{key: "spa_delay", want: "On"},
+		{key: "cleaner_delay", want: "Off"},
+		{key: "pool_light_color", want: "Light Green"},
+		{key: "spa_heater_1", want: "On"},
+	}
+	for _, tt := range tests {
+		dev, ok := b.GetDevice(tt.key)
+		if !ok {
+			t.Errorf("%s device missing", tt.key)
+			continue
+		}
+		if got := dev.FriendlyState(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	// Unknown color indexes fall back to the number
+	b.data.Status.Circuits[gateway.CircuitPoolLight] = gateway.CircuitStatus{ColorSet: 7}
+	b.updateDevices()
+	if dev, _ := b.GetDevice("pool_light_color"); dev.FriendlyState() != "Color 7" {
+		t.Errorf("pool_light_color = %q, want Color 7", dev.FriendlyState())
+	}
+}
+
+func TestUpdateDevicesChemistry(t *testing.T) {
+	b := newTestBridge()
+
+	if _, ok := b.GetDevice("calcium_hardness"); ok {
+		t.Error("calcium_hardness should only exist with an IntelliChem")
+	}
+	if dev, _ := b.GetDevice("chemistry_alarm"); dev.FriendlyState() != "Off" {
+		t.Errorf("chemistry_alarm = %q, want Off", dev.FriendlyState())
+	}
+
+	b.data.Chemistry.Alarms = gateway.ChemAlarmFlow | gateway.ChemAlarmORPHigh
+	b.data.Chemistry.ORPTankLevel = 2
+	b.updateDevices()
+
+	tests := map[string]string{
+		"chemistry_alarm":  "On",
+		"chemistry_alarms": "Low Flow, ORP High",
+		"orp_tank_level":   "2",
+	}
+	for key, want := range tests {
+		dev, ok := b.GetDevice(key)
+		if !ok {
+			t.Errorf("%s device missing", key)
+			continue
+		}
+		if got := dev.FriendlyState(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestToggleCircuitValidation(t *testing.T) {
+	b := newTestBridge()
+
+	// The spa is on, so the toggle would turn it off
+	if _, err := b.ToggleCircuit(gateway.CircuitSpa, 30*time.Minute); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("ToggleCircuit(spa on, 30m) error = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestChlorinatorValidation(t *testing.T) {
+	b := newTestBridge()
+
+	if _, ok := b.GetChlorinator(); ok {
+		t.Error("GetChlorinator() should report no chlorinator")
+	}
+	if err := b.SuperChlorinate(24); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SuperChlorinate() without a chlorinator error = %v, want ErrNotFound", err)
+	}
+
+	b.data.SCG = gateway.SCGData{Installed: true, PoolOutput: 50}
+	if err := b.SetChlorinatorOutput(50, -1); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetChlorinatorOutput(50, -1) error = %v, want ErrInvalidValue", err)
+	}
+	if err := b.SuperChlorinate(gateway.MaxSuperChlorHours + 1); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SuperChlorinate(73) error = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestSetPumpSpeedValidation(t *testing.T) {
+	b := newTestBridge()
+	b.data.Pumps[0] = &gateway.PumpData{Presets: []gateway.PumpPreset{
+		{CircuitID: gateway.CircuitPool, SetPoint: 2500, IsRPM: true},
+		{CircuitID: gateway.CircuitSpa, SetPoint: 50},
+	}}
+
+	tests := []struct {
+		name    string
+		pump    int
+		circuit int
+		speed   int
+		wantErr error
+	}{
+		{name: "unknown pump", pump: 1, circuit: gateway.CircuitPool, speed: 2000, wantErr: ErrNotFound},
+		{name: "circuit without a speed", pump: 0, circuit: gateway.CircuitCleaner, speed: 2000, wantErr: ErrNotFound},
+		{name: "rpm too fast", pump: 0, circuit: gateway.CircuitPool, speed: 4000, wantErr: ErrInvalidValue},
+		{name: "gpm given as rpm", pump: 0, circuit: gateway.CircuitSpa, speed: 2000, wantErr: ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := b.SetPumpSpeed(tt.pump, tt.circuit, tt.speed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetPumpSpeed() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package pool
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// defaultClockMaxDrift is how far the controller clock may drift from the
+// host before CLOCK_SYNC_INTERVAL corrects it.
+const defaultClockMaxDrift = time.Minute
+
+// clockSync keeps the controller clock on host time. The controller drifts
+// and can only apply US DST rules, so the host drives DST instead: every
+// interval it compares the controller clock to its own and sets it when the
+// drift is over maxDrift or the host's UTC offset has changed since the
+// last check (a DST transition). The controller's own DST adjustment is
+// always turned off, or it would jump on the US dates in other zones and
+// stay wrong until the next check.
+type clockSync struct {
+	interval   time.Duration
+	maxDrift   time.Duration
+	query      func() (gateway.SystemTime, error)
+	set        func(t time.Time, adjustForDST bool) error
+	now        func() time.Time
+	logger     *log.Logger
+	lastOffset int
+	haveOffset bool
+	stopCh     chan struct{}
+	done       chan struct{}
+}
+
+// newClockSync creates a clock sync that reads and sets the controller
+// clock with query and set.
+func newClockSync(interval, maxDrift time.Duration, query func() (gateway.SystemTime, error), set func(time.Time, bool) error) *clockSync {
+	return &clockSync{
+		interval: interval,
+		maxDrift: maxDrift,
+		query:    query,
+		set:      set,
+		now:      time.Now,
+		logger:   log.New(os.Stdout, "[clock] ", log.LstdFlags),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start checks the clock now and then every interval until stop.
+func (c *clockSync) start() {
+	c.logger.Printf("Syncing controller clock every %s (max drift %s)", c.interval, c.maxDrift)
+	go c.run()
+}
+
+// run is the sync loop.
+func (c *clockSync) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.check(); err != nil {
+			c.logger.Printf("Clock sync failed: %v", err)
+		}
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop ends the sync loop and waits for a check in progress.
+func (c *clockSync) stop() {
+	close(c.stopCh)
+	<-c.done
+}
+
+// check compares the controller clock to the host and corrects it if
+// needed.
+func (c *clockSync) check() error {
+	st, err := c.query()
+	if err != nil {
+		return fmt.Errorf("failed to read controller clock: %w", err)
+	}
+
+	now := c.now()
+	_, offset := now.Zone()
+
+	// The controller has no zone; read its wall time in the host's zone
+	t := st.Time
+	controller := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), now.Location())
+	drift := controller.Sub(now)
+
+	var reason string
+	switch {
+	case c.haveOffset && offset != c.lastOffset:
+		reason = fmt.Sprintf("host UTC offset changed from %s to %s", formatOffset(c.lastOffset), formatOffset(offset))
+	case st.AdjustForDST:
+		reason = "controller adjusts for DST itself"
+	case drift.Abs() > c.maxDrift:
+		reason = fmt.Sprintf("drifted %s", drift.Round(time.Second))
+	}
+	c.lastOffset, c.haveOffset = offset, true
+	if reason == "" {
+		return nil
+	}
+
+	if err := c.set(now, false); err != nil {
+		return fmt.Errorf("failed to set controller clock (%s): %w", reason, err)
+	}
+	c.logger.Printf("Set controller clock from %s to %s: %s",
+		controller.Format(time.DateTime), now.Format(time.DateTime), reason)
+	return nil
+}
+
+// formatOffset formats a UTC offset in seconds as "-07:00".
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// parseClockSync reads CLOCK_SYNC_INTERVAL and CLOCK_SYNC_MAX_DRIFT. An
+// empty interval disables clock sync.
+func parseClockSync(intervalStr, maxDriftStr string) (interval, maxDrift time.Duration, err error) {
+	if intervalStr == "" {
+		return 0, 0, nil
+	}
+	interval, err = time.ParseDuration(intervalStr)
+	if err != nil || interval <= 0 {
+		return 0, 0, fmt.Errorf("invalid CLOCK_SYNC_INTERVAL %q", intervalStr)
+	}
+
+	maxDrift = defaultClockMaxDrift
+	if maxDriftStr != "" {
+		maxDrift, err = time.ParseDuration(maxDriftStr)
+		if err != nil || maxDrift <= 0 {
+			return 0, 0, fmt.Errorf("invalid CLOCK_SYNC_MAX_DRIFT %q", maxDriftStr)
+		}
+	}
+	return interval, maxDrift, nil
+}
+
+// ControllerTime returns the controller's clock, read as local time.
+func (b *Bridge) ControllerTime() (time.Time, error) {
+	st, err := b.querySystemTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return st.Time, nil
+}
+
+// querySystemTime reads the controller clock.
+func (b *Bridge) querySystemTime() (gateway.SystemTime, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return gateway.QuerySystemTime(b.session, b.timeout)
+}
+
+// setSystemTime sets the controller clock for clockSync.
+func (b *Bridge) setSystemTime(t time.Time, adjustForDST bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return gateway.SetSystemTime(b.session, t, adjustForDST, b.timeout)
+}
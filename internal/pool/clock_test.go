@@ -0,0 +1,141 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Berlin without relying on the host's zoneinfo
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+)
+
+// fakeClock is a controller clock for clockSync tests.
+type fakeClock struct {
+	st   gateway.SystemTime
+	sets int
+	err  error
+}
+
+func (f *fakeClock) query() (gateway.SystemTime, error) { return f.st, f.err }
+
+func (f *fakeClock) set(t time.Time, adjustForDST bool) error {
+	f.sets++
+	f.st = gateway.SystemTime{Time: t, AdjustForDST: adjustForDST}
+	return nil
+}
+
+func TestClockSyncCheck(t *testing.T) {
+	pst := time.FixedZone("PST", -8*3600)
+	pdt := time.FixedZone("PDT", -7*3600)
+	now := time.Date(2024, time.November, 3, 1, 30, 0, 0, pdt)
+
+	clock := &fakeClock{st: gateway.SystemTime{Time: now.Add(-30 * time.Second)}}
+	c := newClockSync(time.Hour, time.Minute, clock.query, clock.set)
+	c.now = func() time.Time { return now }
+
+	// Within the allowed drift
+	if err := c.check(); err != nil || clock.sets != 0 {
+		t.Fatalf("check() = %v with %d sets, want no correction", err, clock.sets)
+	}
+
+	// Drifted too far
+	clock.st.Time = now.Add(-5 * time.Minute)
+	if err := c.check(); err != nil || clock.sets != 1 || !clock.st.Time.Equal(now) {
+		t.Fatalf("check() = %v with %d sets, clock %s", err, clock.sets, clock.st.Time)
+	}
+
+	// The host falls back an hour; the controller's wall time is now an
+	// hour ahead and must follow even though it was right a moment ago
+	now = time.Date(2024, time.November, 3, 1, 30, 0, 0, pst)
+	if err := c.check(); err != nil || clock.sets != 2 || clock.st.Time.Location() != pst {
+		t.Fatalf("check() after DST change = %v with %d sets", err, clock.sets)
+	}
+
+	// The controller must not adjust for DST itself
+	clock.st.AdjustForDST = true
+	if err := c.check(); err != nil || clock.sets != 3 || clock.st.AdjustForDST {
+		t.Fatalf("check() with DST adjust = %v with %d sets, adjust %t", err, clock.sets, clock.st.AdjustForDST)
+	}
+
+	clock.err = errors.New("gateway down")
+	if err := c.check(); err == nil {
+		t.Error("check() should fail when the clock can't be read")
+	}
+}
+
+func TestClockSyncOutsideUS(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	// The US has switched to summer time, Europe hasn't yet
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, berlin)
+	clock := &fakeClock{st: gateway.SystemTime{Time: now, AdjustForDST: true}}
+	c := newClockSync(time.Hour, time.Minute, clock.query, clock.set)
+	c.now = func() time.Time { return now }
+
+	// Berlin observes DST, but on other dates than the controller would
+	if err := c.check(); err != nil || clock.sets != 1 || clock.st.AdjustForDST {
+		t.Fatalf("check() = %v with %d sets, adjust %t, want DST adjustment off", err, clock.sets, clock.st.AdjustForDST)
+	}
+	if err := c.check(); err != nil || clock.sets != 1 {
+		t.Fatalf("check() = %v with %d sets, want no further correction", err, clock.sets)
+	}
+
+	// Europe springs forward; the host's offset change moves the controller
+	now = time.Date(2024, time.March, 31, 3, 30, 0, 0, berlin)
+	clock.st.Time = now.Add(-time.Hour)
+	if err := c.check(); err != nil || clock.sets != 2 || clock.st.AdjustForDST || !clock.st.Time.Equal(now) {
+		t.Fatalf("check() after EU DST change = %v with %d sets, clock %s adjust %t", err, clock.sets, clock.st.Time, clock.st.AdjustForDST)
+	}
+}
+
+func TestParseClockSync(t *testing.T) {
+	tests := []struct {
+		interval, maxDrift string
+		wantInterval       time.Duration
+		wantMaxDrift       time.Duration
+		wantErr            bool
+	}{
+		{"", "5m", 0, 0, false},
+		{"1h", "", time.Hour, defaultClockMaxDrift, false},
+		{"30m", "2m", 30 * time.Minute, 2 * time.Minute, false},
+		{"hourly", "", 0, 0, true},
+		{"-1h", "", 0, 0, true},
+		{"1h", "0s", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		interval, maxDrift, err := parseClockSync(tt.interval, tt.maxDrift)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClockSync(%q, %q) error = %v, wantErr %v", tt.interval, tt.maxDrift, err, tt.wantErr)
+			continue
+		}
+		if interval != tt.wantInterval || maxDrift != tt.wantMaxDrift {
+			t.Errorf("parseClockSync(%q, %q) = %s, %s", tt.interval, tt.maxDrift, interval, maxDrift)
+		}
+	}
+}
+
+func TestBridgeClockSyncWithSimulator(t *testing.T) {
+	sc := gatewaysim.DefaultScenario()
+	sc.ClockOffset = -10 * 60
+	t.Setenv("CLOCK_SYNC_INTERVAL", "1h")
+	b, sim := newSimBridgeWith(t, sc)
+
+	// The first check runs as soon as the bridge starts
+	waitFor(t, "clock correction", func() bool {
+		offset := sim.Scenario().ClockOffset
+		return offset > -2 && offset < 2
+	})
+
+	got, err := b.ControllerTime()
+	if err != nil {
+		t.Fatalf("ControllerTime() error = %v", err)
+	}
+	if drift := time.Since(got); drift.Abs() > 2*time.Second {
+		t.Errorf("ControllerTime() is %s off after sync", drift)
+	}
+}
@@ -8,19 +8,84 @@
 // # Bridge
 //
 // The Bridge is the main entry point. It handles:
-//   - Gateway discovery and connection
-//   - Data caching with configurable update intervals
+//   - Gateway discovery and a persistent, auto-reconnecting session
+//   - Live status via gateway push messages
+//   - Data caching with configurable update intervals as a polling fallback
 //   - Thread-safe access via sync.RWMutex
 //   - Device state management
 //
 // # Devices
 //
-// Two device types are supported:
+// Three device types are supported:
 //
 //   - Switch: Circuits that can be turned on/off (spa, jets, lights)
+//   - Light: Color light circuits that also accept light show commands
 //   - Sensor: Read-only values (temperature, chemistry)
 //
-// Both implement the Device interface for uniform access.
+// All implement the Device interface for uniform access. Devices returns a
+// snapshot of every device for integrations such as Home Assistant.
+//
+// Besides temperatures and chemistry, sensors report controller status:
+// freeze_protection, pool_delay, spa_delay and cleaner_delay explain why a
+// pump or heater isn't doing what was asked, and each color light has a
+// {light}_color sensor with its current color.
+//
+// Chemistry sensors include tank levels and chemistry_alarm, with the
+// decoded alarm names ("Low Flow, pH High") in chemistry_alarms. Systems
+// with an IntelliChem also get set points, calcium hardness, cyanuric acid,
+// total alkalinity and chemistry_alerts.
+//
+// With a salt chlorinator, GetChlorinator, SetChlorinatorOutput and
+// SuperChlorinate read and change its output, and its settings appear as
+// the chlorinator_pool_output, chlorinator_spa_output and super_chlorinate
+// sensors.
+//
+// Each variable-speed pump is a pump_N binary sensor (running) with
+// pump_N_rpm, pump_N_gpm and pump_N_watts readings. GetPumps lists the
+// speed each circuit runs the pump at and SetPumpSpeed changes one.
+//
+// GetHistory returns the controller's log over a time range: air, pool and
+// spa temperatures with their set points, and when the pool, spa, solar,
+// heater and lights ran.
+//
+// The controller's own schedules are managed with GetSchedules,
+// AddSchedule, UpdateSchedule and DeleteSchedule. A Schedule names its
+// circuit by device key, its days as Weekdays and its times as TimeOfDay;
+// the heat mode defaults to "Don't Change" so a schedule only turns the
+// circuit on unless asked to do more.
+//
+// # Auto-off Timers
+//
+// SetCircuitFor turns a circuit on and schedules it off after a duration.
+// Circuits can also have a maximum runtime (CIRCUIT_MAX_RUNTIMES) that is
+// enforced however they were turned on. Pending timers are saved to disk
+// (TIMERS_FILE) so a restart doesn't leave the spa running all night, and a
+// timer is cancelled if the circuit is turned off some other way.
+//
+// # Controller Clock
+//
+// ControllerTime reads the controller's clock. The controller drifts and
+// only knows US DST rules, which shifts its schedules, so setting
+// CLOCK_SYNC_INTERVAL has the Bridge compare it to host time on that
+// interval and set it when it is off by more than CLOCK_SYNC_MAX_DRIFT or
+// the host's UTC offset changed. The host's zone drives DST: the
+// controller's own DST adjustment is turned off. Every correction is logged.
+//
+// # Series
+//
+// Setting SERIES_DIR has the Bridge record the numeric state of every
+// device (temperatures, circuits as 0/1, chemistry) each time it refreshes
+// the status. GetSeries reads them back raw or downsampled to hourly and
+// daily points; see package series for the storage and SERIES_RETENTION.
+//
+// # Events
+//
+// Every status refresh or push is compared with the previous device states,
+// and each device that changed is published as an Event with a sequence ID.
+// Subscribe returns a Subscription delivering them; the last 256 events are
+// kept so a subscriber that reconnects with the ID it last saw gets what it
+// missed. Subscribers that fall behind are dropped rather than slowing the
+// Bridge down.
 //
 // # Usage
 //
@@ -36,6 +101,7 @@
 //	// Control spa
 //	bridge.SetCircuit(500, 1)  // Turn on
 //	bridge.SetCircuit(500, 0)  // Turn off
+//	bridge.SetCircuitFor(502, 1, 30*time.Minute)  // Swim jets for 30 minutes
 //
 //	// Query temperature
 //	temp, _ := bridge.GetSpaTemperature()
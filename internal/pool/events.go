@@ -0,0 +1,179 @@
+package pool
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event buffer sizes.
+const (
+	eventHistory     = 256 // recent events kept for resuming subscribers
+	subscriberBuffer = 64  // events a subscriber may fall behind by
+)
+
+// Event is a change in one device's state.
+type Event struct {
+	ID            uint64      `json:"id"`
+	Time          time.Time   `json:"time"`
+	Device        string      `json:"device"`
+	Name          string      `json:"name"`
+	State         interface{} `json:"state"`
+	FriendlyState string      `json:"friendlyState"`
+	PreviousState interface{} `json:"previousState,omitempty"`
+}
+
+// Subscription delivers events to one subscriber. Events is closed when
+// the subscription is closed or the subscriber falls more than
+// subscriberBuffer events behind; it can then resume from the last event
+// it saw.
+type Subscription struct {
+	Events <-chan Event
+
+	bus *eventBus
+	ch  chan Event
+}
+
+// Close stops delivery and closes Events.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// eventBus numbers events, keeps the most recent for resuming and fans
+// them out to subscribers without ever blocking the publisher.
+type eventBus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event // oldest first, at most eventHistory
+	subscribers map[*Subscription]bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*Subscription]bool)}
+}
+
+// publish assigns IDs to events and delivers them.
+func (e *eventBus) publish(events []Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ev := range events {
+		e.lastID++
+		ev.ID = e.lastID
+		e.history = append(e.history, ev)
+		if len(e.history) > eventHistory {
+			e.history = e.history[len(e.history)-eventHistory:]
+		}
+
+		for s := range e.subscribers {
+			select {
+			case s.ch <- ev:
+			default:
+				// Too slow: drop it rather than stall updates
+				delete(e.subscribers, s)
+				close(s.ch)
+			}
+		}
+	}
+}
+
+// subscribe registers a subscriber. If lastID is non-zero and every event
+// after it is still buffered, those events are returned with resumed set;
+// otherwise the caller should start from a snapshot.
+func (e *eventBus) subscribe(lastID uint64) (*Subscription, []Event, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{Events: ch, bus: e, ch: ch}
+	e.subscribers[s] = true
+
+	if lastID == 0 || lastID > e.lastID {
+		// Nothing to resume, or an ID from before a restart
+		return s, nil, false
+	}
+	if len(e.history) > 0 && e.history[0].ID > lastID+1 {
+		return s, nil, false
+	}
+	var missed []Event
+	for _, ev := range e.history {
+		if ev.ID > lastID {
+			missed = append(missed, ev)
+		}
+	}
+	return s, missed, true
+}
+
+func (e *eventBus) unsubscribe(s *Subscription) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.subscribers[s] {
+		delete(e.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// deviceSnapshot is the state of a device for change detection.
+type deviceSnapshot struct {
+	state    interface{}
+	friendly string
+}
+
+// snapshotDevices records every device's state. Caller must hold b.mu.
+func (b *Bridge) snapshotDevices() map[string]deviceSnapshot {
+	snap := make(map[string]deviceSnapshot, len(b.devices))
+	for key, dev := range b.devices {
+		snap[key] = deviceSnapshot{dev.State(), dev.FriendlyState()}
+	}
+	return snap
+}
+
+// publishChanges publishes an event for every device whose state differs
+// from before. Nothing is published for the initial load. Caller must
+// hold b.mu.
+func (b *Bridge) publishChanges(before map[string]deviceSnapshot) {
+	if len(before) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(b.devices))
+	for key := range b.devices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	now := time.Now()
+	var events []Event
+	for _, key := range keys {
+		dev := b.devices[key]
+		old, existed := before[key]
+		if existed && old.state == dev.State() && old.friendly == dev.FriendlyState() {
+			continue
+		}
+		ev := Event{
+			Time:          now,
+			Device:        key,
+			Name:          dev.Name(),
+			State:         dev.State(),
+			FriendlyState: dev.FriendlyState(),
+		}
+		if existed {
+			ev.PreviousState = old.state
+		}
+		events = append(events, ev)
+	}
+
+	if len(events) > 0 {
+		b.events.publish(events)
+	}
+}
+
+// Subscribe returns a subscription to device change events. Pass the ID
+// of the last event seen to resume after a disconnect: if the events
+// since are still buffered they are returned and resumed is true.
+// Otherwise (or for lastID 0) resumed is false and the caller should read
+// the current state, e.g. with Devices, before relying on events.
+func (b *Bridge) Subscribe(lastID uint64) (sub *Subscription, missed []Event, resumed bool) {
+	return b.events.subscribe(lastID)
+}
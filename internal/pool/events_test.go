@@ -0,0 +1,101 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+func TestUpdateDevicesPublishesChanges(t *testing.T) {
+	b := newTestBridge()
+	sub, missed, resumed := b.Subscribe(0)
+	defer sub.Close()
+	if resumed || len(missed) != 0 {
+		t.Fatalf("fresh Subscribe() = %v, %v", missed, resumed)
+	}
+
+	// Nothing changed
+	b.updateDevices()
+	select {
+	case ev := <-sub.Events:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+
+	b.data.Circuits[gateway.CircuitSpa].State = 0
+	b.data.Bodies[1].CurrentTemperature = 102
+	b.updateDevices()
+
+	got := map[string]Event{}
+	for len(got) < 2 {
+		ev := <-sub.Events
+		got[ev.Device] = ev
+	}
+	if ev := got["spa"]; ev.State != 0 || ev.PreviousState != 1 || ev.FriendlyState != "Off" || ev.Name != "Spa" {
+		t.Errorf("spa event = %+v", ev)
+	}
+	if ev := got["current_spa_temperature"]; ev.State != 102 || ev.PreviousState != 101 {
+		t.Errorf("temperature event = %+v", ev)
+	}
+	select {
+	case ev := <-sub.Events:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestEventBusResume(t *testing.T) {
+	bus := newEventBus()
+	bus.publish([]Event{{Device: "spa"}, {Device: "cleaner"}, {Device: "pool"}})
+
+	sub, missed, resumed := bus.subscribe(1)
+	sub.Close()
+	if !resumed || len(missed) != 2 || missed[0].ID != 2 || missed[1].Device != "pool" {
+		t.Errorf("subscribe(1) = %+v, %v", missed, resumed)
+	}
+
+	// Up to date
+	sub, missed, resumed = bus.subscribe(3)
+	sub.Close()
+	if !resumed || len(missed) != 0 {
+		t.Errorf("subscribe(3) = %+v, %v", missed, resumed)
+	}
+
+	// An ID from before a restart
+	sub, _, resumed = bus.subscribe(40)
+	sub.Close()
+	if resumed {
+		t.Error("subscribe(40) should not resume")
+	}
+
+	// Events that have left the buffer
+	for i := 0; i < eventHistory; i++ {
+		bus.publish([]Event{{Device: "spa"}})
+	}
+	sub, _, resumed = bus.subscribe(2)
+	sub.Close()
+	if resumed {
+		t.Error("subscribe(2) should not resume after the buffer wrapped")
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := newEventBus()
+	slow, _, _ := bus.subscribe(0)
+	fast, _, _ := bus.subscribe(0)
+	defer fast.Close()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.publish([]Event{{Device: "spa"}})
+		<-fast.Events
+	}
+
+	n := 0
+	for range slow.Events {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	slow.Close() // closing again is harmless
+}
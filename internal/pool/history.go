@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// historyTimeout bounds a history query. The gateway sends a week of
+// samples in one message, which takes longer than other queries.
+const historyTimeout = 30 * time.Second
+
+// History is the controller's log between From and To: temperature
+// samples and the runs of the pool, spa, solar, heater and lights.
+type History struct {
+	From            time.Time           `json:"from"`
+	To              time.Time           `json:"to"`
+	Unit            string              `json:"unit"`
+	AirTemperature  []TemperatureSample `json:"airTemperature"`
+	PoolTemperature []TemperatureSample `json:"poolTemperature"`
+	PoolSetPoint    []TemperatureSample `json:"poolSetPoint"`
+	SpaTemperature  []TemperatureSample `json:"spaTemperature"`
+	SpaSetPoint     []TemperatureSample `json:"spaSetPoint"`
+	Runs            map[string][]Run    `json:"runs"`
+}
+
+// TemperatureSample is one logged temperature.
+type TemperatureSample struct {
+	Time        time.Time `json:"time"`
+	Temperature int       `json:"temperature"`
+}
+
+// Run is a period something was on. Off is nil for a run still in
+// progress.
+type Run struct {
+	On      time.Time  `json:"on"`
+	Off     *time.Time `json:"off,omitempty"`
+	Seconds int        `json:"seconds"`
+}
+
+// GetHistory fetches the controller's log between from and to.
+func (b *Bridge) GetHistory(from, to time.Time) (*History, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("history range %s to %s: %w", from.Format(time.RFC3339), to.Format(time.RFC3339), ErrInvalidValue)
+	}
+
+	// Don't hold the lock for the query: it can take historyTimeout, and the
+	// session already keeps it from overlapping other requests
+	b.mu.RLock()
+	session, unit := b.session, b.unit()
+	b.mu.RUnlock()
+
+	data, err := gateway.QueryHistory(session, from, to, session.ClientID(), historyTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+
+	// Runs still in progress count up to now, or the end of a past range
+	until := to
+	if now := time.Now(); until.After(now) {
+		until = now
+	}
+
+	return &History{
+		From:            from,
+		To:              to,
+		Unit:            unit,
+		AirTemperature:  temperatureSamples(data.AirTemps),
+		PoolTemperature: temperatureSamples(data.PoolTemps),
+		PoolSetPoint:    temperatureSamples(data.PoolSetPoints),
+		SpaTemperature:  temperatureSamples(data.SpaTemps),
+		SpaSetPoint:     temperatureSamples(data.SpaSetPoints),
+		Runs: map[string][]Run{
+			"pool":   runs(data.PoolRuns, until),
+			"spa":    runs(data.SpaRuns, until),
+			"solar":  runs(data.SolarRuns, until),
+			"heater": runs(data.HeaterRuns, until),
+			"light":  runs(data.LightRuns, until),
+		},
+	}, nil
+}
+
+// temperatureSamples converts logged temperatures.
+func temperatureSamples(samples []gateway.TemperatureSample) []TemperatureSample {
+	out := make([]TemperatureSample, len(samples))
+	for i, s := range samples {
+		out[i] = TemperatureSample{Time: s.Time, Temperature: s.Temperature}
+	}
+	return out
+}
+
+// runs converts logged runs, counting open runs up to until.
+func runs(logged []gateway.Run, until time.Time) []Run {
+	out := make([]Run, len(logged))
+	for i, r := range logged {
+		end := until
+		out[i] = Run{On: r.On}
+		if !r.Off.IsZero() {
+			off := r.Off
+			out[i].Off = &off
+			end = off
+		}
+		out[i].Seconds = int(end.Sub(r.On) / time.Second)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package pool
+
+import "github.com/nstielau/pool-controller/internal/gateway"
+
+// Light is a color light circuit (IntelliBrite, MagicStream, etc.). It
+// switches like any other circuit and also tracks the selected light show.
+type Light struct {
+	Switch
+	mode string
+}
+
+// NewLight creates a new Light from circuit data.
+func NewLight(circuit *gateway.Circuit) *Light {
+	return &Light{
+		Switch: *NewSwitch(circuit),
+	}
+}
+
+// HassType returns the Home Assistant device type.
+func (l *Light) HassType() string {
+	return "light"
+}
+
+// Mode returns the last selected light show, or "" if unknown.
+func (l *Light) Mode() string {
+	return l.mode
+}
+
+// SetMode records the selected light show.
+func (l *Light) SetMode(mode string) {
+	l.mode = mode
+}
+
+// Modes returns the light commands this light accepts.
+func (l *Light) Modes() []string {
+	return LightModes()
+}
+
+// LightModes returns the commands accepted by SetLightMode: on, off, sync,
+// swim and every light show.
+func LightModes() []string {
+	modes := []string{"Off", "On", "Sync", "Swim"}
+	return append(modes, gateway.LightShows...)
+}
+
+// lightMode canonicalizes a light command name, reporting false if it is
+// not one of LightModes.
+func lightMode(name string) (string, int, bool) {
+	index, ok := gateway.ColorModeByName(name)
+	if !ok {
+		return "", 0, false
+	}
+	canonical := gateway.ColorMode[index]
+	for _, m := range LightModes() {
+		if m == canonical {
+			return canonical, index, true
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+func TestNewLight(t *testing.T) {
+	light := NewLight(&gateway.Circuit{ID: 503, Name: "Pool Light", State: 1, Function: gateway.FunctionIntelliBrite})
+
+	if light.IntID() != 503 || light.Name() != "Pool Light" {
+		t.Errorf("NewLight() = %d %s, want 503 Pool Light", light.IntID(), light.Name())
+	}
+	if !light.IsOn() {
+		t.Error("light should be on")
+	}
+	if light.HassType() != "light" {
+		t.Errorf("HassType() = %s, want light", light.HassType())
+	}
+	if light.Mode() != "" {
+		t.Errorf("Mode() = %q, want empty before any command", light.Mode())
+	}
+}
+
+func TestLightMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "caribbean", want: "Caribbean", wantOK: true},
+		{name: "PARTY", want: "Party", wantOK: true},
+		{name: "off", want: "Off", wantOK: true},
+		{name: "recall", wantOK: false},
+		{name: "disco", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, _, ok := lightMode(tt.name)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("lightMode(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
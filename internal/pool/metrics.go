@@ -0,0 +1,35 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/metrics"
+)
+
+// WriteMetrics writes the numeric state of every device, how long ago the
+// status was last refreshed, and whether the gateway is connected.
+func (b *Bridge) WriteMetrics(w *metrics.Writer) {
+	w.Family("pool_device_value",
+		"Numeric device state: temperatures and set points in the pool's unit, 1 for circuits that are on, chemistry readings.",
+		metrics.GaugeType)
+	for _, d := range b.Devices() {
+		if v, ok := seriesValue(d.State); ok {
+			w.Sample("pool_device_value", v, "device", d.Key, "name", d.Name, "type", d.HassType, "unit", d.Unit)
+		}
+	}
+
+	b.mu.RLock()
+	lastUpdate := b.lastUpdate
+	b.mu.RUnlock()
+	if !lastUpdate.IsZero() {
+		w.Family("pool_last_update_age_seconds", "Time since the pool status was last refreshed from the gateway.", metrics.GaugeType)
+		w.Sample("pool_last_update_age_seconds", time.Since(lastUpdate).Seconds())
+	}
+
+	connected := 0.0
+	if b.session.IsConnected() {
+		connected = 1
+	}
+	w.Family("pool_gateway_connected", "Whether the gateway session is logged in.", metrics.GaugeType)
+	w.Sample("pool_gateway_connected", connected)
+}
@@ -0,0 +1,336 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// Schedule types
+const (
+	ScheduleRecurring = "recurring"
+	ScheduleRunOnce   = "runOnce"
+)
+
+// Schedule is a schedule stored on the controller. It turns a circuit on
+// from Start to Stop on the chosen days, optionally changing the heat mode
+// and set point of the body the circuit belongs to.
+type Schedule struct {
+	ID           int       `json:"id"`
+	Type         string    `json:"type"`
+	Circuit      string    `json:"circuit,omitempty"`
+	CircuitID    int       `json:"circuitId"`
+	Days         Weekdays  `json:"days"`
+	Start        TimeOfDay `json:"start"`
+	Stop         TimeOfDay `json:"stop"`
+	HeatMode     string    `json:"heatMode"`
+	HeatSetPoint int       `json:"heatSetPoint"`
+}
+
+// Weekdays is a set of days in the controller's bitmask: bit 0 is Monday
+// through bit 6 for Sunday. It is a list of day names in JSON.
+type Weekdays uint8
+
+// AllDays is every day of the week.
+const AllDays Weekdays = 0x7f
+
+var weekdayNames = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// String returns the days as a comma separated list.
+func (d Weekdays) String() string {
+	return strings.Join(d.names(), ",")
+}
+
+// names returns the short names of the days in the set.
+func (d Weekdays) names() []string {
+	names := []string{}
+	for i, name := range weekdayNames {
+		if d&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MarshalJSON encodes the days as ["mon","wed"].
+func (d Weekdays) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.names())
+}
+
+// UnmarshalJSON accepts day names ("mon" or "Monday") or a raw bitmask.
+func (d *Weekdays) UnmarshalJSON(data []byte) error {
+	var mask int
+	if err := json.Unmarshal(data, &mask); err == nil {
+		if mask < 0 || mask > int(AllDays) {
+			return fmt.Errorf("day mask %d outside 0-%d", mask, AllDays)
+		}
+		*d = Weekdays(mask)
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("days must be a list of day names")
+	}
+
+	var days Weekdays
+	for _, name := range names {
+		day, ok := weekdayByName(name)
+		if !ok {
+			return fmt.Errorf("unknown day %q", name)
+		}
+		days |= day
+	}
+	*d = days
+	return nil
+}
+
+// weekdayByName looks up a day by its name or first three letters.
+func weekdayByName(name string) (Weekdays, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for i, short := range weekdayNames {
+		if strings.HasPrefix(name, short) {
+			return 1 << i, true
+		}
+	}
+	return 0, false
+}
+
+// TimeOfDay is minutes after midnight, "HH:MM" in JSON.
+type TimeOfDay int
+
+// minutesPerDay bounds TimeOfDay.
+const minutesPerDay = 24 * 60
+
+// String returns the time as "HH:MM".
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", int(t)/60, int(t)%60)
+}
+
+// MarshalJSON encodes the time as "HH:MM".
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON decodes "HH:MM" (24-hour).
+func (t *TimeOfDay) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("time must be a \"HH:MM\" string")
+	}
+	parsed, err := time.Parse("15:04", s)
+	if err != nil {
+		return fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	*t = TimeOfDay(parsed.Hour()*60 + parsed.Minute())
+	return nil
+}
+
+// GetSchedules returns every schedule on the controller, recurring first.
+func (b *Bridge) GetSchedules() ([]Schedule, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.querySchedules()
+}
+
+// GetSchedule returns one schedule by ID.
+func (b *Bridge) GetSchedule(id int) (Schedule, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.findSchedule(id)
+}
+
+// AddSchedule creates a schedule on the controller and returns it with its
+// new ID. The type defaults to recurring and the heat mode to "Don't
+// Change".
+func (b *Bridge) AddSchedule(s Schedule) (Schedule, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s.Type == "" {
+		s.Type = ScheduleRecurring
+	}
+	event, err := b.scheduleEvent(s)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	scheduleType := gateway.ScheduleRecurring
+	if s.Type == ScheduleRunOnce {
+		scheduleType = gateway.ScheduleRunOnce
+	}
+	event.ID, err = gateway.AddSchedule(b.session, scheduleType, b.timeout)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	// Don't leave an empty schedule behind if it can't be filled in
+	if err := gateway.SetSchedule(b.session, event, b.timeout); err != nil {
+		if delErr := gateway.DeleteSchedule(b.session, event.ID, b.timeout); delErr != nil {
+			return Schedule{}, fmt.Errorf("%w (and failed to remove schedule %d: %v)", err, event.ID, delErr)
+		}
+		return Schedule{}, err
+	}
+
+	return b.schedule(event, s.Type), nil
+}
+
+// UpdateSchedule overwrites the schedule with s.ID. The type of an existing
+// schedule can't be changed.
+func (b *Bridge) UpdateSchedule(s Schedule) (Schedule, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing, err := b.findSchedule(s.ID)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if s.Type != "" && s.Type != existing.Type {
+		return Schedule{}, fmt.Errorf("schedule type can't change from %s: %w", existing.Type, ErrInvalidValue)
+	}
+	s.Type = existing.Type
+
+	event, err := b.scheduleEvent(s)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if err := gateway.SetSchedule(b.session, event, b.timeout); err != nil {
+		return Schedule{}, err
+	}
+
+	return b.schedule(event, s.Type), nil
+}
+
+// DeleteSchedule removes a schedule from the controller.
+func (b *Bridge) DeleteSchedule(id int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.findSchedule(id); err != nil {
+		return err
+	}
+	return gateway.DeleteSchedule(b.session, id, b.timeout)
+}
+
+// querySchedules fetches both kinds of schedule. Caller must hold b.mu.
+func (b *Bridge) querySchedules() ([]Schedule, error) {
+	schedules := []Schedule{}
+	for _, kind := range []struct {
+		gatewayType int
+		name        string
+	}{
+		{gateway.ScheduleRecurring, ScheduleRecurring},
+		{gateway.ScheduleRunOnce, ScheduleRunOnce},
+	} {
+		events, err := gateway.QuerySchedules(b.session, kind.gatewayType, b.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s schedules: %w", kind.name, err)
+		}
+		for _, event := range events {
+			schedules = append(schedules, b.schedule(event, kind.name))
+		}
+	}
+	return schedules, nil
+}
+
+// findSchedule returns the schedule with id. Caller must hold b.mu.
+func (b *Bridge) findSchedule(id int) (Schedule, error) {
+	schedules, err := b.querySchedules()
+	if err != nil {
+		return Schedule{}, err
+	}
+	for _, s := range schedules {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Schedule{}, fmt.Errorf("schedule %d: %w", id, ErrNotFound)
+}
+
+// schedule converts a controller schedule. Caller must hold b.mu.
+func (b *Bridge) schedule(event gateway.ScheduleEvent, scheduleType string) Schedule {
+	s := Schedule{
+		ID:           event.ID,
+		Type:         scheduleType,
+		CircuitID:    event.CircuitID,
+		Days:         Weekdays(event.DayMask) & AllDays,
+		Start:        TimeOfDay(event.StartMinutes),
+		Stop:         TimeOfDay(event.StopMinutes),
+		HeatMode:     heatModeName(event.HeatMode),
+		HeatSetPoint: event.HeatSetPoint,
+	}
+	if circuit, ok := b.data.Circuits[event.CircuitID]; ok {
+		s.Circuit = circuitKey(circuit.Name)
+	}
+	return s
+}
+
+// scheduleEvent validates s and converts it for the controller. The
+// circuit may be given by device name or ID. Caller must hold b.mu.
+func (b *Bridge) scheduleEvent(s Schedule) (gateway.ScheduleEvent, error) {
+	event := gateway.ScheduleEvent{
+		ID:           s.ID,
+		CircuitID:    s.CircuitID,
+		StartMinutes: int(s.Start),
+		StopMinutes:  int(s.Stop),
+		DayMask:      int(s.Days),
+		HeatSetPoint: s.HeatSetPoint,
+	}
+
+	switch s.Type {
+	case ScheduleRecurring:
+	case ScheduleRunOnce:
+		event.Flags = gateway.ScheduleFlagRunOnce
+	default:
+		return event, fmt.Errorf("schedule type %q: %w", s.Type, ErrInvalidValue)
+	}
+
+	if s.Circuit != "" {
+		sw, ok := b.devices[s.Circuit].(interface{ IntID() int })
+		if !ok {
+			return event, fmt.Errorf("circuit %q: %w", s.Circuit, ErrInvalidValue)
+		}
+		event.CircuitID = sw.IntID()
+	}
+	if _, ok := b.switches[event.CircuitID]; !ok {
+		return event, fmt.Errorf("circuit %d: %w", event.CircuitID, ErrInvalidValue)
+	}
+
+	if s.Days == 0 || s.Days&^AllDays != 0 {
+		return event, fmt.Errorf("schedule needs at least one day: %w", ErrInvalidValue)
+	}
+	if s.Start < 0 || s.Start >= minutesPerDay || s.Stop < 0 || s.Stop >= minutesPerDay || s.Start == s.Stop {
+		return event, fmt.Errorf("schedule %s-%s: %w", s.Start, s.Stop, ErrInvalidValue)
+	}
+
+	event.HeatMode = gateway.HeatModeDontChange
+	if s.HeatMode != "" {
+		mode, ok := gateway.HeatModeByName(s.HeatMode)
+		if !ok {
+			return event, fmt.Errorf("heat mode %q: %w", s.HeatMode, ErrInvalidValue)
+		}
+		event.HeatMode = mode
+	}
+
+	// The set point applies to the spa for the spa circuit, else the pool
+	if s.HeatSetPoint != 0 {
+		body := 0
+		if event.CircuitID == gateway.CircuitSpa {
+			body = 1
+		}
+		minTemp, maxTemp := b.data.Config.MinSetPoint[body], b.data.Config.MaxSetPoint[body]
+		if s.HeatSetPoint < minTemp || s.HeatSetPoint > maxTemp {
+			return event, fmt.Errorf("set point %d outside %d-%d: %w", s.HeatSetPoint, minTemp, maxTemp, ErrInvalidValue)
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,155 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+func TestWeekdaysJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Weekdays
+		wantErr bool
+	}{
+		{in: `["mon","wed"]`, want: 0x05},
+		{in: `["Saturday","SUNDAY"]`, want: 0x60},
+		{in: `127`, want: AllDays},
+		{in: `[]`, want: 0},
+		{in: `["mo"]`, wantErr: true},
+		{in: `["someday"]`, wantErr: true},
+		{in: `128`, wantErr: true},
+		{in: `"mon"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got Weekdays
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("Unmarshal(%s) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+
+	out, _ := json.Marshal(Weekdays(0x41))
+	if string(out) != `["mon","sun"]` {
+		t.Errorf("Marshal() = %s", out)
+	}
+}
+
+func TestTimeOfDayJSON(t *testing.T) {
+	var got TimeOfDay
+	if err := json.Unmarshal([]byte(`"07:30"`), &got); err != nil || got != 450 {
+		t.Errorf("Unmarshal(07:30) = %d, %v, want 450", got, err)
+	}
+	for _, in := range []string{`"24:00"`, `"7pm"`, `450`} {
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%s) should fail", in)
+		}
+	}
+
+	out, _ := json.Marshal(TimeOfDay(21*60 + 5))
+	if string(out) != `"21:05"` {
+		t.Errorf("Marshal() = %s", out)
+	}
+}
+
+func TestScheduleEventValidation(t *testing.T) {
+	b := newTestBridge()
+	valid := Schedule{Type: ScheduleRecurring, Circuit: "spa", Days: AllDays, Start: 18 * 60, Stop: 20 * 60}
+
+	event, err := b.scheduleEvent(valid)
+	if err != nil {
+		t.Fatalf("scheduleEvent() error = %v", err)
+	}
+	if event.CircuitID != gateway.CircuitSpa || event.HeatMode != gateway.HeatModeDontChange || event.Flags != 0 {
+		t.Errorf("scheduleEvent() = %+v", event)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Schedule)
+	}{
+		{"unknown type", func(s *Schedule) { s.Type = "weekly" }},
+		{"unknown circuit", func(s *Schedule) { s.Circuit = "hot_tub" }},
+		{"unknown circuit id", func(s *Schedule) { s.Circuit, s.CircuitID = "", 999 }},
+		{"no days", func(s *Schedule) { s.Days = 0 }},
+		{"start equals stop", func(s *Schedule) { s.Stop = s.Start }},
+		{"stop past midnight", func(s *Schedule) { s.Stop = 24 * 60 }},
+		{"unknown heat mode", func(s *Schedule) { s.HeatMode = "Boil" }},
+		{"set point too high", func(s *Schedule) { s.HeatSetPoint = 110 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			if _, err := b.scheduleEvent(s); !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("scheduleEvent() error = %v, want ErrInvalidValue", err)
+			}
+		})
+	}
+
+	s := valid
+	s.Type, s.Circuit, s.CircuitID = ScheduleRunOnce, "", gateway.CircuitSpa
+	s.HeatMode, s.HeatSetPoint = "Heat", 102
+	event, err = b.scheduleEvent(s)
+	if err != nil {
+		t.Fatalf("scheduleEvent() error = %v", err)
+	}
+	if event.Flags != gateway.ScheduleFlagRunOnce || event.HeatMode != 3 || event.HeatSetPoint != 102 {
+		t.Errorf("scheduleEvent() = %+v", event)
+	}
+}
+
+func TestBridgeSchedulesWithSimulator(t *testing.T) {
+	b, sim := newSimBridge(t)
+
+	schedules, err := b.GetSchedules()
+	if err != nil {
+		t.Fatalf("GetSchedules() error = %v", err)
+	}
+	if len(schedules) != 1 || schedules[0].Circuit != "pool" || schedules[0].Days != AllDays {
+		t.Fatalf("GetSchedules() = %+v", schedules)
+	}
+
+	added, err := b.AddSchedule(Schedule{Circuit: "spa", Days: 0x60, Start: 17 * 60, Stop: 19 * 60})
+	if err != nil {
+		t.Fatalf("AddSchedule() error = %v", err)
+	}
+	if added.ID == 0 || added.Type != ScheduleRecurring || added.HeatMode != "Don't Change" {
+		t.Errorf("AddSchedule() = %+v", added)
+	}
+
+	// Validation happens before anything is created on the controller
+	if _, err := b.AddSchedule(Schedule{Circuit: "spa"}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("AddSchedule() without days error = %v, want ErrInvalidValue", err)
+	}
+	if n := len(sim.Scenario().Schedules); n != 2 {
+		t.Errorf("simulator has %d schedules, want 2", n)
+	}
+
+	added.Stop = 22 * 60
+	if _, err := b.UpdateSchedule(added); err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+	if got, _ := b.GetSchedule(added.ID); got.Stop != 22*60 {
+		t.Errorf("schedule stop = %s, want 22:00", got.Stop)
+	}
+	added.Type = ScheduleRunOnce
+	if _, err := b.UpdateSchedule(added); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("UpdateSchedule() changing type error = %v, want ErrInvalidValue", err)
+	}
+
+	if err := b.DeleteSchedule(added.ID); err != nil {
+		t.Fatalf("DeleteSchedule() error = %v", err)
+	}
+	if err := b.DeleteSchedule(added.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteSchedule() twice error = %v, want ErrNotFound", err)
+	}
+}
@@ -48,6 +48,20 @@ func NewChemistrySensor(id string, name string, value interface{}, unit string)
 	}
 }
 
+// NewBinarySensor creates an on/off sensor.
+func NewBinarySensor(id string, name string, on bool) *Sensor {
+	state := 0
+	if on {
+		state = 1
+	}
+	return &Sensor{
+		id:       id,
+		name:     name,
+		state:    state,
+		hassType: "binary_sensor",
+	}
+}
+
 // ID returns the sensor ID.
 func (s *Sensor) ID() interface{} {
 	return s.id
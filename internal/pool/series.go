@@ -0,0 +1,89 @@
+package pool
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/series"
+)
+
+// openSeries opens the series store configured by SERIES_DIR and
+// SERIES_RETENTION. It returns nil when SERIES_DIR is unset.
+func openSeries() (*series.Store, error) {
+	dir := os.Getenv("SERIES_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+
+	retention := series.DefaultRetention
+	if s := os.Getenv("SERIES_RETENTION"); s != "" {
+		var err error
+		retention, err = series.ParseRetention(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SERIES_RETENTION: %w", err)
+		}
+	}
+	return series.Open(dir, retention)
+}
+
+// recordSeries appends the numeric device states to the series store.
+// Caller must hold b.mu.
+func (b *Bridge) recordSeries(t time.Time) {
+	if b.series == nil {
+		return
+	}
+
+	values := make(map[string]float64, len(b.devices))
+	for key, device := range b.devices {
+		if v, ok := seriesValue(device.State()); ok {
+			values[key] = v
+		}
+	}
+
+	if err := b.series.Record(t, values); err != nil {
+		log.Printf("Failed to record series: %v", err)
+	}
+}
+
+// seriesValue converts a device state to a series value. Text states
+// have none.
+func seriesValue(state interface{}) (float64, bool) {
+	switch v := state.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// GetSeries returns the recorded states of a device between from and to.
+// It returns ErrNotFound if recording is off or the device is unknown.
+func (b *Bridge) GetSeries(device string, res series.Resolution, from, to time.Time) ([]series.Point, error) {
+	if b.series == nil {
+		return nil, fmt.Errorf("series recording is off (set SERIES_DIR): %w", ErrNotFound)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("series range %s to %s: %w", from.Format(time.RFC3339), to.Format(time.RFC3339), ErrInvalidValue)
+	}
+
+	b.mu.RLock()
+	_, ok := b.devices[device]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("device %q: %w", device, ErrNotFound)
+	}
+
+	points, err := b.series.Query(device, res, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read series: %w", err)
+	}
+	return points, nil
+}
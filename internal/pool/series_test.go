@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+	"github.com/nstielau/pool-controller/internal/series"
+)
+
+// refresh forces the next Update to poll the gateway.
+func refresh(t *testing.T, b *Bridge) {
+	t.Helper()
+	b.mu.Lock()
+	b.lastUpdate = time.Time{}
+	b.mu.Unlock()
+	if err := b.Update(); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+}
+
+func TestSeriesValue(t *testing.T) {
+	tests := []struct {
+		state  interface{}
+		want   float64
+		wantOK bool
+	}{
+		{78, 78, true},
+		{7.4, 7.4, true},
+		{true, 1, true},
+		{"Heater", 0, false},
+		{nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := seriesValue(tt.state)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("seriesValue(%v) = %v, %t, want %v, %t", tt.state, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBridgeSeriesWithSimulator(t *testing.T) {
+	t.Setenv("SERIES_DIR", t.TempDir())
+	b, _ := newSimBridge(t)
+
+	from := time.Now().Add(-time.Minute)
+	refresh(t, b)
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	refresh(t, b)
+	to := time.Now().Add(time.Minute)
+
+	temps, err := b.GetSeries("current_spa_temperature", series.Raw, from, to)
+	if err != nil {
+		t.Fatalf("GetSeries() error = %v", err)
+	}
+	if len(temps) < 2 || temps[0].Value != 99 {
+		t.Errorf("spa temperature points = %+v", temps)
+	}
+
+	spa, err := b.GetSeries("spa", series.Raw, from, to)
+	if err != nil {
+		t.Fatalf("GetSeries(spa) error = %v", err)
+	}
+	// SetCircuit refreshes too, so there may be more than the two polls
+	if len(spa) < 2 || spa[0].Value != 0 || spa[len(spa)-1].Value != 1 {
+		t.Errorf("spa points = %+v", spa)
+	}
+
+	if _, err := b.GetSeries("pool_heat_mode", series.Raw, from, to); err != nil {
+		t.Errorf("text device should have an empty series, got error %v", err)
+	}
+	if _, err := b.GetSeries("hot_tub", series.Raw, from, to); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSeries(unknown) error = %v, want ErrNotFound", err)
+	}
+	if _, err := b.GetSeries("spa", series.Raw, to, from); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("GetSeries(reversed range) error = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestBridgeSeriesRecordsPushes(t *testing.T) {
+	t.Setenv("SERIES_DIR", t.TempDir())
+	b, sim := newSimBridge(t)
+	from := time.Now().Add(-time.Minute)
+
+	// Someone turns the cleaner on at the panel; only a push reports it
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		for i := range sc.Circuits {
+			if sc.Circuits[i].ID == gateway.CircuitCleaner {
+				sc.Circuits[i].State = 1
+			}
+		}
+	})
+	waitFor(t, "cleaner on", func() bool { return b.GetCircuitState(gateway.CircuitCleaner) == 1 })
+
+	cleaner, err := b.GetSeries("cleaner", series.Raw, from, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetSeries() error = %v", err)
+	}
+	if len(cleaner) < 2 || cleaner[len(cleaner)-1].Value != 1 {
+		t.Errorf("cleaner points = %+v, want the pushed change recorded", cleaner)
+	}
+}
+
+func TestBridgeSeriesOff(t *testing.T) {
+	b, _ := newSimBridge(t)
+
+	if _, err := b.GetSeries("spa", series.Raw, time.Now().Add(-time.Hour), time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSeries() error = %v, want ErrNotFound without SERIES_DIR", err)
+	}
+}
@@ -0,0 +1,287 @@
+package pool
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+	"github.com/nstielau/pool-controller/internal/gateway/gatewaysim"
+)
+
+// newSimBridge starts a gateway simulator and a Bridge found through
+// discovery, the way the service starts up without GATEWAY_IP.
+func newSimBridge(t *testing.T) (*Bridge, *gatewaysim.Server) {
+	t.Helper()
+	return newSimBridgeWith(t, gatewaysim.DefaultScenario())
+}
+
+// newSimBridgeWith is newSimBridge for a custom scenario.
+func newSimBridgeWith(t *testing.T, sc *gatewaysim.Scenario) (*Bridge, *gatewaysim.Server) {
+	t.Helper()
+
+	sim := gatewaysim.NewServer(sc)
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	if err := sim.ListenDiscovery("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenDiscovery() error = %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	t.Setenv("GATEWAY_DISCOVERY_ADDR", sim.DiscoveryAddr().String())
+	t.Setenv("TIMERS_FILE", filepath.Join(t.TempDir(), "timers.json"))
+
+	b, err := NewBridge("", 0, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, sim
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridgeWithSimulator(t *testing.T) {
+	b, sim := newSimBridge(t)
+
+	if _, ok := b.GetDevice("swim_jets"); !ok {
+		t.Fatal("swim_jets device missing")
+	}
+	if got, err := b.GetSpaTemperature(); err != nil || got != 99 {
+		t.Errorf("GetSpaTemperature() = %d, %v, want 99", got, err)
+	}
+
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if !b.IsSpaOn() {
+		t.Error("spa should be on after SetCircuit")
+	}
+
+	if err := b.SetHeatSetPoint(1, 104); err != nil {
+		t.Fatalf("SetHeatSetPoint() error = %v", err)
+	}
+	if spa, _ := b.GetBody(1); spa.HeatSetPoint != 104 {
+		t.Errorf("spa heatSetPoint = %d, want 104", spa.HeatSetPoint)
+	}
+
+	if err := b.SetLightMode("party"); err != nil {
+		t.Fatalf("SetLightMode() error = %v", err)
+	}
+	if party, _ := gateway.ColorModeByName("party"); sim.LightCommand() != party {
+		t.Errorf("simulator light command = %d, want %d", sim.LightCommand(), party)
+	}
+}
+
+func TestBridgeToggleCircuit(t *testing.T) {
+	b, _ := newSimBridge(t)
+
+	// Concurrent toggles each see the other's change, so two cancel out
+	states := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			state, err := b.ToggleCircuit(gateway.CircuitSwimJets, 0)
+			if err != nil {
+				t.Errorf("ToggleCircuit() error = %v", err)
+			}
+			states <- state
+		}()
+	}
+	if got := <-states + <-states; got != 1 {
+		t.Errorf("toggles turned the swim jets on %d times, want 1", got)
+	}
+	if state := b.GetCircuitState(gateway.CircuitSwimJets); state != 0 {
+		t.Errorf("swim jets state = %d, want 0", state)
+	}
+}
+
+func TestBridgeFollowsSimulatorPushes(t *testing.T) {
+	b, sim := newSimBridge(t)
+
+	// Someone turns the cleaner on at the panel
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		for i := range sc.Circuits {
+			if sc.Circuits[i].ID == gateway.CircuitCleaner {
+				sc.Circuits[i].State = 1
+			}
+		}
+	})
+
+	waitFor(t, "cleaner on", func() bool { return b.GetCircuitState(gateway.CircuitCleaner) == 1 })
+}
+
+func TestBridgeWithoutPushes(t *testing.T) {
+	sc := gatewaysim.DefaultScenario()
+	sc.RejectPushes = true
+	b, sim := newSimBridgeWith(t, sc)
+
+	// Starting up doesn't need pushes; control calls refresh by themselves
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if b.GetCircuitState(gateway.CircuitSpa) != 1 {
+		t.Error("spa should be on")
+	}
+
+	// Nothing arrives for changes at the panel until the next poll
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		for i := range sc.Circuits {
+			if sc.Circuits[i].ID == gateway.CircuitCleaner {
+				sc.Circuits[i].State = 1
+			}
+		}
+	})
+	b.updateInterval = 0
+	waitFor(t, "cleaner on", func() bool {
+		b.Update()
+		return b.GetCircuitState(gateway.CircuitCleaner) == 1
+	})
+}
+
+func TestBridgeIgnoresStalePushes(t *testing.T) {
+	b, _ := newSimBridge(t)
+
+	// The push for the spa change is still queued when the jets go on; it
+	// must not switch the jets back off or cancel their timer
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if _, err := b.SetCircuitFor(gateway.CircuitSwimJets, 1, 20*time.Minute); err != nil {
+		t.Fatalf("SetCircuitFor() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if state := b.GetCircuitState(gateway.CircuitSwimJets); state != 1 {
+		t.Errorf("swim jets state = %d, want 1", state)
+	}
+	if _, ok := b.CircuitOffAt(gateway.CircuitSwimJets); !ok {
+		t.Error("swim jets auto-off was cancelled by a stale push")
+	}
+}
+
+func TestBridgeFollowsSimulatorHeaterAndFreeze(t *testing.T) {
+	b, sim := newSimBridge(t)
+
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		sc.FreezeMode = true
+		for i := range sc.Bodies {
+			if sc.Bodies[i].Type == 1 {
+				sc.Bodies[i].HeatStatus = 1
+			}
+		}
+	})
+
+	state := func(key string) string {
+		dev, ok := b.GetDevice(key)
+		if !ok {
+			return ""
+		}
+		return dev.FriendlyState()
+	}
+	waitFor(t, "freeze protection on", func() bool { return state("freeze_protection") == "On" })
+	waitFor(t, "spa heater on", func() bool { return state("spa_heater_1") == "On" })
+}
+
+func TestBridgeWithIntelliChem(t *testing.T) {
+	sc := gatewaysim.DefaultScenario()
+	sc.Chemistry.IntelliChem = true
+	sc.Chemistry.CalciumHardness = 250
+	b, sim := newSimBridgeWith(t, sc)
+
+	state := func(key string) string {
+		dev, ok := b.GetDevice(key)
+		if !ok {
+			return ""
+		}
+		return dev.FriendlyState()
+	}
+	if got := state("calcium_hardness"); got != "250 ppm" {
+		t.Errorf("calcium_hardness = %q, want 250 ppm", got)
+	}
+	if got := state("chemistry_alarms"); got != "None" {
+		t.Errorf("chemistry_alarms = %q, want None", got)
+	}
+
+	// The controller runs out of acid
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		sc.Chemistry.PHTankLevel = 0
+		sc.Chemistry.Alarms = gateway.ChemAlarmPHSupply
+		sc.Chemistry.Alerts = gateway.ChemAlertPHLockout
+	})
+
+	waitFor(t, "chemistry alerts", func() bool { return state("chemistry_alerts") == "pH Lockout" })
+	if got := state("chemistry_alarms"); got != "pH Tank Empty" {
+		t.Errorf("chemistry_alarms = %q, want pH Tank Empty", got)
+	}
+	if got := state("chemistry_alarm"); got != "On" {
+		t.Errorf("chemistry_alarm = %q, want On", got)
+	}
+}
+
+func TestBridgeKeepsReadingsWhenEquipmentFails(t *testing.T) {
+	sc := gatewaysim.DefaultScenario()
+	sc.Chemistry.IntelliChem = true
+	sc.Chemistry.CalciumHardness = 250
+	b, sim := newSimBridgeWith(t, sc)
+
+	// IntelliChem and the pumps stop answering
+	sim.Update(func(sc *gatewaysim.Scenario) {
+		sc.FailQueries = []uint16{gateway.ChemistryQuery, gateway.PumpStatusQuery}
+		sc.Chemistry.CalciumHardness = 300
+	})
+
+	// The change is applied, so the control call succeeds and devices follow
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if b.GetCircuitState(gateway.CircuitSpa) != 1 {
+		t.Error("spa should be on")
+	}
+	if dev, ok := b.GetDevice("calcium_hardness"); !ok || dev.FriendlyState() != "250 ppm" {
+		t.Errorf("calcium_hardness = %v, want the last reading (250 ppm)", dev)
+	}
+
+	// Nor does it stop a restart
+	b.Close()
+	restarted, err := NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	restarted.Close()
+}
+
+func TestBridgePumpFollowsCircuits(t *testing.T) {
+	b, _ := newSimBridge(t)
+
+	state := func(key string) string {
+		dev, ok := b.GetDevice(key)
+		if !ok {
+			return ""
+		}
+		return dev.FriendlyState()
+	}
+	if got := state("pump_1"); got != "Off" {
+		t.Errorf("pump_1 = %q, want Off with every circuit off", got)
+	}
+
+	if err := b.SetCircuit(gateway.CircuitCleaner, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	if got := state("pump_1_rpm"); got != "3000 RPM" {
+		t.Errorf("pump_1_rpm = %q, want 3000 RPM with the cleaner on", got)
+	}
+	if got := state("pump_1_watts"); got == "0 W" {
+		t.Error("pump_1_watts should be nonzero while running")
+	}
+}
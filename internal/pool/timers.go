@@ -0,0 +1,270 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/atomicfile"
+)
+
+// timerRetryInterval is how long to wait before retrying a failed auto-off.
+const timerRetryInterval = time.Minute
+
+// circuitTimers turns circuits off after a delay. Pending timers are saved
+// to disk so they survive a restart; a timer that expired while the service
+// was down fires as soon as it is loaded.
+type circuitTimers struct {
+	mu         sync.Mutex
+	path       string
+	pending    map[int]*circuitTimer
+	maxRuntime map[int]time.Duration
+	turnOff    func(circuitID int) error
+	logger     *log.Logger
+}
+
+// circuitTimer is a single pending auto-off.
+type circuitTimer struct {
+	offAt time.Time
+	timer *time.Timer
+}
+
+// persistedTimer is the on-disk form of a pending auto-off.
+type persistedTimer struct {
+	CircuitID int       `json:"circuitId"`
+	OffAt     time.Time `json:"offAt"`
+}
+
+// newCircuitTimers creates a timer set persisted at path ("" disables
+// persistence). turnOff is called from a timer goroutine when a timer fires.
+func newCircuitTimers(path string, turnOff func(circuitID int) error) *circuitTimers {
+	return &circuitTimers{
+		path:       path,
+		pending:    make(map[int]*circuitTimer),
+		maxRuntime: make(map[int]time.Duration),
+		turnOff:    turnOff,
+		logger:     log.New(os.Stdout, "[timers] ", log.LstdFlags),
+	}
+}
+
+// load re-arms timers saved by a previous run.
+func (t *circuitTimers) load() error {
+	if t.path == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read timers: %w", err)
+	}
+
+	var saved []persistedTimer
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return fmt.Errorf("failed to parse timers: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range saved {
+		t.logger.Printf("Restoring auto-off for circuit %d at %s", p.CircuitID, p.OffAt.Format(time.RFC3339))
+		t.arm(p.CircuitID, p.OffAt)
+	}
+	t.save()
+
+	return nil
+}
+
+// schedule turns circuitID off after d, capped by its max runtime.
+// It replaces any timer already pending for the circuit.
+func (t *circuitTimers) schedule(circuitID int, d time.Duration) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if max, ok := t.maxRuntime[circuitID]; ok && d > max {
+		d = max
+	}
+
+	offAt := time.Now().Add(d)
+	t.arm(circuitID, offAt)
+	t.save()
+
+	return offAt
+}
+
+// scheduleDefault arms the circuit's max runtime, if it has one and no
+// timer is already pending.
+func (t *circuitTimers) scheduleDefault(circuitID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	max, ok := t.maxRuntime[circuitID]
+	if !ok {
+		return
+	}
+	if _, pending := t.pending[circuitID]; pending {
+		return
+	}
+
+	t.arm(circuitID, time.Now().Add(max))
+	t.save()
+}
+
+// cancel removes any pending timer for circuitID.
+func (t *circuitTimers) cancel(circuitID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ct, ok := t.pending[circuitID]; ok {
+		ct.timer.Stop()
+		delete(t.pending, circuitID)
+		t.save()
+	}
+}
+
+// offAt returns when circuitID will be turned off, if a timer is pending.
+func (t *circuitTimers) offAt(circuitID int) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ct, ok := t.pending[circuitID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return ct.offAt, true
+}
+
+// circuits returns the IDs of circuits with a pending timer.
+func (t *circuitTimers) circuits() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]int, 0, len(t.pending))
+	for id := range t.pending {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// setMaxRuntime limits how long circuitID may run (0 removes the limit).
+func (t *circuitTimers) setMaxRuntime(circuitID int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d <= 0 {
+		delete(t.maxRuntime, circuitID)
+		return
+	}
+	t.maxRuntime[circuitID] = d
+}
+
+// stop halts all timers without forgetting them, so they are restored on
+// the next load.
+func (t *circuitTimers) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ct := range t.pending {
+		ct.timer.Stop()
+	}
+}
+
+// arm starts (or restarts) the timer for circuitID. Caller must hold t.mu.
+func (t *circuitTimers) arm(circuitID int, offAt time.Time) {
+	if ct, ok := t.pending[circuitID]; ok {
+		ct.timer.Stop()
+	}
+
+	t.pending[circuitID] = &circuitTimer{
+		offAt: offAt,
+		timer: time.AfterFunc(time.Until(offAt), func() { t.fire(circuitID, offAt) }),
+	}
+}
+
+// fire turns the circuit off, retrying later if the gateway is unavailable.
+func (t *circuitTimers) fire(circuitID int, offAt time.Time) {
+	t.mu.Lock()
+	ct, ok := t.pending[circuitID]
+	if !ok || !ct.offAt.Equal(offAt) {
+		// Cancelled or replaced since this timer was armed
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	t.logger.Printf("Turning off circuit %d", circuitID)
+	if err := t.turnOff(circuitID); err != nil {
+		t.logger.Printf("Auto-off for circuit %d failed, retrying in %v: %v", circuitID, timerRetryInterval, err)
+		t.mu.Lock()
+		if ct, ok := t.pending[circuitID]; ok && ct.offAt.Equal(offAt) {
+			ct.timer = time.AfterFunc(timerRetryInterval, func() { t.fire(circuitID, offAt) })
+		}
+		t.mu.Unlock()
+		return
+	}
+
+	t.mu.Lock()
+	if ct, ok := t.pending[circuitID]; ok && ct.offAt.Equal(offAt) {
+		delete(t.pending, circuitID)
+		t.save()
+	}
+	t.mu.Unlock()
+}
+
+// save writes pending timers to disk. Caller must hold t.mu.
+func (t *circuitTimers) save() {
+	if t.path == "" {
+		return
+	}
+
+	saved := make([]persistedTimer, 0, len(t.pending))
+	for id, ct := range t.pending {
+		saved = append(saved, persistedTimer{CircuitID: id, OffAt: ct.offAt})
+	}
+
+	raw, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		t.logger.Printf("Failed to encode timers: %v", err)
+		return
+	}
+
+	if err := atomicfile.WriteFile(t.path, raw, 0o644); err != nil {
+		t.logger.Printf("Failed to save timers: %v", err)
+	}
+}
+
+// parseMaxRuntimes parses a list like "502=45m,500=4h" into per-circuit
+// maximum runtimes.
+func parseMaxRuntimes(s string) (map[int]time.Duration, error) {
+	runtimes := make(map[int]time.Duration)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		idStr, durStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid max runtime %q: want circuit=duration", entry)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit in %q: %w", entry, err)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(durStr))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in %q", entry)
+		}
+		runtimes[id] = d
+	}
+	return runtimes, nil
+}
@@ -0,0 +1,225 @@
+package pool
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// offRecorder records circuits turned off by timers.
+type offRecorder struct {
+	mu  sync.Mutex
+	ids []int
+	ch  chan int
+}
+
+func newOffRecorder() *offRecorder {
+	return &offRecorder{ch: make(chan int, 10)}
+}
+
+func (r *offRecorder) turnOff(circuitID int) error {
+	r.mu.Lock()
+	r.ids = append(r.ids, circuitID)
+	r.mu.Unlock()
+	r.ch <- circuitID
+	return nil
+}
+
+func (r *offRecorder) wait(t *testing.T) int {
+	t.Helper()
+	select {
+	case id := <-r.ch:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("timer did not fire")
+		return 0
+	}
+}
+
+func TestCircuitTimersFire(t *testing.T) {
+	rec := newOffRecorder()
+	timers := newCircuitTimers("", rec.turnOff)
+
+	timers.schedule(gateway.CircuitSpa, 20*time.Millisecond)
+	if _, ok := timers.offAt(gateway.CircuitSpa); !ok {
+		t.Fatal("timer should be pending")
+	}
+
+	if id := rec.wait(t); id != gateway.CircuitSpa {
+		t.Errorf("turned off circuit %d, want %d", id, gateway.CircuitSpa)
+	}
+	if _, ok := timers.offAt(gateway.CircuitSpa); ok {
+		t.Error("timer should be cleared after firing")
+	}
+}
+
+func TestCircuitTimersCancel(t *testing.T) {
+	rec := newOffRecorder()
+	timers := newCircuitTimers("", rec.turnOff)
+
+	timers.schedule(gateway.CircuitSpa, 20*time.Millisecond)
+	timers.cancel(gateway.CircuitSpa)
+
+	time.Sleep(50 * time.Millisecond)
+	if len(rec.ch) != 0 {
+		t.Error("cancelled timer fired")
+	}
+}
+
+func TestCircuitTimersMaxRuntime(t *testing.T) {
+	timers := newCircuitTimers("", newOffRecorder().turnOff)
+	timers.setMaxRuntime(gateway.CircuitSwimJets, 45*time.Minute)
+
+	offAt := timers.schedule(gateway.CircuitSwimJets, 2*time.Hour)
+	if d := time.Until(offAt); d > 45*time.Minute {
+		t.Errorf("timer runs %v, want capped at 45m", d)
+	}
+
+	timers.cancel(gateway.CircuitSwimJets)
+	timers.scheduleDefault(gateway.CircuitSwimJets)
+	if _, ok := timers.offAt(gateway.CircuitSwimJets); !ok {
+		t.Error("scheduleDefault should arm the max runtime")
+	}
+
+	timers.scheduleDefault(gateway.CircuitSpa)
+	if _, ok := timers.offAt(gateway.CircuitSpa); ok {
+		t.Error("scheduleDefault should do nothing without a max runtime")
+	}
+}
+
+func TestCircuitTimersPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.json")
+
+	first := newCircuitTimers(path, newOffRecorder().turnOff)
+	want := first.schedule(gateway.CircuitSpa, time.Hour)
+	first.stop()
+
+	second := newCircuitTimers(path, newOffRecorder().turnOff)
+	if err := second.load(); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	defer second.stop()
+
+	got, ok := second.offAt(gateway.CircuitSpa)
+	if !ok || !got.Equal(want) {
+		t.Errorf("restored offAt = %v, %v, want %v", got, ok, want)
+	}
+}
+
+func TestCircuitTimersExpiredWhileDown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.json")
+	saved, _ := json.Marshal([]persistedTimer{
+		{CircuitID: gateway.CircuitSpa, OffAt: time.Now().Add(-time.Hour)},
+	})
+	if err := os.WriteFile(path, saved, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newOffRecorder()
+	timers := newCircuitTimers(path, rec.turnOff)
+	if err := timers.load(); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	if id := rec.wait(t); id != gateway.CircuitSpa {
+		t.Errorf("turned off circuit %d, want %d", id, gateway.CircuitSpa)
+	}
+
+	// The fired timer is removed and saved after turnOff returns; wait for
+	// that write before the temp dir is cleaned up
+	waitFor(t, "fired timer cleared", func() bool {
+		_, pending := timers.offAt(gateway.CircuitSpa)
+		return !pending
+	})
+}
+
+func TestParseMaxRuntimes(t *testing.T) {
+	got, err := parseMaxRuntimes("502=45m, 500=4h")
+	if err != nil {
+		t.Fatalf("parseMaxRuntimes() error = %v", err)
+	}
+	if got[502] != 45*time.Minute || got[500] != 4*time.Hour {
+		t.Errorf("parseMaxRuntimes() = %v", got)
+	}
+
+	if got, err := parseMaxRuntimes(""); err != nil || len(got) != 0 {
+		t.Errorf("parseMaxRuntimes(\"\") = %v, %v, want empty", got, err)
+	}
+
+	for _, bad := range []string{"502", "spa=45m", "502=soon", "502=-5m"} {
+		if _, err := parseMaxRuntimes(bad); err == nil {
+			t.Errorf("parseMaxRuntimes(%q) should fail", bad)
+		}
+	}
+}
+
+func TestBridgeCancelsTimerOnManualOff(t *testing.T) {
+	b := newTestBridge()
+	b.timers.schedule(gateway.CircuitSpa, time.Hour)
+
+	spa, _ := b.GetAttribute("spa")
+	if _, ok := spa.(map[string]interface{})["remainingSeconds"]; !ok {
+		t.Errorf("spa JSON should include remainingSeconds, got %v", spa)
+	}
+
+	// Someone turns the spa off at the panel
+	b.data.Circuits[gateway.CircuitSpa].State = 0
+	b.updateDevices()
+
+	if _, ok := b.CircuitOffAt(gateway.CircuitSpa); ok {
+		t.Error("timer should be cancelled after manual off")
+	}
+}
+
+func TestBridgeArmsMaxRuntimeOnManualOn(t *testing.T) {
+	b := newTestBridge()
+	b.timers.setMaxRuntime(gateway.CircuitPoolLight, time.Hour)
+
+	// Someone turns the light on in the vendor app
+	b.data.Circuits[gateway.CircuitPoolLight].State = 1
+	b.updateDevices()
+
+	if _, ok := b.CircuitOffAt(gateway.CircuitPoolLight); !ok {
+		t.Error("max runtime should be armed when the circuit turns on")
+	}
+	b.timers.stop()
+}
+
+func TestBridgeRestoresTimersForCircuitsOn(t *testing.T) {
+	t.Setenv("CIRCUIT_MAX_RUNTIMES", "500=4h")
+	b, sim := newSimBridge(t)
+
+	if err := b.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+		t.Fatalf("SetCircuit() error = %v", err)
+	}
+	spaOff, ok := b.CircuitOffAt(gateway.CircuitSpa)
+	if !ok {
+		t.Fatal("max runtime should be armed for the spa")
+	}
+	jetsOff, err := b.SetCircuitFor(gateway.CircuitSwimJets, 1, 20*time.Minute)
+	if err != nil {
+		t.Fatalf("SetCircuitFor() error = %v", err)
+	}
+
+	// Restart while both circuits are on; the spa must keep its saved
+	// deadline rather than a fresh max runtime, and the jets' timer must
+	// not be overwritten
+	b.Close()
+	time.Sleep(10 * time.Millisecond)
+	restarted, err := NewBridge("127.0.0.1", sim.Addr().Port, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+	defer restarted.Close()
+
+	for id, want := range map[int]time.Time{gateway.CircuitSpa: spaOff, gateway.CircuitSwimJets: jetsOff} {
+		if got, ok := restarted.CircuitOffAt(id); !ok || !got.Equal(want) {
+			t.Errorf("circuit %d offAt after restart = %v, %v, want %v", id, got, ok, want)
+		}
+	}
+}
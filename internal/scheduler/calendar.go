@@ -0,0 +1,568 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchTimeout bounds a single calendar download.
+const fetchTimeout = 30 * time.Second
+
+// parseLog reports the parts of a feed that were skipped.
+var parseLog = log.New(os.Stdout, "[calendar] ", log.LstdFlags)
+
+// maxRecurrencePeriods bounds how far a recurring event is expanded, so a
+// daily rule with no end cannot loop forever.
+const maxRecurrencePeriods = 50000
+
+// CalendarEvent is a single occurrence of a calendar event. Recurring events
+// are expanded into one CalendarEvent per occurrence, each with its own UID.
+type CalendarEvent struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+}
+
+// ActiveAt reports whether the event is in progress at t.
+func (e CalendarEvent) ActiveAt(t time.Time) bool {
+	return !t.Before(e.Start) && t.Before(e.End)
+}
+
+// FetchEvents downloads the iCal feed at calendarURL and returns the events
+// overlapping [from, to).
+func FetchEvents(calendarURL string, from, to time.Time) ([]CalendarEvent, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(calendarURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch calendar: %s", resp.Status)
+	}
+
+	return ParseEvents(resp.Body, from, to)
+}
+
+// ParseEvents parses an iCal (RFC 5545) feed and returns the events
+// overlapping [from, to), sorted by start time.
+//
+// Recurring events (RRULE with FREQ DAILY, WEEKLY, MONTHLY or YEARLY) are
+// expanded, honoring EXDATE and RECURRENCE-ID overrides. Cancelled events
+// are dropped. Rules the parser does not understand yield only the first
+// occurrence. Malformed lines and events that can't be parsed (such as a
+// TZID naming a Windows time zone) are logged and skipped, so one bad event
+// doesn't hide the rest of the feed.
+func ParseEvents(r io.Reader, from, to time.Time) ([]CalendarEvent, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	vevents, err := parseVEvents(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overrides replace single occurrences of a recurring event
+	overrides := make(map[string]map[int64]bool)
+	for _, v := range vevents {
+		if v.recurrenceID.IsZero() {
+			continue
+		}
+		if overrides[v.uid] == nil {
+			overrides[v.uid] = make(map[int64]bool)
+		}
+		overrides[v.uid][v.recurrenceID.Unix()] = true
+	}
+
+	var events []CalendarEvent
+	for _, v := range vevents {
+		if v.cancelled {
+			continue
+		}
+
+		if !v.recurrenceID.IsZero() {
+			e := v.event(v.start, instanceUID(v.uid, v.recurrenceID))
+			if overlaps(e, from, to) {
+				events = append(events, e)
+			}
+			continue
+		}
+
+		if v.rrule == "" {
+			e := v.event(v.start, v.uid)
+			if overlaps(e, from, to) {
+				events = append(events, e)
+			}
+			continue
+		}
+
+		for _, start := range v.occurrences(to) {
+			if v.exdates[start.Unix()] || overrides[v.uid][start.Unix()] {
+				continue
+			}
+			e := v.event(start, instanceUID(v.uid, start))
+			if overlaps(e, from, to) {
+				events = append(events, e)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events, nil
+}
+
+// instanceUID identifies one occurrence of a recurring event.
+func instanceUID(uid string, start time.Time) string {
+	return uid + "/" + start.UTC().Format("20060102T150405Z")
+}
+
+// overlaps reports whether e intersects [from, to).
+func overlaps(e CalendarEvent, from, to time.Time) bool {
+	return e.End.After(from) && e.Start.Before(to)
+}
+
+// vevent is a VEVENT as written in the feed, before recurrence expansion.
+type vevent struct {
+	uid          string
+	summary      string
+	start        time.Time
+	duration     time.Duration
+	allDay       bool
+	rrule        string
+	exdates      map[int64]bool
+	recurrenceID time.Time
+	cancelled    bool
+}
+
+// event returns the occurrence of v starting at start.
+func (v vevent) event(start time.Time, uid string) CalendarEvent {
+	end := start.Add(v.duration)
+	if v.allDay {
+		// Whole days, so DST changes do not shift the end
+		days := int(v.duration.Round(24*time.Hour) / (24 * time.Hour))
+		end = start.AddDate(0, 0, days)
+	}
+	return CalendarEvent{
+		UID:     uid,
+		Summary: v.summary,
+		Start:   start,
+		End:     end,
+		AllDay:  v.allDay,
+	}
+}
+
+// contentLine is one property line, e.g. DTSTART;TZID=America/Denver:20260117T180000.
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfoldLines reads r and joins folded continuation lines.
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// parseContentLine splits a line into name, parameters and value.
+func parseContentLine(line string) (contentLine, error) {
+	// The value starts at the first colon outside a quoted parameter
+	inQuote := false
+	sep := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		}
+		if c == ':' && !inQuote {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return contentLine{}, fmt.Errorf("invalid calendar line %q", line)
+	}
+
+	parts := strings.Split(line[:sep], ";")
+	cl := contentLine{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[sep+1:],
+	}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		cl.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return cl, nil
+}
+
+// parseVEvents collects the VEVENT components in lines. Nested components
+// such as VALARM are skipped, as are malformed lines and events. A feed
+// that ends inside an event is probably truncated and fails as a whole.
+func parseVEvents(lines []string) ([]vevent, error) {
+	var events []vevent
+	var props []contentLine
+	inEvent := false
+	nested := 0
+
+	for _, line := range lines {
+		cl, err := parseContentLine(line)
+		if err != nil {
+			parseLog.Printf("skipping %v", err)
+			continue
+		}
+
+		switch {
+		case cl.name == "BEGIN" && strings.EqualFold(cl.value, "VEVENT"):
+			inEvent = true
+			props = nil
+		case cl.name == "END" && strings.EqualFold(cl.value, "VEVENT"):
+			if !inEvent {
+				parseLog.Printf("skipping unexpected END:VEVENT")
+				continue
+			}
+			inEvent = false
+			v, err := newVEvent(props)
+			if err != nil {
+				parseLog.Printf("skipping %v", err)
+				continue
+			}
+			events = append(events, v)
+		case !inEvent:
+		case cl.name == "BEGIN":
+			nested++
+		case cl.name == "END":
+			nested--
+		case nested == 0:
+			props = append(props, cl)
+		}
+	}
+
+	if inEvent {
+		return nil, fmt.Errorf("unterminated VEVENT")
+	}
+	return events, nil
+}
+
+// newVEvent builds a vevent from its properties.
+func newVEvent(props []contentLine) (vevent, error) {
+	v := vevent{exdates: make(map[int64]bool)}
+	var end time.Time
+	var duration string
+
+	for _, p := range props {
+		var err error
+		switch p.name {
+		case "UID":
+			v.uid = p.value
+		case "SUMMARY":
+			v.summary = unescapeText(p.value)
+		case "DTSTART":
+			v.start, v.allDay, err = parseDateTime(p.value, p.params)
+		case "DTEND":
+			end, _, err = parseDateTime(p.value, p.params)
+		case "DURATION":
+			duration = p.value
+		case "RRULE":
+			v.rrule = p.value
+		case "EXDATE":
+			for _, value := range strings.Split(p.value, ",") {
+				t, _, err := parseDateTime(value, p.params)
+				if err != nil {
+					return vevent{}, fmt.Errorf("event %s: %w", v.uid, err)
+				}
+				v.exdates[t.Unix()] = true
+			}
+		case "RECURRENCE-ID":
+			v.recurrenceID, _, err = parseDateTime(p.value, p.params)
+		case "STATUS":
+			v.cancelled = strings.EqualFold(p.value, "CANCELLED")
+		}
+		if err != nil {
+			return vevent{}, fmt.Errorf("event %s: %w", v.uid, err)
+		}
+	}
+
+	if v.uid == "" {
+		return vevent{}, fmt.Errorf("event without UID")
+	}
+	if v.start.IsZero() {
+		return vevent{}, fmt.Errorf("event %s: missing DTSTART", v.uid)
+	}
+
+	switch {
+	case !end.IsZero():
+		v.duration = end.Sub(v.start)
+	case duration != "":
+		d, err := parseDuration(duration)
+		if err != nil {
+			return vevent{}, fmt.Errorf("event %s: %w", v.uid, err)
+		}
+		v.duration = d
+	case v.allDay:
+		v.duration = 24 * time.Hour
+	}
+	if v.duration < 0 {
+		return vevent{}, fmt.Errorf("event %s: ends before it starts", v.uid)
+	}
+
+	return v, nil
+}
+
+// parseDateTime parses a DATE or DATE-TIME value. UTC values end in Z;
+// others use the TZID parameter, or local time if there is none.
+func parseDateTime(value string, params map[string]string) (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+		loc = l
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date-time %q", value)
+		}
+		return t, false, nil
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date-time %q", value)
+	}
+	return t, false, nil
+}
+
+// parseDuration parses an iCal duration such as PT1H30M, P1D or P2W.
+func parseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+
+	var total time.Duration
+	inTime := false
+	num := ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num += string(c)
+		default:
+			unit, ok := units[c]
+			if !ok || num == "" || (c == 'M' && !inTime) {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			n, _ := strconv.Atoi(num)
+			total += time.Duration(n) * unit
+			num = ""
+		}
+	}
+	if num != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * total, nil
+}
+
+// unescapeText decodes an iCal TEXT value.
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// recurrence is a parsed RRULE.
+type recurrence struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+// weekdays maps RRULE day codes to weekdays.
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// parseRRule parses the supported subset of RRULE. It returns false for
+// rules it cannot expand.
+func parseRRule(value string, loc *time.Location) (recurrence, bool) {
+	rule := recurrence{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return recurrence{}, false
+			}
+			rule.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return recurrence{}, false
+			}
+			rule.count = n
+		case "UNTIL":
+			t, _, err := parseDateTime(v, map[string]string{"TZID": loc.String()})
+			if err != nil {
+				return recurrence{}, false
+			}
+			rule.until = t
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				wd, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					// Ordinal days like 2SA are not supported
+					return recurrence{}, false
+				}
+				rule.byDay = append(rule.byDay, wd)
+			}
+		case "WKST":
+		default:
+			// BYMONTH, BYSETPOS and friends change which days match
+			return recurrence{}, false
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return recurrence{}, false
+	}
+	if len(rule.byDay) > 0 && rule.freq != "WEEKLY" {
+		return recurrence{}, false
+	}
+	return rule, true
+}
+
+// occurrences returns the start times of v up to (not including) limit.
+// Times are computed in wall-clock time, so a 6 PM event stays at 6 PM
+// across DST changes.
+func (v vevent) occurrences(limit time.Time) []time.Time {
+	rule, ok := parseRRule(v.rrule, v.start.Location())
+	if !ok {
+		return []time.Time{v.start}
+	}
+
+	y, m, d := v.start.Date()
+	hh, mm, ss := v.start.Clock()
+	loc := v.start.Location()
+
+	days := rule.byDay
+	if rule.freq == "WEEKLY" && len(days) == 0 {
+		days = []time.Weekday{v.start.Weekday()}
+	}
+	// Weeks start on Monday (the RFC 5545 default WKST)
+	weekStart := d - (int(v.start.Weekday())+6)%7
+	sort.Slice(days, func(i, j int) bool { return (days[i]+6)%7 < (days[j]+6)%7 })
+
+	var starts []time.Time
+	emitted := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		n := period * rule.interval
+
+		var candidates []time.Time
+		switch rule.freq {
+		case "DAILY":
+			candidates = []time.Time{time.Date(y, m, d+n, hh, mm, ss, 0, loc)}
+		case "WEEKLY":
+			for _, wd := range days {
+				offset := (int(wd) + 6) % 7
+				candidates = append(candidates, time.Date(y, m, weekStart+7*n+offset, hh, mm, ss, 0, loc))
+			}
+		case "MONTHLY":
+			t := time.Date(y, m+time.Month(n), d, hh, mm, ss, 0, loc)
+			if t.Day() == d {
+				candidates = []time.Time{t}
+			}
+		case "YEARLY":
+			t := time.Date(y+n, m, d, hh, mm, ss, 0, loc)
+			if t.Day() == d {
+				candidates = []time.Time{t}
+			}
+		}
+
+		for _, t := range candidates {
+			if t.Before(v.start) {
+				continue
+			}
+			if !rule.until.IsZero() && t.After(rule.until) {
+				return starts
+			}
+			if rule.count > 0 && emitted >= rule.count {
+				return starts
+			}
+			if !t.Before(limit) {
+				return starts
+			}
+			starts = append(starts, t)
+			emitted++
+		}
+	}
+	return starts
+}
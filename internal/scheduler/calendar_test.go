@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // fixtures use TZID=America/Los_Angeles
+)
+
+func parseFixture(t *testing.T, name string, from, to time.Time) []CalendarEvent {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+
+	events, err := ParseEvents(f, from, to)
+	if err != nil {
+		t.Fatalf("ParseEvents(%s) error = %v", name, err)
+	}
+	return events
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	return v
+}
+
+func TestParseICal_TimedEvent(t *testing.T) {
+	events := parseFixture(t, "timed.ics", mustTime(t, "2026-01-01T00:00:00Z"), mustTime(t, "2026-02-01T00:00:00Z"))
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2 (cancelled event dropped): %+v", len(events), events)
+	}
+
+	first := events[0]
+	if first.UID != "timed-1@google.com" || first.Summary != "Soak after dinner, with friends" {
+		t.Errorf("first event = %+v", first)
+	}
+	if !first.Start.Equal(mustTime(t, "2026-01-17T02:00:00Z")) || !first.End.Equal(mustTime(t, "2026-01-17T03:30:00Z")) {
+		t.Errorf("first event times = %v - %v", first.Start, first.End)
+	}
+	if first.AllDay {
+		t.Error("timed event marked all-day")
+	}
+
+	// TZID start with DURATION; 7 AM PST is 15:00 UTC
+	second := events[1]
+	if !second.Start.Equal(mustTime(t, "2026-01-18T15:00:00Z")) || second.End.Sub(second.Start) != 45*time.Minute {
+		t.Errorf("second event times = %v - %v", second.Start, second.End)
+	}
+}
+
+func TestParseICal_AllDayEvent_Ignored(t *testing.T) {
+	events := parseFixture(t, "allday.ics", mustTime(t, "2026-01-01T00:00:00Z"), mustTime(t, "2026-02-01T00:00:00Z"))
+
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	e := events[0]
+	if !e.AllDay {
+		t.Error("VALUE=DATE event should be all-day")
+	}
+	if e.End.Sub(e.Start) < 47*time.Hour {
+		t.Errorf("all-day event spans %v, want two days", e.End.Sub(e.Start))
+	}
+
+	// The scheduler never acts on all-day events
+	bridge := &mockBridge{}
+	s := newScheduler("", bridge, time.Minute, "")
+	s.processEvents([]CalendarEvent{e}, e.Start.Add(time.Hour))
+	if len(bridge.calls) != 0 {
+		t.Errorf("all-day event changed circuits: %v", bridge.calls)
+	}
+}
+
+func TestParseICal_RecurringEvent(t *testing.T) {
+	events := parseFixture(t, "recurring.ics", mustTime(t, "2026-03-01T00:00:00Z"), mustTime(t, "2026-04-01T00:00:00Z"))
+
+	// COUNT=6 occurrences, less the EXDATE; Mar 9 is moved to 8 PM
+	want := []string{
+		"2026-03-02T18:00:00-08:00",
+		"2026-03-09T20:00:00-07:00",
+		"2026-03-11T18:00:00-07:00", // after the DST change, still 6 PM
+		"2026-03-16T18:00:00-07:00",
+		"2026-03-18T18:00:00-07:00",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+
+	uids := make(map[string]bool)
+	for i, e := range events {
+		if !e.Start.Equal(mustTime(t, want[i])) {
+			t.Errorf("event %d starts %v, want %s", i, e.Start, want[i])
+		}
+		if e.End.Sub(e.Start) != time.Hour {
+			t.Errorf("event %d lasts %v, want 1h", i, e.End.Sub(e.Start))
+		}
+		if !strings.HasPrefix(e.UID, "weekly@google.com/") {
+			t.Errorf("event %d UID = %q", i, e.UID)
+		}
+		uids[e.UID] = true
+	}
+	if len(uids) != len(events) {
+		t.Error("occurrences should have distinct UIDs")
+	}
+
+	// Window filtering: the moved Mar 9 occurrence and Mar 11
+	events = parseFixture(t, "recurring.ics", mustTime(t, "2026-03-10T00:00:00Z"), mustTime(t, "2026-03-17T00:00:00Z"))
+	if len(events) != 2 {
+		t.Errorf("got %d events in window, want 2", len(events))
+	}
+}
+
+func TestParseEventsFoldedAndInvalid(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:fold\r\n ed@example.com\r\nDTSTART:20260117T020000Z\r\nDTEND:20260117T030000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	events, err := ParseEvents(strings.NewReader(feed), time.Time{}, mustTime(t, "2030-01-01T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("ParseEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].UID != "folded@example.com" {
+		t.Errorf("events = %+v", events)
+	}
+
+	if events, err := ParseEvents(strings.NewReader("BEGIN:VEVENT\nUID:x\nDTSTART:nope\nEND:VEVENT\n"), time.Time{}, time.Now()); err != nil || len(events) != 0 {
+		t.Errorf("ParseEvents() with bad DTSTART = %+v, %v, want it skipped", events, err)
+	}
+	if _, err := ParseEvents(strings.NewReader("BEGIN:VEVENT\nUID:x\n"), time.Time{}, time.Now()); err == nil {
+		t.Error("ParseEvents() with unterminated VEVENT should fail")
+	}
+}
+
+func TestParseEventsSkipsBadEvents(t *testing.T) {
+	events := parseFixture(t, "mixed.ics", mustTime(t, "2026-01-01T00:00:00Z"), mustTime(t, "2026-02-01T00:00:00Z"))
+
+	// The Windows zone name and the backwards event are dropped; the garbled
+	// line doesn't take its event with it
+	var uids []string
+	for _, e := range events {
+		uids = append(uids, e.UID)
+	}
+	if strings.Join(uids, " ") != "good-1@example.com good-2@example.com" {
+		t.Errorf("events = %v, want the two good ones", uids)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "P1D", want: 24 * time.Hour},
+		{in: "P1W", want: 7 * 24 * time.Hour},
+		{in: "P1DT2H", want: 26 * time.Hour},
+		{in: "-PT15M", want: -15 * time.Minute},
+		{in: "P1M", wantErr: true},
+		{in: "1H", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
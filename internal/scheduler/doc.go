@@ -0,0 +1,34 @@
+// Package scheduler turns the hot tub on from calendar events.
+//
+// # Overview
+//
+// The Scheduler polls a public iCal feed (CALENDAR_URL) every few minutes.
+// While a timed event is active it turns on the spa circuit (500), unless
+// the pool pump (505) or cleaner (501) is running; in that case the event
+// waits and the spa starts as soon as they stop. When the event ends the
+// spa is turned off, but only if the scheduler turned it on. All-day events
+// are ignored.
+//
+// # Calendar Parsing
+//
+// ParseEvents is a small RFC 5545 parser covering what calendar exports
+// use: folded lines, UTC/TZID/floating times, DURATION, and RRULE
+// expansion for DAILY, WEEKLY (with BYDAY), MONTHLY and YEARLY rules with
+// EXDATE and RECURRENCE-ID overrides. Each occurrence of a recurring event
+// gets its own UID so it is tracked separately. Malformed lines and events
+// it can't parse, such as Outlook's Windows time zone names, are logged and
+// skipped rather than failing the whole feed.
+//
+// # State
+//
+// Event states (pending, started, ended) are saved to SCHEDULER_STATE_FILE
+// (default scheduler_state.json) after every poll, so a restart during an
+// event still turns the spa off when it ends.
+//
+// # Usage
+//
+//	if calendarURL := os.Getenv(scheduler.EnvCalendarURL); calendarURL != "" {
+//	    sched := scheduler.New(calendarURL, bridge, scheduler.DefaultPollInterval)
+//	    go sched.Run(ctx)
+//	}
+package scheduler
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestScheduler_RealCalendar(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	calendarURL := os.Getenv(EnvCalendarURL)
+	if calendarURL == "" {
+		t.Skip("CALENDAR_URL not set")
+	}
+
+	now := time.Now()
+	events, err := FetchEvents(calendarURL, now.AddDate(0, 0, -30), now.AddDate(0, 0, 30))
+	if err != nil {
+		t.Fatalf("FetchEvents() error = %v", err)
+	}
+
+	var timed *CalendarEvent
+	for i := range events {
+		if !events[i].AllDay {
+			timed = &events[i]
+			break
+		}
+	}
+	if timed == nil {
+		t.Skip("no timed events within 30 days")
+	}
+	t.Logf("simulating %s (%s to %s)", timed.UID, timed.Start, timed.End)
+
+	// Walk one event from before it starts to after it ends
+	bridge := &mockBridge{}
+	s := newScheduler(calendarURL, bridge, time.Minute, "")
+	for _, at := range []time.Time{timed.Start.Add(-time.Minute), timed.Start, timed.End.Add(time.Minute)} {
+		s.processEvents([]CalendarEvent{*timed}, at)
+	}
+
+	want := "[500=1 500=0]"
+	if got := fmt.Sprint(bridge.calls); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// Environment variables read by the scheduler.
+const (
+	EnvCalendarURL = "CALENDAR_URL"
+	EnvStateFile   = "SCHEDULER_STATE_FILE"
+)
+
+// DefaultPollInterval is how often the calendar is checked.
+const DefaultPollInterval = 5 * time.Minute
+
+// Polling window around now. Only active events act, but the lookahead lets
+// the log show what is coming up.
+const (
+	pollLookbehind = 24 * time.Hour
+	pollLookahead  = 24 * time.Hour
+)
+
+// stateRetention is how long a finished event's state is kept.
+const stateRetention = 24 * time.Hour
+
+// BridgeInterface is the part of pool.Bridge the scheduler uses.
+type BridgeInterface interface {
+	Update() error
+	GetCircuitState(circuitID int) int
+	SetCircuit(circuitID, state int) error
+}
+
+// Scheduler turns the spa on for timed events in an iCal feed.
+//
+// Each event moves through pending (active but the pool or cleaner is
+// running), started (the scheduler turned the spa on) and ended. The spa is
+// only turned off for events the scheduler started, so manual use is left
+// alone. States are saved to disk so a restart mid-event still turns the
+// spa off at the end.
+type Scheduler struct {
+	calendarURL  string
+	pollInterval time.Duration
+	bridge       BridgeInterface
+	statePath    string
+	eventStates  map[string]eventState
+	mu           sync.Mutex
+	log          *log.Logger
+	now          func() time.Time
+}
+
+// New creates a scheduler for the feed at calendarURL. Event states are
+// saved to SCHEDULER_STATE_FILE (default scheduler_state.json).
+func New(calendarURL string, bridge BridgeInterface, pollInterval time.Duration) *Scheduler {
+	statePath := os.Getenv(EnvStateFile)
+	if statePath == "" {
+		statePath = "scheduler_state.json"
+	}
+	return newScheduler(calendarURL, bridge, pollInterval, statePath)
+}
+
+// newScheduler creates a scheduler with an explicit state file ("" keeps
+// state in memory only).
+func newScheduler(calendarURL string, bridge BridgeInterface, pollInterval time.Duration, statePath string) *Scheduler {
+	s := &Scheduler{
+		calendarURL:  calendarURL,
+		pollInterval: pollInterval,
+		bridge:       bridge,
+		statePath:    statePath,
+		log:          log.New(os.Stdout, "[scheduler] ", log.LstdFlags),
+		now:          time.Now,
+	}
+
+	states, err := loadStates(statePath)
+	if err != nil {
+		s.log.Printf("%v; starting with no event state", err)
+		states = make(map[string]eventState)
+	}
+	s.eventStates = states
+
+	return s
+}
+
+// Run polls the calendar until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	s.poll() // Run immediately on start
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.poll()
+		}
+	}
+}
+
+// poll fetches the calendar and advances every event's state.
+func (s *Scheduler) poll() {
+	now := s.now()
+
+	events, err := FetchEvents(s.calendarURL, now.Add(-pollLookbehind), now.Add(pollLookahead))
+	if err != nil {
+		// Still finish events we started, using their saved end times
+		s.log.Printf("error fetching calendar: %v", err)
+	} else {
+		active := 0
+		for _, event := range events {
+			if !event.AllDay && event.ActiveAt(now) {
+				active++
+			}
+		}
+		s.log.Printf("polling calendar, found %d active events", active)
+	}
+
+	s.processEvents(events, now)
+	s.save()
+}
+
+// processEvents advances the state of every timed event in events, then
+// of tracked events missing from it. All-day events are ignored.
+func (s *Scheduler) processEvents(events []CalendarEvent, now time.Time) {
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.AllDay {
+			continue
+		}
+		seen[event.UID] = true
+		s.processEvent(event, now)
+	}
+	s.finishMissing(seen, now)
+}
+
+// processEvent advances the state of one timed event.
+func (s *Scheduler) processEvent(event CalendarEvent, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.eventStates[event.UID].State
+
+	// Event is currently active
+	if event.ActiveAt(now) {
+		switch state {
+		case "", StatePending:
+			poolRunning, err := s.isPoolRunning()
+			if err != nil {
+				s.log.Printf("error checking pool status: %v", err)
+				return
+			}
+			if poolRunning {
+				if state == "" {
+					s.log.Printf("event %s waiting, pool is running", event.UID)
+				}
+				s.setState(event, StatePending)
+				return
+			}
+			if err := s.bridge.SetCircuit(gateway.CircuitSpa, 1); err != nil {
+				s.log.Printf("failed to turn on spa: %v", err)
+				return
+			}
+			s.log.Printf("started spa for event %s", event.UID)
+			s.setState(event, StateStarted)
+
+		case StateStarted:
+			// Already started; keep the end time current in case it moved
+			s.setState(event, StateStarted)
+		}
+		return
+	}
+
+	// Event has ended
+	if !now.Before(event.End) {
+		s.end(event.UID, event.End)
+	}
+}
+
+// finishMissing ends tracked events that are no longer in the feed (deleted,
+// or the fetch failed) once their saved end time passes, and forgets events
+// that finished long enough ago.
+func (s *Scheduler) finishMissing(seen map[string]bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for uid, es := range s.eventStates {
+		if now.Before(es.End) {
+			continue
+		}
+		if !seen[uid] && es.State != StateEnded {
+			s.end(uid, es.End)
+		}
+		if es.State == StateEnded && now.Sub(es.End) > stateRetention {
+			delete(s.eventStates, uid)
+		}
+	}
+}
+
+// end moves an event to ended, turning the spa off if the scheduler
+// started it. Caller must hold s.mu.
+func (s *Scheduler) end(uid string, endTime time.Time) {
+	switch s.eventStates[uid].State {
+	case StateStarted:
+		if err := s.bridge.SetCircuit(gateway.CircuitSpa, 0); err != nil {
+			s.log.Printf("failed to turn off spa: %v", err)
+			return
+		}
+		s.log.Printf("stopped spa for event %s", uid)
+	case StatePending:
+		s.log.Printf("event %s ended before the pool stopped", uid)
+	default:
+		return
+	}
+	s.eventStates[uid] = eventState{State: StateEnded, End: endTime}
+}
+
+// setState records state for event. Caller must hold s.mu.
+func (s *Scheduler) setState(event CalendarEvent, state State) {
+	s.eventStates[event.UID] = eventState{State: state, End: event.End}
+}
+
+// isPoolRunning reports whether the pool pump or cleaner is on, which
+// blocks starting the spa.
+func (s *Scheduler) isPoolRunning() (bool, error) {
+	if err := s.bridge.Update(); err != nil {
+		return false, fmt.Errorf("failed to update bridge status: %w", err)
+	}
+
+	poolOn := s.bridge.GetCircuitState(gateway.CircuitPool) > 0
+	cleanerOn := s.bridge.GetCircuitState(gateway.CircuitCleaner) > 0
+
+	return poolOn || cleanerOn, nil
+}
+
+// save persists event states.
+func (s *Scheduler) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := saveStates(s.statePath, s.eventStates); err != nil {
+		s.log.Printf("%v", err)
+	}
+}
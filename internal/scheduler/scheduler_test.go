@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/gateway"
+)
+
+// mockBridge records circuit changes.
+type mockBridge struct {
+	circuits  map[int]int
+	updateErr error
+	calls     []string
+}
+
+func (m *mockBridge) Update() error { return m.updateErr }
+
+func (m *mockBridge) GetCircuitState(circuitID int) int { return m.circuits[circuitID] }
+
+func (m *mockBridge) SetCircuit(circuitID, state int) error {
+	if m.circuits == nil {
+		m.circuits = make(map[int]int)
+	}
+	m.circuits[circuitID] = state
+	m.calls = append(m.calls, fmt.Sprintf("%d=%d", circuitID, state))
+	return nil
+}
+
+var (
+	eventStart = time.Date(2026, 1, 17, 18, 0, 0, 0, time.UTC)
+	testEvent  = CalendarEvent{UID: "soak", Start: eventStart, End: eventStart.Add(time.Hour)}
+	during     = eventStart.Add(10 * time.Minute)
+	after      = eventStart.Add(61 * time.Minute)
+)
+
+func TestProcessEvent_PoolRunning_StaysPending(t *testing.T) {
+	bridge := &mockBridge{circuits: map[int]int{gateway.CircuitPool: 1}}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+	s.processEvent(testEvent, during.Add(5*time.Minute))
+
+	if got := s.eventStates["soak"].State; got != StatePending {
+		t.Errorf("state = %q, want pending", got)
+	}
+	if len(bridge.calls) != 0 {
+		t.Errorf("circuits changed while pool running: %v", bridge.calls)
+	}
+
+	// Cleaner blocks too
+	bridge = &mockBridge{circuits: map[int]int{gateway.CircuitCleaner: 1}}
+	s = newScheduler("", bridge, time.Minute, "")
+	s.processEvent(testEvent, during)
+	if got := s.eventStates["soak"].State; got != StatePending {
+		t.Errorf("state with cleaner running = %q, want pending", got)
+	}
+}
+
+func TestProcessEvent_PoolOff_StartsSpa(t *testing.T) {
+	bridge := &mockBridge{circuits: map[int]int{gateway.CircuitPool: 1}}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+
+	// Pool stops mid-event: the spa starts on the next poll
+	bridge.circuits[gateway.CircuitPool] = 0
+	s.processEvent(testEvent, during.Add(5*time.Minute))
+
+	if got := s.eventStates["soak"].State; got != StateStarted {
+		t.Errorf("state = %q, want started", got)
+	}
+	if bridge.circuits[gateway.CircuitSpa] != 1 {
+		t.Error("spa should be on")
+	}
+}
+
+func TestProcessEvent_AlreadyStarted_NoAction(t *testing.T) {
+	bridge := &mockBridge{}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+	s.processEvent(testEvent, during.Add(5*time.Minute))
+
+	if len(bridge.calls) != 1 {
+		t.Errorf("calls = %v, want a single spa on", bridge.calls)
+	}
+}
+
+func TestProcessEvent_EventEnds_StopsSpa(t *testing.T) {
+	bridge := &mockBridge{}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+	s.processEvent(testEvent, after)
+	s.processEvent(testEvent, after.Add(5*time.Minute))
+
+	if got := s.eventStates["soak"].State; got != StateEnded {
+		t.Errorf("state = %q, want ended", got)
+	}
+	want := []string{"500=1", "500=0"}
+	if fmt.Sprint(bridge.calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v", bridge.calls, want)
+	}
+}
+
+func TestProcessEvent_NeverStarted_NoStopOnEnd(t *testing.T) {
+	// Spa turned on by hand while the pool kept the event pending
+	bridge := &mockBridge{circuits: map[int]int{gateway.CircuitPool: 1, gateway.CircuitSpa: 1}}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+	s.processEvent(testEvent, after)
+
+	if got := s.eventStates["soak"].State; got != StateEnded {
+		t.Errorf("state = %q, want ended", got)
+	}
+	if len(bridge.calls) != 0 {
+		t.Errorf("calls = %v, want none", bridge.calls)
+	}
+
+	// Event never seen while active
+	s = newScheduler("", bridge, time.Minute, "")
+	s.processEvent(testEvent, after)
+	if _, ok := s.eventStates["soak"]; ok || len(bridge.calls) != 0 {
+		t.Error("past event should be ignored")
+	}
+}
+
+func TestProcessEvent_UpdateError(t *testing.T) {
+	bridge := &mockBridge{updateErr: errors.New("gateway down")}
+	s := newScheduler("", bridge, time.Minute, "")
+
+	s.processEvent(testEvent, during)
+
+	if _, ok := s.eventStates["soak"]; ok || len(bridge.calls) != 0 {
+		t.Error("no state change expected when status is unknown")
+	}
+}
+
+func TestSchedulerStatePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	bridge := &mockBridge{}
+
+	s := newScheduler("", bridge, time.Minute, path)
+	s.processEvents([]CalendarEvent{testEvent}, during)
+	s.save()
+
+	// Restarted mid-event, and the event has since vanished from the feed
+	s = newScheduler("", bridge, time.Minute, path)
+	if got := s.eventStates["soak"].State; got != StateStarted {
+		t.Fatalf("restored state = %q, want started", got)
+	}
+	s.processEvents(nil, during.Add(5*time.Minute))
+	if bridge.circuits[gateway.CircuitSpa] != 1 {
+		t.Error("spa turned off before the event ended")
+	}
+	s.processEvents(nil, after)
+	if bridge.circuits[gateway.CircuitSpa] != 0 {
+		t.Error("spa should be off once the saved end time passes")
+	}
+
+	// Ended states are forgotten after the retention period
+	s.processEvents(nil, after.Add(stateRetention+time.Minute))
+	if _, ok := s.eventStates["soak"]; ok {
+		t.Error("ended state should be cleaned up")
+	}
+}
+
+func TestSchedulerPoll(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	bridge := &mockBridge{}
+	s := newScheduler(srv.URL+"/timed.ics", bridge, time.Minute, filepath.Join(t.TempDir(), "state.json"))
+
+	// During timed-1 (02:00-03:30Z)
+	s.now = func() time.Time { return time.Date(2026, 1, 17, 2, 30, 0, 0, time.UTC) }
+	s.poll()
+	if bridge.circuits[gateway.CircuitSpa] != 1 {
+		t.Fatal("spa should be on during the event")
+	}
+
+	s.now = func() time.Time { return time.Date(2026, 1, 17, 3, 35, 0, 0, time.UTC) }
+	s.poll()
+	if bridge.circuits[gateway.CircuitSpa] != 0 {
+		t.Error("spa should be off after the event")
+	}
+}
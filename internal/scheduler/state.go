@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nstielau/pool-controller/internal/atomicfile"
+)
+
+// State is where the scheduler is with a calendar event.
+type State string
+
+// Event states.
+const (
+	StatePending State = "pending" // active, waiting for the pool to stop
+	StateStarted State = "started" // the scheduler turned the spa on
+	StateEnded   State = "ended"   // over; the spa was turned off if started
+)
+
+// eventState is the tracked state of one event. End is kept so a started
+// event can still be finished if it disappears from the feed.
+type eventState struct {
+	State State     `json:"state"`
+	End   time.Time `json:"end"`
+}
+
+// loadStates reads saved event states. A missing file yields no states.
+func loadStates(path string) (map[string]eventState, error) {
+	states := make(map[string]eventState)
+	if path == "" {
+		return states, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler state: %w", err)
+	}
+	if err := json.Unmarshal(raw, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduler state: %w", err)
+	}
+	return states, nil
+}
+
+// saveStates writes event states to path ("" disables persistence).
+func saveStates(path string, states map[string]eventState) error {
+	if path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scheduler state: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to save scheduler state: %w", err)
+	}
+	return nil
+}
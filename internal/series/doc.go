@@ -0,0 +1,26 @@
+// Package series records pool readings over time in an append-only store
+// on local disk.
+//
+// # Storage
+//
+// A Store is a directory of JSON lines files, one line per snapshot:
+//
+//	raw-2024-07-04.jsonl   every recorded snapshot, one file per day
+//	hourly-2024-07.jsonl   min/max/mean per hour, one file per month
+//	daily-2024.jsonl       min/max/mean per day, one file per year
+//
+// Finished hours and days are downsampled as new snapshots arrive, and
+// whole files are removed once they fall out of their Retention. Files are
+// only ever appended to, so a power cut costs at most the last line, which
+// is skipped on read. Everything is plain Go; there is no cgo dependency.
+//
+// # Usage
+//
+//	store, err := series.Open("/opt/pool-controller/series", series.DefaultRetention)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	store.Record(time.Now(), map[string]float64{"pool_temperature": 78, "spa": 1})
+//
+//	points, _ := store.Query("pool_temperature", series.Hourly, time.Now().Add(-48*time.Hour), time.Now())
+package series
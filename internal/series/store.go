@@ -0,0 +1,560 @@
+package series
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolution is the granularity of stored points.
+type Resolution string
+
+// Resolutions, finest first. Raw points are every recorded snapshot;
+// hourly and daily points aggregate them.
+const (
+	Raw    Resolution = "raw"
+	Hourly Resolution = "hourly"
+	Daily  Resolution = "daily"
+)
+
+// ParseResolution returns the Resolution named s.
+func ParseResolution(s string) (Resolution, bool) {
+	switch r := Resolution(s); r {
+	case Raw, Hourly, Daily:
+		return r, true
+	}
+	return "", false
+}
+
+// Retention is how long each resolution is kept.
+type Retention struct {
+	Raw    time.Duration
+	Hourly time.Duration
+	Daily  time.Duration
+}
+
+// DefaultRetention keeps a week of raw points, three months of hourly and
+// two years of daily.
+var DefaultRetention = Retention{
+	Raw:    7 * 24 * time.Hour,
+	Hourly: 90 * 24 * time.Hour,
+	Daily:  730 * 24 * time.Hour,
+}
+
+// ParseRetention parses "raw=7d,hourly=90d,daily=730d". Durations are Go
+// durations or a number of days ("30d"); resolutions left out keep their
+// DefaultRetention.
+func ParseRetention(s string) (Retention, error) {
+	r := DefaultRetention
+	if strings.TrimSpace(s) == "" {
+		return r, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		name, durStr, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return r, fmt.Errorf("expected resolution=duration, got %q", part)
+		}
+		d, err := parseDays(strings.TrimSpace(durStr))
+		if err != nil || d <= 0 {
+			return r, fmt.Errorf("invalid retention %q for %s", durStr, name)
+		}
+
+		switch res, _ := ParseResolution(strings.TrimSpace(name)); res {
+		case Raw:
+			r.Raw = d
+		case Hourly:
+			r.Hourly = d
+		case Daily:
+			r.Daily = d
+		default:
+			return r, fmt.Errorf("unknown resolution %q", name)
+		}
+	}
+	return r, nil
+}
+
+// parseDays parses a Go duration or a whole number of days ("7d").
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Point is one value of a series. Aggregated points carry the minimum,
+// maximum and number of raw samples, and Value is their mean.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Min   *float64  `json:"min,omitempty"`
+	Max   *float64  `json:"max,omitempty"`
+	Count int       `json:"count,omitempty"`
+}
+
+// aggregate is the on-disk summary of one series over an hour or day.
+type aggregate struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+	Count int     `json:"n"`
+}
+
+// add folds another aggregate into a.
+func (a *aggregate) add(b aggregate) {
+	if a.Count == 0 {
+		*a = b
+		return
+	}
+	a.Min = math.Min(a.Min, b.Min)
+	a.Max = math.Max(a.Max, b.Max)
+	a.Sum += b.Sum
+	a.Count += b.Count
+}
+
+// rawRecord is one line of a raw file: every series' value at one time.
+type rawRecord struct {
+	Time   time.Time          `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// aggRecord is one line of an hourly or daily file.
+type aggRecord struct {
+	Time   time.Time            `json:"t"`
+	Values map[string]aggregate `json:"v"`
+}
+
+// Store is an append-only series store in a directory of JSON lines
+// files: raw-YYYY-MM-DD.jsonl per day, hourly-YYYY-MM.jsonl per month and
+// daily-YYYY.jsonl per year. Buckets and file names use UTC.
+//
+// Each Record appends a raw line. When a record starts a new hour, the
+// finished hours are aggregated into the hourly file, finished days into
+// the daily file, and files past their retention are removed. A line cut
+// short by a crash is skipped when read.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	retention Retention
+	hourlyTo  time.Time // end of the last aggregated hour
+	dailyTo   time.Time // end of the last aggregated day
+	logger    *log.Logger
+}
+
+// Open opens (creating if needed) the store in dir.
+func Open(dir string, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create series directory: %w", err)
+	}
+
+	s := &Store{
+		dir:       dir,
+		retention: retention,
+		logger:    log.New(os.Stdout, "[series] ", log.LstdFlags),
+	}
+
+	for _, res := range []Resolution{Raw, Hourly, Daily} {
+		if err := s.terminateLastLine(res); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if s.hourlyTo, err = s.lastTime(Hourly); err != nil {
+		return nil, err
+	}
+	if !s.hourlyTo.IsZero() {
+		s.hourlyTo = s.hourlyTo.Add(time.Hour)
+	}
+	if s.dailyTo, err = s.lastTime(Daily); err != nil {
+		return nil, err
+	}
+	if !s.dailyTo.IsZero() {
+		s.dailyTo = s.dailyTo.Add(24 * time.Hour)
+	}
+	return s, nil
+}
+
+// Record appends a snapshot of values taken at t. Snapshots must be
+// recorded in time order.
+func (s *Store) Record(t time.Time, values map[string]float64) error {
+	if len(values) == 0 {
+		return nil
+	}
+	t = t.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(Raw, t, rawRecord{Time: t, Values: values}); err != nil {
+		return err
+	}
+
+	hour := t.Truncate(time.Hour)
+	if !hour.After(s.hourlyTo) {
+		return nil
+	}
+	if err := s.downsample(hour); err != nil {
+		return err
+	}
+	s.prune(t)
+	return nil
+}
+
+// Query returns the points of one series at a resolution, from (inclusive)
+// to to (exclusive). Aggregated points are stamped with the start of their
+// hour or day.
+func (s *Store) Query(name string, res Resolution, from, to time.Time) ([]Point, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := []Point{}
+	if res == Raw {
+		records, err := s.readRaw(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if v, ok := r.Values[name]; ok {
+				points = append(points, Point{Time: r.Time, Value: v})
+			}
+		}
+		return points, nil
+	}
+
+	records, err := s.readAgg(res, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if a, ok := r.Values[name]; ok && a.Count > 0 {
+			lo, hi := a.Min, a.Max
+			points = append(points, Point{Time: r.Time, Value: a.Sum / float64(a.Count), Min: &lo, Max: &hi, Count: a.Count})
+		}
+	}
+	return points, nil
+}
+
+// downsample aggregates raw points before hour into hourly points, and
+// hourly points before that day into daily points. Caller must hold s.mu.
+func (s *Store) downsample(hour time.Time) error {
+	start := s.hourlyTo
+	records, err := s.readRaw(start, hour)
+	if err != nil {
+		return err
+	}
+
+	buckets := make(map[time.Time]map[string]aggregate)
+	for _, r := range records {
+		b := r.Time.Truncate(time.Hour)
+		if buckets[b] == nil {
+			buckets[b] = make(map[string]aggregate)
+		}
+		for name, v := range r.Values {
+			a := buckets[b][name]
+			a.add(aggregate{Min: v, Max: v, Sum: v, Count: 1})
+			buckets[b][name] = a
+		}
+	}
+	if err := s.appendBuckets(Hourly, buckets); err != nil {
+		return err
+	}
+	s.hourlyTo = hour
+
+	day := hour.Truncate(24 * time.Hour)
+	if !day.After(s.dailyTo) {
+		return nil
+	}
+	hourly, err := s.readAgg(Hourly, s.dailyTo, day)
+	if err != nil {
+		return err
+	}
+
+	buckets = make(map[time.Time]map[string]aggregate)
+	for _, r := range hourly {
+		b := r.Time.Truncate(24 * time.Hour)
+		if buckets[b] == nil {
+			buckets[b] = make(map[string]aggregate)
+		}
+		for name, v := range r.Values {
+			a := buckets[b][name]
+			a.add(v)
+			buckets[b][name] = a
+		}
+	}
+	if err := s.appendBuckets(Daily, buckets); err != nil {
+		return err
+	}
+	s.dailyTo = day
+	return nil
+}
+
+// appendBuckets writes aggregated buckets in time order. Caller must hold
+// s.mu.
+func (s *Store) appendBuckets(res Resolution, buckets map[time.Time]map[string]aggregate) error {
+	times := make([]time.Time, 0, len(buckets))
+	for t := range buckets {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	for _, t := range times {
+		if err := s.append(res, t, aggRecord{Time: t, Values: buckets[t]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes files that ended before their resolution's retention.
+// Failures are logged; they only cost disk space. Caller must hold s.mu.
+func (s *Store) prune(now time.Time) {
+	for res, keep := range map[Resolution]time.Duration{
+		Raw:    s.retention.Raw,
+		Hourly: s.retention.Hourly,
+		Daily:  s.retention.Daily,
+	} {
+		files, err := s.files(res)
+		if err != nil {
+			s.logger.Printf("Failed to list %s files: %v", res, err)
+			continue
+		}
+		for _, f := range files {
+			if f.end.Before(now.Add(-keep)) {
+				if err := os.Remove(f.path); err != nil {
+					s.logger.Printf("Failed to remove %s: %v", f.path, err)
+					continue
+				}
+				s.logger.Printf("Removed %s (past %s retention)", filepath.Base(f.path), res)
+			}
+		}
+	}
+}
+
+// append writes one JSON line to the file for res covering t. Caller must
+// hold s.mu.
+func (s *Store) append(res Resolution, t time.Time, record interface{}) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, fileName(res, t))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// readRaw returns raw records in [from, to). Caller must hold s.mu.
+func (s *Store) readRaw(from, to time.Time) ([]rawRecord, error) {
+	files, err := s.filesBetween(Raw, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []rawRecord
+	for _, path := range files {
+		records, err := readLines[rawRecord](path, s.logger)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if !r.Time.Before(from) && r.Time.Before(to) {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+// readAgg returns hourly or daily records in [from, to). Caller must hold
+// s.mu.
+func (s *Store) readAgg(res Resolution, from, to time.Time) ([]aggRecord, error) {
+	files, err := s.filesBetween(res, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []aggRecord
+	for _, path := range files {
+		records, err := readLines[aggRecord](path, s.logger)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if !r.Time.Before(from) && r.Time.Before(to) {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+// lastTime returns the time of the last record at res, or zero if there is
+// none. Caller must hold s.mu or be opening the store.
+func (s *Store) lastTime(res Resolution) (time.Time, error) {
+	files, err := s.files(res)
+	if err != nil || len(files) == 0 {
+		return time.Time{}, err
+	}
+	records, err := readLines[aggRecord](files[len(files)-1].path, s.logger)
+	if err != nil || len(records) == 0 {
+		return time.Time{}, err
+	}
+	return records[len(records)-1].Time, nil
+}
+
+// terminateLastLine ends the newest file at res with a newline if a crash
+// cut its last line short, so the next record starts a line of its own.
+func (s *Store) terminateLastLine(res Resolution) error {
+	files, err := s.files(res)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	f, err := os.OpenFile(files[len(files)-1].path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", files[len(files)-1].path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err = f.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// storeFile is one data file and the period it covers.
+type storeFile struct {
+	path       string
+	start, end time.Time
+}
+
+// files lists the files at res, oldest first.
+func (s *Store) files(res Resolution) ([]storeFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read series directory: %w", err)
+	}
+
+	var files []storeFile
+	for _, e := range entries {
+		start, end, ok := filePeriod(res, e.Name())
+		if ok {
+			files = append(files, storeFile{path: filepath.Join(s.dir, e.Name()), start: start, end: end})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start.Before(files[j].start) })
+	return files, nil
+}
+
+// filesBetween lists the paths of files at res that overlap [from, to).
+// A zero from means the beginning.
+func (s *Store) filesBetween(res Resolution, from, to time.Time) ([]string, error) {
+	files, err := s.files(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, f := range files {
+		if f.start.Before(to) && f.end.After(from) {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths, nil
+}
+
+// File name layouts by resolution.
+var fileLayouts = map[Resolution]string{
+	Raw:    "2006-01-02",
+	Hourly: "2006-01",
+	Daily:  "2006",
+}
+
+// fileName returns the name of the file at res that holds t.
+func fileName(res Resolution, t time.Time) string {
+	return string(res) + "-" + t.UTC().Format(fileLayouts[res]) + ".jsonl"
+}
+
+// filePeriod parses a file name at res into the period it covers.
+func filePeriod(res Resolution, name string) (time.Time, time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, string(res)+"-")
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, ".jsonl")
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	start, err := time.Parse(fileLayouts[res], stamp)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	switch res {
+	case Raw:
+		return start, start.AddDate(0, 0, 1), true
+	case Hourly:
+		return start, start.AddDate(0, 1, 0), true
+	default:
+		return start, start.AddDate(1, 0, 0), true
+	}
+}
+
+// readLines decodes a JSON lines file, skipping lines that don't parse
+// (such as one cut short by a power failure).
+func readLines[T any](path string, logger *log.Logger) ([]T, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var out []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var v T
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			logger.Printf("Skipping %s line %d: %v", filepath.Base(path), n, err)
+			continue
+		}
+		out = append(out, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return out, nil
+}
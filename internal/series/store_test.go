@@ -0,0 +1,134 @@
+package series
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// start is midnight UTC on a Monday.
+var start = time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+// recordEvery records temp (rising by one each time) every step from
+// start until end.
+func recordEvery(t *testing.T, s *Store, from, end time.Time, step time.Duration, temp float64) {
+	t.Helper()
+	for ts := from; ts.Before(end); ts = ts.Add(step) {
+		if err := s.Record(ts, map[string]float64{"pool_temperature": temp, "spa": 0}); err != nil {
+			t.Fatalf("Record(%s) error = %v", ts, err)
+		}
+		temp++
+	}
+}
+
+func TestStoreDownsampling(t *testing.T) {
+	s, err := Open(t.TempDir(), DefaultRetention)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Four samples an hour for two days and one more to close the second day
+	recordEvery(t, s, start, start.Add(48*time.Hour+time.Minute), 15*time.Minute, 70)
+
+	raw, err := s.Query("pool_temperature", Raw, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Query(raw) error = %v", err)
+	}
+	if len(raw) != 4 || raw[3].Value != 73 || raw[0].Min != nil {
+		t.Errorf("raw points = %+v", raw)
+	}
+
+	hourly, err := s.Query("pool_temperature", Hourly, start, start.Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("Query(hourly) error = %v", err)
+	}
+	if len(hourly) != 48 {
+		t.Fatalf("hourly points = %d, want 48", len(hourly))
+	}
+	if h := hourly[1]; !h.Time.Equal(start.Add(time.Hour)) || h.Value != 75.5 || *h.Min != 74 || *h.Max != 77 || h.Count != 4 {
+		t.Errorf("second hour = %+v (min %v max %v)", h, *h.Min, *h.Max)
+	}
+
+	daily, err := s.Query("pool_temperature", Daily, start, start.Add(72*time.Hour))
+	if err != nil {
+		t.Fatalf("Query(daily) error = %v", err)
+	}
+	if len(daily) != 2 || daily[0].Count != 96 || *daily[0].Min != 70 || *daily[0].Max != 165 || daily[0].Value != 117.5 {
+		t.Errorf("daily points = %+v", daily)
+	}
+
+	if points, _ := s.Query("unknown", Hourly, start, start.Add(48*time.Hour)); len(points) != 0 {
+		t.Errorf("unknown series has %d points", len(points))
+	}
+}
+
+func TestStoreReopenResumesDownsampling(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultRetention)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	recordEvery(t, s, start, start.Add(90*time.Minute), 30*time.Minute, 70)
+
+	// Restart mid-hour, as after a power cut that also cut a line short
+	f, _ := os.OpenFile(filepath.Join(dir, "raw-2024-07-01.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"t":"2024-07-01T01:4`)
+	f.Close()
+
+	s, err = Open(dir, DefaultRetention)
+	if err != nil {
+		t.Fatalf("Open() again error = %v", err)
+	}
+	recordEvery(t, s, start.Add(2*time.Hour), start.Add(2*time.Hour+time.Minute), time.Hour, 80)
+
+	hourly, err := s.Query("pool_temperature", Hourly, start, start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(hourly) != 2 || hourly[0].Count != 2 || hourly[1].Count != 1 || hourly[1].Value != 72 {
+		t.Errorf("hourly points = %+v", hourly)
+	}
+	if raw, _ := s.Query("pool_temperature", Raw, start.Add(2*time.Hour), start.Add(3*time.Hour)); len(raw) != 1 || raw[0].Value != 80 {
+		t.Errorf("raw points after the cut line = %+v", raw)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{Raw: 48 * time.Hour, Hourly: 30 * 24 * time.Hour, Daily: DefaultRetention.Daily})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	recordEvery(t, s, start, start.Add(5*24*time.Hour), time.Hour, 70)
+
+	// Day files that ended more than 48h before the last record are gone
+	for _, name := range []string{"raw-2024-07-01.jsonl", "raw-2024-07-02.jsonl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", name)
+		}
+	}
+	if points, _ := s.Query("pool_temperature", Raw, start, start.Add(5*24*time.Hour)); len(points) != 72 {
+		t.Errorf("raw points = %d, want 72", len(points))
+	}
+	if points, _ := s.Query("pool_temperature", Hourly, start, start.Add(5*24*time.Hour)); len(points) != 119 {
+		t.Errorf("hourly points = %d, want 119 (downsampled before removal)", len(points))
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	r, err := ParseRetention("raw=3d, daily=8760h")
+	if err != nil {
+		t.Fatalf("ParseRetention() error = %v", err)
+	}
+	if r.Raw != 72*time.Hour || r.Hourly != DefaultRetention.Hourly || r.Daily != 8760*time.Hour {
+		t.Errorf("ParseRetention() = %+v", r)
+	}
+
+	for _, bad := range []string{"raw", "raw=soon", "raw=0d", "weekly=7d"} {
+		if _, err := ParseRetention(bad); err == nil {
+			t.Errorf("ParseRetention(%q) should fail", bad)
+		}
+	}
+}
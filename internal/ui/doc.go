@@ -0,0 +1,21 @@
+// Package ui is the web dashboard, embedded in the binary and served at
+// /ui.
+//
+// It is a single page of plain HTML, CSS and JavaScript with no build step
+// and no external assets, so it works on a LAN without internet access.
+// The page only uses the JSON API:
+//
+//   - GET /pool for bodies, circuits, chemistry and status
+//   - GET /pool/events to update live, falling back to polling
+//   - GET /pool/history for the last day's temperatures and runs
+//   - POST /pool/{circuit}, PUT /pool/body/{body}/set_point and
+//     PUT /pool/body/{body}/heat_mode for control
+//
+// The files themselves are public; the page asks for an API token, keeps it
+// in the browser's local storage and sends it as a Bearer token. A read
+// token shows everything but cannot change anything. Opening
+// /ui/#token=<token> stores a token without typing it, which is handy for
+// setting up a wall tablet.
+//
+//	mux.Handle("GET /ui/", http.StripPrefix("/ui", ui.Handler()))
+package ui
@@ -0,0 +1,519 @@
+// Pool dashboard. Plain JavaScript against the controller's JSON API; see
+// package ui for the endpoints it uses.
+"use strict";
+
+const TOKEN_KEY = "poolToken";
+const HEAT_MODES = ["Off", "Solar", "Solar Preferred", "Heat"];
+const BODIES = ["pool", "spa"];
+const POLL_INTERVAL = 30000; // when the event stream is unavailable
+const HISTORY_INTERVAL = 10 * 60000;
+const SET_POINT_DELAY = 800; // wait for more taps before sending
+
+// Chemistry readings in display order; missing ones are skipped.
+const CHEMISTRY = [
+  "ph", "orp", "saturation", "salt_ppm", "ph_set_point", "orp_set_point",
+  "ph_tank_level", "orp_tank_level", "calcium_hardness", "cyanuric_acid",
+  "total_alkalinity", "chlorinator_pool_output", "chlorinator_spa_output",
+  "super_chlorinate", "chemistry_alarms", "chemistry_alerts",
+];
+
+const HISTORY_LINES = [
+  { key: "poolTemperature", label: "Pool", color: "#0b6e99" },
+  { key: "spaTemperature", label: "Spa", color: "#d9622b" },
+  { key: "airTemperature", label: "Air", color: "#8fa3ae" },
+];
+
+const HISTORY_RUNS = [
+  { key: "heater", label: "Heater", color: "#d9622b" },
+  { key: "spa", label: "Spa", color: "#e8a33d" },
+  { key: "pool", label: "Pool", color: "#0b6e99" },
+  { key: "solar", label: "Solar", color: "#e6c229" },
+  { key: "light", label: "Lights", color: "#8e6bd6" },
+];
+
+let devices = {};
+let lastEventId = "";
+let pollTimer = null;
+const pendingSetPoints = {};
+
+const $ = (id) => document.getElementById(id);
+
+function token() {
+  return localStorage.getItem(TOKEN_KEY) || "";
+}
+
+// api calls the controller, throwing an Error with the server's message on
+// failure. err.status is 401 when the token is missing or rejected.
+async function api(method, path, body) {
+  const options = { method, headers: { Authorization: "Bearer " + token() } };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+
+  const resp = await fetch(path, options);
+  const text = await resp.text();
+  if (!resp.ok) {
+    const err = new Error(text.trim() || resp.statusText);
+    err.status = resp.status;
+    throw err;
+  }
+  try {
+    return text ? JSON.parse(text) : null;
+  } catch (e) {
+    // Legacy auth answers a bad token with 200 "Unauthed"
+    const err = new Error(text.trim());
+    err.status = 401;
+    throw err;
+  }
+}
+
+function setStatus(text, kind) {
+  const el = $("status");
+  el.textContent = text;
+  el.className = "status" + (kind ? " " + kind : "");
+}
+
+let toastTimer = null;
+function toast(text) {
+  const el = $("toast");
+  el.textContent = text;
+  el.hidden = false;
+  clearTimeout(toastTimer);
+  toastTimer = setTimeout(() => { el.hidden = true; }, 4000);
+}
+
+// failed reports a failed control request.
+function failed(err) {
+  if (err.status === 401) {
+    showLogin("Your token was rejected.");
+  } else if (err.status === 403) {
+    toast("This token can only read. Use a control token to make changes.");
+  } else {
+    toast(err.message);
+  }
+}
+
+// number pulls the number out of a sensor state such as "102 °F".
+function number(state) {
+  const n = parseFloat(state);
+  return Number.isNaN(n) ? null : n;
+}
+
+// unit pulls the unit out of a sensor state such as "102 °F".
+function unit(state) {
+  const m = /^-?[\d.]+\s*(.*)$/.exec(state || "");
+  return m ? m[1] : "";
+}
+
+function el(tag, className, text) {
+  const e = document.createElement(tag);
+  if (className) e.className = className;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function sensor(key) {
+  const d = devices[key];
+  return d && d.id === undefined ? d.state : undefined;
+}
+
+// Rendering
+
+function render() {
+  renderBodies();
+  renderCircuits();
+  renderReadings($("chemistry"), CHEMISTRY.filter((k) => devices[k]));
+  renderReadings($("equipment"), equipmentKeys());
+}
+
+function renderBodies() {
+  const container = $("bodies");
+  container.replaceChildren();
+
+  for (const body of BODIES) {
+    const current = sensor(`current_${body}_temperature`);
+    if (current === undefined) continue;
+
+    const card = el("div", "body");
+    const title = el("h2", "", body === "pool" ? "Pool" : "Spa");
+    const heaterKey = Object.keys(devices).find((k) => k.startsWith(`${body}_heater_`));
+    if (heaterKey && devices[heaterKey].state !== "Off") {
+      title.append(el("span", "heating", "Heating"));
+    }
+    card.append(title, el("div", "temp", current));
+
+    const setPoint = pendingSetPoints[body] ? pendingSetPoints[body].value : number(sensor(`${body}_heat_set_point`));
+    if (setPoint !== null) {
+      const row = el("div", "setpoint");
+      const down = el("button", "", "−");
+      const up = el("button", "", "+");
+      down.setAttribute("aria-label", "Lower set point");
+      up.setAttribute("aria-label", "Raise set point");
+      down.onclick = () => changeSetPoint(body, setPoint - 1);
+      up.onclick = () => changeSetPoint(body, setPoint + 1);
+      row.append(down, el("span", "value", `Set to ${setPoint} ${unit(sensor(`${body}_heat_set_point`))}`), up);
+      card.append(row);
+    }
+
+    const mode = sensor(`${body}_heat_mode`);
+    if (mode !== undefined) {
+      const select = el("select");
+      select.setAttribute("aria-label", "Heat mode");
+      for (const m of HEAT_MODES) {
+        const option = el("option", "", m === "Off" ? "Heat off" : m);
+        option.value = m;
+        option.selected = m === mode;
+        select.append(option);
+      }
+      select.onchange = () => changeHeatMode(body, select.value);
+      card.append(select);
+    }
+
+    container.append(card);
+  }
+}
+
+function renderCircuits() {
+  const container = $("circuits");
+  container.replaceChildren();
+
+  const keys = Object.keys(devices).filter((k) => devices[k].id !== undefined);
+  keys.sort((a, b) => devices[a].id - devices[b].id);
+
+  for (const key of keys) {
+    const d = devices[key];
+    const on = d.state > 0;
+    const button = el("button", "circuit" + (on ? " on" : ""));
+    button.setAttribute("aria-pressed", on);
+    button.append(el("span", "name", d.name));
+
+    let state = on ? "On" : "Off";
+    if (on && d.offAt) {
+      const minutes = Math.max(0, Math.round((new Date(d.offAt) - Date.now()) / 60000));
+      state += ` · off in ${minutes} min`;
+    }
+    button.append(el("span", "state", state));
+
+    button.onclick = () => toggle(key, button);
+    container.append(button);
+  }
+}
+
+function equipmentKeys() {
+  const keys = ["air_temperature", "freeze_protection", "pool_delay", "spa_delay", "cleaner_delay"];
+  for (const key of Object.keys(devices).sort()) {
+    if (/^pump_\d+/.test(key) || key.endsWith("_color")) keys.push(key);
+  }
+  return keys.filter((k) => devices[k]);
+}
+
+function renderReadings(container, keys) {
+  container.replaceChildren();
+  for (const key of keys) {
+    const d = devices[key];
+    const item = el("div");
+    const alarm = (key === "chemistry_alarms" || key === "chemistry_alerts") && d.state !== "None";
+    if (alarm || (key === "freeze_protection" && d.state === "On")) item.className = "alert";
+    item.append(el("dt", "", d.name), el("dd", "", d.state));
+    container.append(item);
+  }
+  container.parentElement.hidden = keys.length === 0;
+}
+
+// History chart: temperatures as lines, runs as bars underneath.
+function renderHistory(history) {
+  const container = $("history");
+  container.replaceChildren();
+
+  const ns = "http://www.w3.org/2000/svg";
+  const svgEl = (tag, attrs) => {
+    const e = document.createElementNS(ns, tag);
+    for (const [k, v] of Object.entries(attrs)) e.setAttribute(k, v);
+    return e;
+  };
+
+  const from = new Date(history.from).getTime();
+  const to = new Date(history.to).getTime();
+  const lines = HISTORY_LINES.filter((l) => (history[l.key] || []).length > 0);
+  const runs = HISTORY_RUNS.filter((r) => (history.runs[r.key] || []).length > 0);
+  if (lines.length === 0 && runs.length === 0) {
+    container.append(el("p", "muted", "No history logged yet."));
+    return;
+  }
+
+  const width = 600, chartHeight = 160, laneHeight = 14, left = 34, top = 8;
+  const height = top + chartHeight + 24 + runs.length * (laneHeight + 4);
+  const x = (t) => left + ((new Date(t).getTime() - from) / (to - from)) * (width - left);
+
+  const temps = lines.flatMap((l) => history[l.key].map((s) => s.temperature));
+  let lo = Math.min(...temps), hi = Math.max(...temps);
+  if (hi - lo < 10) { lo -= 5; hi += 5; }
+  const y = (v) => top + chartHeight - ((v - lo) / (hi - lo)) * chartHeight;
+
+  const svg = svgEl("svg", { viewBox: `0 0 ${width} ${height}`, role: "img", "aria-label": "Temperatures and runs over the last day" });
+
+  if (lines.length > 0) {
+    for (const v of [lo, (lo + hi) / 2, hi]) {
+      const rounded = Math.round(v);
+      svg.append(svgEl("line", { class: "axis", x1: left, x2: width, y1: y(rounded), y2: y(rounded) }));
+      const label = svgEl("text", { class: "label", x: 0, y: y(rounded) + 4 });
+      label.textContent = `${rounded}°`;
+      svg.append(label);
+    }
+    for (const l of lines) {
+      const points = history[l.key].map((s) => `${x(s.time).toFixed(1)},${y(s.temperature).toFixed(1)}`);
+      svg.append(svgEl("polyline", { class: "line", stroke: l.color, points: points.join(" ") }));
+    }
+  }
+
+  // Hour marks every 6 hours
+  const six = 6 * 3600000;
+  for (let t = Math.ceil(from / six) * six; t < to; t += six) {
+    const label = svgEl("text", { class: "label", x: x(t) - 12, y: top + chartHeight + 16 });
+    label.textContent = new Date(t).toLocaleTimeString([], { hour: "numeric" });
+    svg.append(label);
+  }
+
+  runs.forEach((r, i) => {
+    const laneY = top + chartHeight + 24 + i * (laneHeight + 4);
+    const label = svgEl("text", { class: "label", x: 0, y: laneY + laneHeight - 3 });
+    label.textContent = r.label;
+    svg.append(label);
+    for (const run of history.runs[r.key]) {
+      const start = Math.max(x(run.on), left);
+      const end = x(run.off || history.to);
+      svg.append(svgEl("rect", { class: "run", fill: r.color, x: start, y: laneY, width: Math.max(end - start, 1), height: laneHeight, rx: 3 }));
+    }
+  });
+
+  container.append(svg);
+
+  const legend = el("div", "legend");
+  for (const l of lines) {
+    const item = el("span", "", l.label);
+    item.style.setProperty("--swatch", l.color);
+    legend.append(item);
+  }
+  container.append(legend);
+}
+
+// Control
+
+async function toggle(key, button) {
+  button.disabled = true;
+  try {
+    devices[key] = await api("POST", `/pool/${key}`, { state: "toggle" });
+    renderCircuits();
+  } catch (err) {
+    failed(err);
+    button.disabled = false;
+  }
+}
+
+// changeSetPoint shows the new set point at once but only sends it after
+// the taps stop.
+function changeSetPoint(body, value) {
+  const pending = pendingSetPoints[body] || {};
+  clearTimeout(pending.timer);
+  pending.value = value;
+  pending.timer = setTimeout(() => sendSetPoint(body), SET_POINT_DELAY);
+  pendingSetPoints[body] = pending;
+  renderBodies();
+}
+
+async function sendSetPoint(body) {
+  const { value } = pendingSetPoints[body];
+  try {
+    await api("PUT", `/pool/body/${body}/set_point`, { temperature: value });
+  } catch (err) {
+    failed(err);
+  }
+  delete pendingSetPoints[body];
+  await refresh();
+}
+
+async function changeHeatMode(body, mode) {
+  try {
+    await api("PUT", `/pool/body/${body}/heat_mode`, { mode: mode.toLowerCase() });
+  } catch (err) {
+    failed(err);
+  }
+  await refresh();
+}
+
+// Data
+
+async function refresh() {
+  try {
+    devices = await api("GET", "/pool");
+    render();
+  } catch (err) {
+    if (err.status === 401) {
+      showLogin("Your token was rejected.");
+    } else {
+      setStatus("Controller unreachable", "error");
+    }
+  }
+}
+
+async function loadHistory() {
+  try {
+    renderHistory(await api("GET", "/pool/history"));
+  } catch (err) {
+    $("history").replaceChildren(el("p", "muted", "History unavailable: " + err.message));
+  }
+}
+
+// applyChange updates a device from a change event. Events carry the raw
+// state; /pool shows sensors by their friendly state and circuits by both.
+function applyChange(ev) {
+  const d = devices[ev.device];
+  if (!d) {
+    refresh();
+    return;
+  }
+  if (d.id !== undefined) {
+    d.state = ev.state;
+    d.friendlyState = ev.friendlyState.toLowerCase();
+    if (!ev.state) {
+      delete d.offAt;
+      delete d.remainingSeconds;
+    }
+  } else {
+    d.state = ev.friendlyState;
+  }
+  render();
+}
+
+// listen follows /pool/events. EventSource can't send an Authorization
+// header, so the stream is read with fetch. When the stream isn't
+// available the dashboard polls instead.
+async function listen() {
+  const headers = { Authorization: "Bearer " + token(), Accept: "text/event-stream" };
+  if (lastEventId) headers["Last-Event-ID"] = lastEventId;
+
+  let resp;
+  try {
+    resp = await fetch("/pool/events", { headers });
+  } catch (err) {
+    setStatus("Reconnecting…", "error");
+    setTimeout(listen, 3000);
+    return;
+  }
+
+  if (resp.status === 401) {
+    showLogin("Your token was rejected.");
+    return;
+  }
+  if (!resp.ok || !(resp.headers.get("Content-Type") || "").startsWith("text/event-stream") || !resp.body) {
+    startPolling();
+    return;
+  }
+
+  stopPolling();
+  setStatus("Live", "live");
+
+  const reader = resp.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = "";
+  try {
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let end;
+      while ((end = buffer.indexOf("\n\n")) >= 0) {
+        handleEvent(buffer.slice(0, end));
+        buffer = buffer.slice(end + 2);
+      }
+    }
+  } catch (err) {
+    // Dropped connection; reconnect below
+  }
+
+  setStatus("Reconnecting…", "error");
+  setTimeout(listen, 3000);
+}
+
+function handleEvent(block) {
+  let event = "message", data = "", id = "";
+  for (const line of block.split("\n")) {
+    const i = line.indexOf(":");
+    if (i === 0) continue; // heartbeat comment
+    const field = i < 0 ? line : line.slice(0, i);
+    const value = i < 0 ? "" : line.slice(i + 1).replace(/^ /, "");
+    if (field === "event") event = value;
+    else if (field === "data") data += value;
+    else if (field === "id") id = value;
+  }
+  if (id) lastEventId = id;
+
+  if (event === "snapshot") {
+    devices = JSON.parse(data);
+    render();
+  } else if (event === "change") {
+    applyChange(JSON.parse(data));
+  }
+}
+
+function startPolling() {
+  setStatus("Updating every 30s");
+  if (!pollTimer) pollTimer = setInterval(refresh, POLL_INTERVAL);
+}
+
+function stopPolling() {
+  clearInterval(pollTimer);
+  pollTimer = null;
+}
+
+// Login
+
+function showLogin(message) {
+  stopPolling();
+  $("dashboard").hidden = true;
+  $("login").hidden = false;
+  $("login-error").hidden = !message;
+  $("login-error").textContent = message || "";
+  setStatus("");
+  $("token").focus();
+}
+
+async function start() {
+  $("login").hidden = true;
+  $("dashboard").hidden = false;
+  setStatus("Connecting…");
+
+  await refresh();
+  if (!$("login").hidden) return;
+
+  loadHistory();
+  setInterval(loadHistory, HISTORY_INTERVAL);
+  setInterval(renderCircuits, 30000); // keep "off in" times current
+  listen();
+}
+
+$("login").onsubmit = (e) => {
+  e.preventDefault();
+  localStorage.setItem(TOKEN_KEY, $("token").value.trim());
+  start();
+};
+
+$("logout").onclick = () => {
+  localStorage.removeItem(TOKEN_KEY);
+  location.reload();
+};
+
+// /ui/#token=... stores a token, e.g. when setting up a wall tablet
+const fragment = new URLSearchParams(location.hash.slice(1));
+if (fragment.get("token")) {
+  localStorage.setItem(TOKEN_KEY, fragment.get("token"));
+  history.replaceState(null, "", location.pathname);
+}
+
+if (token()) {
+  start();
+} else {
+  showLogin();
+}